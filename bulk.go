@@ -0,0 +1,351 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultBulkBatchSize = 1000
+
+// BulkWriteBuilder collects insert, replace, update and delete operations
+// targeting the collection of a single Document type. Operations are sent in
+// the order they were added, split into batches of at most BatchSize models.
+type BulkWriteBuilder struct {
+	document   Document
+	operations []bulkOperation
+	ordered    bool
+	batchSize  int
+	err        error
+}
+
+// bulkOperation is an operation added to a BulkWriteBuilder. Updates keep
+// their input until BulkWrite builds them with the settings of the client.
+type bulkOperation struct {
+	model  mongo.WriteModel
+	filter bson.M
+	input  interface{}
+	many   bool
+}
+
+type BulkWriteError struct {
+	Index   int
+	Code    int
+	Message string
+}
+
+type BulkWriteResult struct {
+	InsertedCount int64
+	MatchedCount  int64
+	ModifiedCount int64
+	DeletedCount  int64
+	UpsertedCount int64
+	UpsertedIDs   map[int]interface{}
+	Errors        []BulkWriteError
+}
+
+func NewBulkWrite(d Document) *BulkWriteBuilder {
+	return &BulkWriteBuilder{
+		document:  d,
+		ordered:   true,
+		batchSize: defaultBulkBatchSize,
+	}
+}
+
+// Ordered sets whether the operations stop at the first error (the default)
+// or keep going and report every failing index.
+func (b *BulkWriteBuilder) Ordered(ordered bool) *BulkWriteBuilder {
+	b.ordered = ordered
+	return b
+}
+
+func (b *BulkWriteBuilder) BatchSize(size int) *BulkWriteBuilder {
+	if size > 0 {
+		b.batchSize = size
+	}
+	return b
+}
+
+func (b *BulkWriteBuilder) Document() Document {
+	return b.document
+}
+
+func (b *BulkWriteBuilder) IsOrdered() bool {
+	return b.ordered
+}
+
+// Models returns the driver write models of the operations collected so
+// far, the updates being built with the optional config of the client, see
+// UpdateDocument.
+func (b *BulkWriteBuilder) Models(config ...UpdateConfig) ([]mongo.WriteModel, error) {
+	models := make([]mongo.WriteModel, len(b.operations))
+
+	for i, operation := range b.operations {
+		model, err := operation.writeModel(config...)
+
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		models[i] = model
+	}
+
+	return models, nil
+}
+
+func (o bulkOperation) writeModel(config ...UpdateConfig) (mongo.WriteModel, error) {
+	if o.model != nil {
+		return o.model, nil
+	}
+
+	update, arrayFilters, err := updateDocument(o.input, config...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	filters := arrayFiltersOption(arrayFilters)
+
+	if o.many {
+		model := mongo.NewUpdateManyModel().
+			SetFilter(o.filter).
+			SetUpdate(update)
+
+		if filters != nil {
+			model.SetArrayFilters(*filters)
+		}
+
+		return model, nil
+	}
+
+	model := mongo.NewUpdateOneModel().
+		SetFilter(o.filter).
+		SetUpdate(update)
+
+	if filters != nil {
+		model.SetArrayFilters(*filters)
+	}
+
+	return model, nil
+}
+
+func (b *BulkWriteBuilder) Len() int {
+	return len(b.operations)
+}
+
+func (b *BulkWriteBuilder) add(model mongo.WriteModel) *BulkWriteBuilder {
+	b.operations = append(b.operations, bulkOperation{model: model})
+	return b
+}
+
+// Err returns the first error met while adding operations, in which case
+// BulkWrite sends nothing.
+func (b *BulkWriteBuilder) Err() error {
+	return b.err
+}
+
+// fail keeps the first error met while adding operations.
+func (b *BulkWriteBuilder) fail(err error) *BulkWriteBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+
+	return b
+}
+
+// Insert adds inserts of docs, which must belong to the collection of the
+// builder, assigning their IDs and timestamps as Persist does.
+func (b *BulkWriteBuilder) Insert(docs ...Document) *BulkWriteBuilder {
+	if err := sameCollection(b.document, docs); err != nil {
+		return b.fail(err)
+	}
+
+	for _, d := range docs {
+		prepareInsert(d)
+		b.add(mongo.NewInsertOneModel().SetDocument(d))
+	}
+	return b
+}
+
+func (b *BulkWriteBuilder) Replace(docs ...Document) *BulkWriteBuilder {
+	if err := sameCollection(b.document, docs); err != nil {
+		return b.fail(err)
+	}
+
+	for _, d := range docs {
+		d.SetUpdatedAt()
+		b.add(mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": d.GetID()}).
+			SetReplacement(d))
+	}
+	return b
+}
+
+// UpdateWhere adds an update of the first document matching filter. input
+// is built by BulkWrite, with the settings of the client, as UpdateWhere
+// does.
+func (b *BulkWriteBuilder) UpdateWhere(filter bson.M, input interface{}) *BulkWriteBuilder {
+	b.operations = append(b.operations, bulkOperation{filter: filter, input: input})
+	return b
+}
+
+// UpdateMany adds an update of every document matching filter, built as
+// UpdateWhere ones.
+func (b *BulkWriteBuilder) UpdateMany(filter bson.M, input interface{}) *BulkWriteBuilder {
+	b.operations = append(b.operations, bulkOperation{filter: filter, input: input, many: true})
+	return b
+}
+
+func (b *BulkWriteBuilder) Delete(docs ...Document) *BulkWriteBuilder {
+	if err := sameCollection(b.document, docs); err != nil {
+		return b.fail(err)
+	}
+
+	for _, d := range docs {
+		b.add(mongo.NewDeleteOneModel().SetFilter(bson.M{"_id": d.GetID()}))
+	}
+	return b
+}
+
+func (b *BulkWriteBuilder) DeleteMany(filter bson.M) *BulkWriteBuilder {
+	return b.add(mongo.NewDeleteManyModel().SetFilter(filter))
+}
+
+// sameCollection returns an error naming the first of docs stored outside the
+// collection of d.
+func sameCollection(d Document, docs []Document) error {
+	for i, doc := range docs {
+		if doc.DocumentName() != d.DocumentName() {
+			return fmt.Errorf("document %d belongs to collection %s", i, doc.DocumentName())
+		}
+	}
+
+	return nil
+}
+
+func (b *BulkWriteBuilder) batches(models []mongo.WriteModel) [][]mongo.WriteModel {
+	var batches [][]mongo.WriteModel
+
+	for start := 0; start < len(models); start += b.batchSize {
+		end := start + b.batchSize
+
+		if end > len(models) {
+			end = len(models)
+		}
+
+		batches = append(batches, models[start:end])
+	}
+
+	return batches
+}
+
+func (r *BulkWriteResult) add(offset int, res *mongo.BulkWriteResult) {
+	if res == nil {
+		return
+	}
+
+	r.InsertedCount += res.InsertedCount
+	r.MatchedCount += res.MatchedCount
+	r.ModifiedCount += res.ModifiedCount
+	r.DeletedCount += res.DeletedCount
+	r.UpsertedCount += res.UpsertedCount
+
+	for index, id := range res.UpsertedIDs {
+		r.UpsertedIDs[offset+int(index)] = id
+	}
+}
+
+// BulkWrite executes the operations collected by b. The returned result is
+// always populated with the counts of the batches that ran; when some
+// operations failed, their indexes are listed in Errors and the first driver
+// error is returned.
+func (m *mongoClient) BulkWrite(b *BulkWriteBuilder) (*BulkWriteResult, error) {
+	result := &BulkWriteResult{
+		UpsertedIDs: make(map[int]interface{}),
+	}
+
+	if b.err != nil {
+		return result, newOperationError("BulkWrite", b.document, nil, b.err)
+	}
+
+	if b.Len() == 0 {
+		return result, nil
+	}
+
+	models, err := b.Models(m.updateConfig(b.document))
+
+	if err != nil {
+		return result, newOperationError("BulkWrite", b.document, nil, err)
+	}
+
+	ctx, cancel := m.getContext()
+	defer cancel()
+
+	collection, err := m.GetCollection(b.document)
+
+	if err != nil {
+		return result, err
+	}
+
+	var firstErr error
+
+	offset := 0
+
+	for _, batch := range b.batches(models) {
+		res, err := collection.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(b.ordered))
+
+		result.add(offset, res)
+
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			var bulkErr mongo.BulkWriteException
+
+			if !errors.As(err, &bulkErr) {
+				break
+			}
+
+			for _, writeErr := range bulkErr.WriteErrors {
+				result.Errors = append(result.Errors, BulkWriteError{
+					Index:   offset + writeErr.Index,
+					Code:    writeErr.Code,
+					Message: writeErr.Message,
+				})
+			}
+
+			if b.ordered {
+				break
+			}
+		}
+
+		offset += len(batch)
+	}
+
+	return result, newOperationError("BulkWrite", b.document, nil, firstErr)
+}
+
+// ReplaceMany replaces docs, which must belong to the same collection, by
+// their ID through a single BulkWrite, stamping updatedAt as Replace does.
+// ErrNotFound is returned along with the result when some of them do not
+// exist; the others are still replaced.
+func (m *mongoClient) ReplaceMany(docs []Document) (*BulkWriteResult, error) {
+	if len(docs) == 0 {
+		return &BulkWriteResult{UpsertedIDs: make(map[int]interface{})}, nil
+	}
+
+	if err := sameCollection(docs[0], docs); err != nil {
+		return nil, newOperationError("ReplaceMany", docs[0], nil, err)
+	}
+
+	result, err := m.BulkWrite(NewBulkWrite(docs[0]).Replace(docs...))
+
+	if err == nil && result.MatchedCount < int64(len(docs)) {
+		err = newOperationError("ReplaceMany", docs[0], nil, ErrNotFound)
+	}
+
+	return result, err
+}
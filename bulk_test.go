@@ -0,0 +1,126 @@
+package mongo
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+func TestBulkWriteBuilderModels(t *testing.T) {
+	inserted := &Foo{Action: "insert"}
+	replaced := &Foo{BasicDocument: BasicDocument{ID: "replaced"}, Action: "replace"}
+	deleted := &Foo{BasicDocument: BasicDocument{ID: "deleted"}}
+
+	b := NewBulkWrite(&Foo{}).
+		Insert(inserted).
+		Replace(replaced).
+		UpdateWhere(bson.M{"action": "a"}, bson.M{"action": "b"}).
+		UpdateMany(bson.M{"action": "c"}, bson.M{"action": "d"}).
+		Delete(deleted).
+		DeleteMany(bson.M{"action": "e"})
+
+	assert.Equal(t, 6, b.Len())
+	assert.True(t, b.ordered)
+
+	assert.NotEmpty(t, inserted.GetID())
+	assert.False(t, inserted.CreatedAt.IsZero())
+	assert.False(t, inserted.UpdatedAt.IsZero())
+	assert.False(t, replaced.UpdatedAt.IsZero())
+
+	models, err := b.Models()
+	assert.Nil(t, err)
+
+	assert.IsType(t, &mongo.InsertOneModel{}, models[0])
+	assert.IsType(t, &mongo.ReplaceOneModel{}, models[1])
+	assert.IsType(t, &mongo.UpdateOneModel{}, models[2])
+	assert.IsType(t, &mongo.UpdateManyModel{}, models[3])
+	assert.IsType(t, &mongo.DeleteOneModel{}, models[4])
+	assert.IsType(t, &mongo.DeleteManyModel{}, models[5])
+
+	assert.Equal(t, bson.M{"_id": "replaced"}, models[1].(*mongo.ReplaceOneModel).Filter)
+	assert.Equal(t, bson.M{"_id": "deleted"}, models[4].(*mongo.DeleteOneModel).Filter)
+}
+
+func TestBulkWriteBuilderUpdatesUseClientConfig(t *testing.T) {
+	b := NewBulkWrite(&namedOrder{}).
+		UpdateWhere(bson.M{"_id": "o-1"}, bson.M{"displayName": "Jane", "tagged": nil}).
+		UpdateMany(bson.M{}, NewUpdate().SetElements("lines", bson.M{"unitPrice": 3}, namedLine{UnitPrice: 4}))
+
+	models, err := b.Models(UpdateConfig{Naming: SnakeCaseNaming, Nulls: NullUnset, Document: &namedOrder{}})
+	assert.Nil(t, err)
+
+	update := models[0].(*mongo.UpdateOneModel).Update.(bson.D)
+	assert.Equal(t, "Jane", update[0].Value.(map[string]interface{})["display_name"])
+	assert.Equal(t, bson.E{Key: "$unset", Value: bson.D{{Key: "tag_name", Value: ""}}}, update[1])
+
+	many := models[1].(*mongo.UpdateManyModel)
+	assert.Equal(t, bson.E{Key: "lines.$[elem0].sku", Value: ""}, many.Update.(bson.D)[0].Value.(bson.D)[0])
+	assert.Equal(t, bson.E{Key: "lines.$[elem0].unit_price", Value: 4}, many.Update.(bson.D)[0].Value.(bson.D)[1])
+	assert.Equal(t, []interface{}{bson.M{"elem0.unit_price": 3}}, many.ArrayFilters.Filters)
+}
+
+func TestBulkWriteBuilderBatches(t *testing.T) {
+	b := NewBulkWrite(&Foo{}).Ordered(false).BatchSize(2)
+
+	for i := 0; i < 5; i++ {
+		b.DeleteMany(bson.M{"index": i})
+	}
+
+	models, err := b.Models()
+	assert.Nil(t, err)
+
+	batches := b.batches(models)
+
+	assert.False(t, b.ordered)
+	assert.Len(t, batches, 3)
+	assert.Len(t, batches[0], 2)
+	assert.Len(t, batches[1], 2)
+	assert.Len(t, batches[2], 1)
+}
+
+func TestBulkWriteResultOffsets(t *testing.T) {
+	result := &BulkWriteResult{UpsertedIDs: make(map[int]interface{})}
+
+	result.add(0, &mongo.BulkWriteResult{InsertedCount: 2, UpsertedCount: 1, UpsertedIDs: map[int64]interface{}{1: "a"}})
+	result.add(1000, &mongo.BulkWriteResult{DeletedCount: 3, UpsertedCount: 1, UpsertedIDs: map[int64]interface{}{4: "b"}})
+	result.add(2000, nil)
+
+	assert.Equal(t, int64(2), result.InsertedCount)
+	assert.Equal(t, int64(3), result.DeletedCount)
+	assert.Equal(t, int64(2), result.UpsertedCount)
+	assert.Equal(t, map[int]interface{}{1: "a", 1004: "b"}, result.UpsertedIDs)
+}
+
+func TestPersistManyMixedCollections(t *testing.T) {
+	c := &mongoClient{conn: &connection{}, database: "test_db"}
+
+	err := c.PersistMany([]Document{&Foo{}, &dummyDateObj{}})
+
+	var opErr *OperationError
+	assert.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "PersistMany", opErr.Op)
+	assert.False(t, errors.Is(err, ErrNotConnected))
+
+	assert.Nil(t, c.PersistMany(nil))
+}
+
+func TestBulkWriteBuilderMixedCollections(t *testing.T) {
+	b := NewBulkWrite(&Foo{}).Insert(&Foo{}, &dummyDateObj{}).Delete(&Foo{})
+
+	assert.NotNil(t, b.Err())
+	assert.Equal(t, 1, b.Len())
+
+	c := &mongoClient{conn: &connection{}, database: "test_db"}
+
+	_, err := c.ReplaceMany([]Document{&Foo{}, &dummyDateObj{}})
+
+	var opErr *OperationError
+	assert.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "ReplaceMany", opErr.Op)
+
+	_, err = c.BulkWrite(b)
+	assert.True(t, errors.As(err, &opErr))
+	assert.False(t, errors.Is(err, ErrNotConnected))
+}
@@ -2,20 +2,16 @@ package mongo
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"sync"
 	"time"
 )
 
-var (
-	client *mongo.Client
-)
-
 type ResultCursor struct {
 	*mongo.Cursor
 }
@@ -28,97 +24,196 @@ type Client interface {
 	Disconnect() error
 	HealthCheck() error
 	WithContext(ctx context.Context) Client
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
 	Persist(d Document) error
+	PersistMany(docs []Document) error
+	BulkWrite(b *BulkWriteBuilder) (*BulkWriteResult, error)
 	GetCollectionByName(name string) (*mongo.Collection, error)
 	GetCollection(d Document) (*mongo.Collection, error)
 	Aggregate(d Document, pipeline bson.A, decoder ResultDecoder, aggregateOptions ...*options.AggregateOptions) error
+	AggregateStream(d Document, pipeline bson.A, aggregateOptions ...*options.AggregateOptions) (Stream, error)
 	FindAll(d Document, filters bson.M, decoder ResultDecoder, findOptions ...*FindOptions) error
+	FindStream(d Document, filters bson.M, findOptions ...*FindOptions) (Stream, error)
+	FindPage(d Document, filters bson.M, decoder ResultDecoder, findOptions ...*FindOptions) (*PageInfo, error)
 	FindOne(d Document, filters bson.M, findOptions ...*FindOptions) error
 	FindOneById(d Document, id string) error
-	ReplaceOrPersist(d Document) error
+	Count(d Document, filter bson.M) (int64, error)
+	EstimatedCount(d Document) (int64, error)
+	Exists(d Document, filter bson.M) (bool, error)
+	Distinct(d Document, field string, filter bson.M) ([]interface{}, error)
+	ReplaceOrPersist(d Document) (bool, error)
 	Replace(d Document) error
+	ReplaceMany(docs []Document) (*BulkWriteResult, error)
 	Delete(d Document) error
 	DeleteWhere(d Document, key, value string) error
 	DeleteMany(d Document, filter bson.M) (int64, error)
-	Update(d Document, id string, input interface{}) error
-	UpdateWhere(d Document, filter bson.M, input interface{}) error
-	UpdateMany(d Document, filter bson.M, input interface{}) error
+	Update(d Document, id string, input interface{}) (*UpdateResult, error)
+	UpdateWhere(d Document, filter bson.M, input interface{}) (*UpdateResult, error)
+	UpdateMany(d Document, filter bson.M, input interface{}) (*UpdateResult, error)
+	ApplyMergePatch(d Document, id string, patch []byte) (*UpdateResult, error)
+	ApplyJSONPatch(d Document, id string, ops []PatchOperation) (*UpdateResult, error)
+	FindOneAndUpdate(d Document, filter bson.M, input interface{}, returnAfter bool, opts ...*FindAndModifyOptions) error
+	FindOneAndDelete(d Document, filter bson.M, opts ...*FindAndModifyOptions) error
+	EnsureIndexes(opts *EnsureIndexesOptions, docs ...Document) (*IndexReport, error)
 	GenerateUUID() uuid.UUID
 	GetURI() string
 	GetClient() (*mongo.Client, error)
 }
 
 type mongoClient struct {
-	database string
-	uri      string
-	ctx      *context.Context
+	conn          *connection
+	database      string
+	uri           string
+	ctx           context.Context
+	strictUpdates bool
+	naming        *NamingStrategy
+	nulls         NullPolicy
+}
+
+// connection holds the driver client shared by a client and the copies
+// returned by WithContext, so that connecting or disconnecting any of them
+// applies to all.
+type connection struct {
+	mu     sync.RWMutex
+	client *mongo.Client
+}
+
+func (c *connection) get() *mongo.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.client
 }
 
 func (m *mongoClient) GetClient() (*mongo.Client, error) {
+	client := m.conn.get()
+
 	if client == nil {
-		return nil, errors.New("MongoDB client was not initialized")
+		return nil, newOperationError("GetClient", nil, nil, ErrNotConnected)
 	}
 
 	return client, nil
 }
 
 func (m *mongoClient) getContext() (context.Context, context.CancelFunc) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	return ctx, cancel
+	if m.ctx != nil {
+		return context.WithCancel(m.ctx)
+	}
+
+	return context.WithTimeout(context.Background(), 10*time.Second)
 }
 
 func (m *mongoClient) Connect() error {
+	m.conn.mu.Lock()
+	defer m.conn.mu.Unlock()
+
+	if m.conn.client != nil {
+		return nil
+	}
+
 	ctx, cancel := m.getContext()
 	defer cancel()
 
-	c, err := mongo.Connect(ctx, options.Client().ApplyURI(m.uri))
+	clientOptions := options.Client().ApplyURI(m.uri)
+
+	if registry := m.naming.Registry(); registry != nil {
+		clientOptions.SetRegistry(registry)
+	}
+
+	c, err := mongo.Connect(ctx, clientOptions)
 
 	if err != nil {
-		return err
+		return newOperationError("Connect", nil, nil, err)
 	}
 
-	client = c
+	m.conn.client = c
 
 	return nil
 }
 
+// Disconnect closes the connection shared with the copies returned by
+// WithContext, whose operations then fail with ErrNotConnected.
 func (m *mongoClient) Disconnect() error {
+	m.conn.mu.Lock()
+	client := m.conn.client
+	m.conn.client = nil
+	m.conn.mu.Unlock()
+
 	if client == nil {
-		return errors.New("MongoDB client was not initialized")
+		return newOperationError("Disconnect", nil, nil, ErrNotConnected)
 	}
 
 	ctx, cancel := m.getContext()
 	defer cancel()
-	return client.Disconnect(ctx)
+
+	return newOperationError("Disconnect", nil, nil, client.Disconnect(ctx))
 }
 
 func (m *mongoClient) HealthCheck() error {
+	client := m.conn.get()
+
 	if client == nil {
-		return errors.New("MongoDB client was not initialized")
+		return newOperationError("HealthCheck", nil, nil, ErrNotConnected)
 	}
 
 	ctx, cancel := m.getContext()
 	defer cancel()
 
-	return client.Ping(ctx, readpref.Primary())
+	return newOperationError("HealthCheck", nil, nil, client.Ping(ctx, readpref.Primary()))
 }
 
+// WithContext returns a copy of the client whose operations run under ctx
+// instead of the default 10 seconds timeout. The receiver is left untouched,
+// so the returned value can be used concurrently with the original one; both
+// share the same connection.
 func (m *mongoClient) WithContext(ctx context.Context) Client {
-	m.ctx = &ctx
-	return m
+	scoped := *m
+	scoped.ctx = ctx
+	return &scoped
+}
+
+// WithTransaction runs fn inside a multi-document transaction. The context
+// handed to fn carries the session, so every call made through
+// WithContext(ctx) joins the transaction. The transaction is committed when fn
+// returns nil and aborted otherwise; it is retried on
+// TransientTransactionError and UnknownTransactionCommitResult labels.
+func (m *mongoClient) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	client := m.conn.get()
+
+	if client == nil {
+		return newOperationError("WithTransaction", nil, nil, ErrNotConnected)
+	}
+
+	session, err := client.StartSession()
+
+	if err != nil {
+		return newOperationError("WithTransaction", nil, nil, err)
+	}
+
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+
+	return newOperationError("WithTransaction", nil, nil, err)
 }
 
 func (m *mongoClient) GetCollectionByName(name string) (*mongo.Collection, error) {
+	client := m.conn.get()
+
 	if client == nil {
-		return nil, errors.New("MongoDB client was not initialized")
+		return nil, &OperationError{Op: "GetCollectionByName", Collection: name, Err: ErrNotConnected}
 	}
 
 	return client.Database(m.database).Collection(name), nil
 }
 
 func (m *mongoClient) GetCollection(d Document) (*mongo.Collection, error) {
+	client := m.conn.get()
+
 	if client == nil {
-		return nil, errors.New("MongoDB client was not initialized")
+		return nil, newOperationError("GetCollection", d, nil, ErrNotConnected)
 	}
 
 	return client.Database(m.database).Collection(d.DocumentName()), nil
@@ -126,11 +221,7 @@ func (m *mongoClient) GetCollection(d Document) (*mongo.Collection, error) {
 
 func (m *mongoClient) Aggregate(d Document, pipeline bson.A, decoder ResultDecoder, opts ...*options.AggregateOptions) error {
 	ctx, cancel := m.getContext()
-
-	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
-	}
+	defer cancel()
 
 	collection, err := m.GetCollection(d)
 
@@ -141,21 +232,7 @@ func (m *mongoClient) Aggregate(d Document, pipeline bson.A, decoder ResultDecod
 	ag, err := collection.Aggregate(ctx, pipeline, opts...)
 
 	if err != nil {
-		if m.ctx != nil {
-			m.ctx = nil
-		} else {
-			cancel()
-		}
-		return err
-	}
-
-	if err = ag.Err(); err != nil {
-		if m.ctx != nil {
-			m.ctx = nil
-		} else {
-			cancel()
-		}
-		return err
+		return newOperationError("Aggregate", d, pipeline, err)
 	}
 
 	defer ag.Close(ctx)
@@ -164,83 +241,52 @@ func (m *mongoClient) Aggregate(d Document, pipeline bson.A, decoder ResultDecod
 		err = decoder(ResultCursor{Cursor: ag})
 
 		if err != nil {
-			if m.ctx != nil {
-				m.ctx = nil
-			} else {
-				cancel()
-			}
-			return err
+			return newOperationError("Aggregate", d, pipeline, err)
 		}
 	}
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
-	}
-	return nil
+	return newOperationError("Aggregate", d, pipeline, ag.Err())
 }
 
-func (m *mongoClient) FindAll(d Document, filters bson.M, decoder ResultDecoder, findOptions ...*FindOptions) error {
+func (m *mongoClient) AggregateStream(d Document, pipeline bson.A, opts ...*options.AggregateOptions) (Stream, error) {
 	ctx, cancel := m.getContext()
+	defer cancel()
 
-	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
+	collection, err := m.GetCollection(d)
+
+	if err != nil {
+		return nil, err
 	}
 
-	collection, err := m.GetCollection(d)
+	ag, err := collection.Aggregate(ctx, pipeline, opts...)
 
 	if err != nil {
-		return err
+		return nil, newOperationError("AggregateStream", d, pipeline, err)
 	}
 
-	mongoOptions := options.FindOptions{}
+	return ag, nil
+}
 
-	if findOptions != nil && findOptions[0] != nil {
-		findOption := findOptions[0]
+func (m *mongoClient) FindAll(d Document, filters bson.M, decoder ResultDecoder, findOptions ...*FindOptions) error {
+	ctx, cancel := m.getContext()
+	defer cancel()
 
-		if findOption.Sort != nil {
-			bsonSort := bson.M{}
-			for _, sort := range findOption.Sort {
-				bsonSort[sort.SortField] = sort.Order
-			}
-			mongoOptions.Sort = bsonSort
-		}
+	collection, err := m.GetCollection(d)
 
-		if findOption.Pagination != nil {
-			mongoOptions.Limit = findOption.Pagination.Limit
-
-			if findOption.Pagination.LastID != "" {
-				if filters == nil {
-					filters = bson.M{
-						"_id": bson.M{"$gt": &findOption.Pagination.LastID},
-					}
-				} else {
-					filters["_id"] = bson.M{"$gt": &findOption.Pagination.LastID}
-				}
-			}
-		}
+	if err != nil {
+		return err
 	}
 
-	find, err := collection.Find(ctx, filters, &mongoOptions)
+	filters, mongoOptions, err := findQuery(filters, m.namedOptions(d, findOptions))
 
 	if err != nil {
-		if m.ctx != nil {
-			m.ctx = nil
-		} else {
-			cancel()
-		}
-		return err
+		return newOperationError("FindAll", d, filters, err)
 	}
 
-	if err = find.Err(); err != nil {
-		if m.ctx != nil {
-			m.ctx = nil
-		} else {
-			cancel()
-		}
-		return err
+	find, err := collection.Find(ctx, filters, mongoOptions)
+
+	if err != nil {
+		return newOperationError("FindAll", d, filters, err)
 	}
 
 	defer find.Close(ctx)
@@ -249,162 +295,331 @@ func (m *mongoClient) FindAll(d Document, filters bson.M, decoder ResultDecoder,
 		err = decoder(ResultCursor{Cursor: find})
 
 		if err != nil {
-			if m.ctx != nil {
-				m.ctx = nil
-			} else {
-				cancel()
-			}
-			return err
+			return newOperationError("FindAll", d, filters, err)
 		}
 	}
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
+	return newOperationError("FindAll", d, filters, find.Err())
+}
+
+func (m *mongoClient) FindStream(d Document, filters bson.M, findOptions ...*FindOptions) (Stream, error) {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
+	collection, err := m.GetCollection(d)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	filters, mongoOptions, err := findQuery(filters, m.namedOptions(d, findOptions))
+
+	if err != nil {
+		return nil, newOperationError("FindStream", d, filters, err)
+	}
 
+	find, err := collection.Find(ctx, filters, mongoOptions)
+
+	if err != nil {
+		return nil, newOperationError("FindStream", d, filters, err)
+	}
+
+	return find, nil
 }
 
-func (m *mongoClient) FindOne(d Document, filters bson.M, findOptions ...*FindOptions) error {
-	ctx, cancel := m.getContext()
+// FindPage reads a page of the documents matching filters, with keyset
+// pagination or by offset, see PageQuery. Pagination.Limit must be set.
+func (m *mongoClient) FindPage(d Document, filters bson.M, decoder ResultDecoder, findOptions ...*FindOptions) (*PageInfo, error) {
+	query, err := NewPageQuery(filters, m.namedOptions(d, findOptions)...)
 
-	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
+	if err != nil {
+		return nil, newOperationError("FindPage", d, filters, err)
 	}
 
+	ctx, cancel := m.getContext()
+	defer cancel()
+
 	collection, err := m.GetCollection(d)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if collection == nil {
-		return errors.New(fmt.Sprintf("No collection found for document named %s", d.DocumentName()))
-	}
+	query.Registry = m.naming.Registry()
 
-	mongoOptions := options.FindOneOptions{}
+	if query.Pipeline != nil {
+		ag, err := collection.Aggregate(ctx, query.Pipeline, options.Aggregate().SetCollation(query.Options.Collation))
 
-	if findOptions != nil && findOptions[0] != nil {
-		findOption := findOptions[0]
+		if err != nil {
+			return nil, newOperationError("FindPage", d, filters, err)
+		}
 
-		if findOption.Sort != nil {
-			bsonSort := bson.M{}
-			for _, sort := range findOption.Sort {
-				bsonSort[sort.SortField] = sort.Order
-			}
-			mongoOptions.Sort = bsonSort
+		defer ag.Close(ctx)
+
+		var facet bson.Raw
+
+		if ag.Next(ctx) {
+			facet = ag.Current
+		}
+
+		if err := ag.Err(); err != nil {
+			return nil, newOperationError("FindPage", d, filters, err)
 		}
+
+		info, err := query.FacetPage(facet, decoder)
+
+		if err != nil {
+			return nil, newOperationError("FindPage", d, filters, err)
+		}
+
+		return info, nil
 	}
 
-	doc := collection.FindOne(ctx, filters, &mongoOptions)
+	filter, mongoOptions, err := findQuery(query.Filter, []*FindOptions{query.Options})
 
-	if doc.Err() != nil {
-		return doc.Err()
+	if err != nil {
+		return nil, newOperationError("FindPage", d, filter, err)
 	}
 
-	err = doc.Decode(d)
+	find, err := collection.Find(ctx, filter, mongoOptions)
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
+	if err != nil {
+		return nil, newOperationError("FindPage", d, filter, err)
+	}
+
+	defer find.Close(ctx)
+
+	var rows []bson.Raw
+
+	for find.Next(ctx) {
+		rows = append(rows, append(bson.Raw(nil), find.Current...))
 	}
 
+	if err := find.Err(); err != nil {
+		return nil, newOperationError("FindPage", d, filter, err)
+	}
+
+	info, err := query.Page(rows, decoder)
+
+	if err != nil {
+		return nil, newOperationError("FindPage", d, filter, err)
+	}
+
+	return info, nil
+}
+
+func (m *mongoClient) FindOne(d Document, filters bson.M, findOptions ...*FindOptions) error {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
+	collection, err := m.GetCollection(d)
+
 	if err != nil {
 		return err
 	}
 
-	return nil
+	mongoOptions := options.FindOneOptions{}
+
+	if findOptions != nil && findOptions[0] != nil {
+		findOption := findOptions[0].Named(m.naming, d)
+
+		if sort := findOption.SortDocument(); sort != nil {
+			mongoOptions.Sort = sort
+		}
+
+		mongoOptions.Collation = findOption.Collation
+
+		if projection := findOption.ProjectionDocument(); projection != nil {
+			mongoOptions.Projection = projection
+		}
+
+		skip, err := findOption.Pagination.Offset()
+
+		if err != nil {
+			return newOperationError("FindOne", d, filters, err)
+		}
+
+		if skip > 0 {
+			mongoOptions.SetSkip(skip)
+		}
+	}
+
+	err = collection.FindOne(ctx, filters, &mongoOptions).Decode(d)
+
+	return newOperationError("FindOne", d, filters, err)
 }
 
 func (m *mongoClient) FindOneById(d Document, id string) error {
 	return m.FindOne(d, bson.M{"_id": id})
 }
 
-func (m *mongoClient) Persist(d Document) error {
-	if d.GetID() == "" {
-		d.SetID(m.GenerateUUID())
+func (m *mongoClient) Count(d Document, filter bson.M) (int64, error) {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
+	collection, err := m.GetCollection(d)
+
+	if err != nil {
+		return 0, err
 	}
-	d.SetCreatedAt()
-	d.SetUpdatedAt()
 
-	ctx, cancel := m.getContext()
+	count, err := collection.CountDocuments(ctx, filter)
 
-	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
+	if err != nil {
+		return 0, newOperationError("Count", d, filter, err)
 	}
 
+	return count, nil
+}
+
+// EstimatedCount returns the number of documents of the collection from its
+// metadata, without scanning it.
+func (m *mongoClient) EstimatedCount(d Document) (int64, error) {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
 	collection, err := m.GetCollection(d)
 
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	if collection == nil {
-		return errors.New(fmt.Sprintf("No collection found for document named %s", d.DocumentName()))
+	count, err := collection.EstimatedDocumentCount(ctx)
+
+	if err != nil {
+		return 0, newOperationError("EstimatedCount", d, nil, err)
 	}
 
-	_, err = collection.InsertOne(ctx, d)
+	return count, nil
+}
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
+func (m *mongoClient) Exists(d Document, filter bson.M) (bool, error) {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
+	collection, err := m.GetCollection(d)
+
+	if err != nil {
+		return false, err
+	}
+
+	count, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+
+	if err != nil {
+		return false, newOperationError("Exists", d, filter, err)
 	}
 
-	return err
+	return count > 0, nil
 }
 
-func (m *mongoClient) ReplaceOrPersist(d Document) error {
+func (m *mongoClient) Distinct(d Document, field string, filter bson.M) ([]interface{}, error) {
 	ctx, cancel := m.getContext()
+	defer cancel()
 
-	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
+	collection, err := m.GetCollection(d)
+
+	if err != nil {
+		return nil, err
 	}
 
+	values, err := collection.Distinct(ctx, field, filter)
+
+	if err != nil {
+		return nil, newOperationError("Distinct", d, filter, err)
+	}
+
+	return values, nil
+}
+
+func (m *mongoClient) Persist(d Document) error {
+	prepareInsert(d)
+
+	ctx, cancel := m.getContext()
+	defer cancel()
+
 	collection, err := m.GetCollection(d)
 
 	if err != nil {
 		return err
 	}
 
-	if collection == nil {
-		return errors.New(fmt.Sprintf("No collection found for document named %s", d.DocumentName()))
+	_, err = collection.InsertOne(ctx, d)
+
+	return newOperationError("Persist", d, nil, err)
+}
+
+func (m *mongoClient) PersistMany(docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	d := docs[0]
+
+	if err := sameCollection(d, docs); err != nil {
+		return newOperationError("PersistMany", d, nil, err)
+	}
+
+	items := make([]interface{}, len(docs))
+
+	for i, doc := range docs {
+		prepareInsert(doc)
+		items[i] = doc
+	}
+
+	ctx, cancel := m.getContext()
+	defer cancel()
+
+	collection, err := m.GetCollection(d)
+
+	if err != nil {
+		return err
 	}
 
+	_, err = collection.InsertMany(ctx, items)
+
+	return newOperationError("PersistMany", d, nil, err)
+}
+
+// ReplaceOrPersist replaces the document sharing d's ID, or inserts d when no
+// such document exists, in a single atomic upsert. The createdAt of an
+// existing document is preserved. It reports whether d was inserted.
+// The upsert relies on pipeline updates, available since MongoDB 4.2.
+func (m *mongoClient) ReplaceOrPersist(d Document) (bool, error) {
+	if d.GetID() == "" {
+		d.SetID(m.GenerateUUID())
+	}
 	d.SetCreatedAt()
 	d.SetUpdatedAt()
 
+	ctx, cancel := m.getContext()
+	defer cancel()
+
+	collection, err := m.GetCollection(d)
+
+	if err != nil {
+		return false, err
+	}
+
 	filter := bson.M{"_id": d.GetID()}
 
-	err = collection.FindOneAndReplace(ctx, filter, d).Err()
+	pipeline, err := upsertPipeline(d, m.naming.Registry())
 
 	if err != nil {
-		return m.Persist(d)
+		return false, newOperationError("ReplaceOrPersist", d, filter, err)
 	}
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
+	res, err := collection.UpdateOne(ctx, filter, pipeline, options.Update().SetUpsert(true))
+
+	if err != nil {
+		return false, newOperationError("ReplaceOrPersist", d, filter, err)
 	}
 
-	return nil
+	return res.UpsertedCount > 0, nil
 }
 
 func (m *mongoClient) Replace(d Document) error {
 	ctx, cancel := m.getContext()
-
-	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
-	}
+	defer cancel()
 
 	collection, err := m.GetCollection(d)
 
@@ -412,32 +627,18 @@ func (m *mongoClient) Replace(d Document) error {
 		return err
 	}
 
-	if collection == nil {
-		return errors.New(fmt.Sprintf("No collection found for document named %s", d.DocumentName()))
-	}
-
 	d.SetUpdatedAt()
 
 	filter := bson.M{"_id": d.GetID()}
 
 	err = collection.FindOneAndReplace(ctx, filter, d).Err()
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
-	}
-
-	return err
+	return newOperationError("Replace", d, filter, err)
 }
 
 func (m *mongoClient) Delete(d Document) error {
 	ctx, cancel := m.getContext()
-
-	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
-	}
+	defer cancel()
 
 	collection, err := m.GetCollection(d)
 
@@ -445,206 +646,401 @@ func (m *mongoClient) Delete(d Document) error {
 		return err
 	}
 
-	if collection == nil {
-		return errors.New(fmt.Sprintf("No collection found for document named %s", d.DocumentName()))
-	}
-
 	filter := bson.M{"_id": d.GetID()}
 
 	dr, err := collection.DeleteOne(ctx, filter)
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
+	if err != nil {
+		return newOperationError("Delete", d, filter, err)
 	}
 
+	if dr.DeletedCount == 0 {
+		return newOperationError("Delete", d, filter, ErrNotFound)
+	}
+
+	return nil
+}
+
+func (m *mongoClient) DeleteWhere(d Document, key, value string) error {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
+	collection, err := m.GetCollection(d)
+
 	if err != nil {
 		return err
 	}
 
-	if dr.DeletedCount != 1 {
-		return errors.New(fmt.Sprintf("Deleted %q elements", dr.DeletedCount))
+	filter := bson.M{key: value}
+
+	dr, err := collection.DeleteOne(ctx, filter)
+
+	if err != nil {
+		return newOperationError("DeleteWhere", d, filter, err)
+	}
+
+	if dr.DeletedCount == 0 {
+		return newOperationError("DeleteWhere", d, filter, ErrNotFound)
 	}
 
 	return nil
 }
 
-func (m *mongoClient) DeleteWhere(d Document, key, value string) error {
+func (m *mongoClient) DeleteMany(d Document, filter bson.M) (int64, error) {
 	ctx, cancel := m.getContext()
+	defer cancel()
 
-	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
+	collection, err := m.GetCollection(d)
+
+	if err != nil {
+		return 0, err
 	}
 
-	collection, err := m.GetCollection(d)
+	dr, err := collection.DeleteMany(ctx, filter)
 
 	if err != nil {
-		return err
+		return 0, newOperationError("DeleteMany", d, filter, err)
 	}
 
-	if collection == nil {
-		return errors.New(fmt.Sprintf("No collection found for document named %s", d.DocumentName()))
+	return dr.DeletedCount, nil
+}
+
+// Update applies input to the document whose _id is id. With
+// ClientConfig.StrictUpdates, ErrNotFound is returned along with the result
+// when no document has this id.
+func (m *mongoClient) Update(d Document, id string, input interface{}) (*UpdateResult, error) {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
+	collection, err := m.GetCollection(d)
+
+	if err != nil {
+		return nil, err
 	}
 
-	filter := bson.M{key: value}
+	filter := bson.M{"_id": id}
 
-	dr, err := collection.DeleteOne(ctx, filter)
+	update, arrayFilters, err := updateDocument(input, m.updateConfig(d))
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
+	if err != nil {
+		return nil, newOperationError("Update", d, filter, err)
 	}
 
+	res, err := collection.UpdateOne(ctx, filter, update, updateOptions(arrayFilters))
+
 	if err != nil {
-		return err
+		return nil, newOperationError("Update", d, filter, err)
 	}
 
-	if dr.DeletedCount != 1 {
-		return errors.New(fmt.Sprintf("Deleted %q elements", dr.DeletedCount))
+	result := newUpdateResult(res)
+
+	if m.strictUpdates && result.MatchedCount == 0 {
+		return result, newOperationError("Update", d, filter, ErrNotFound)
 	}
 
-	return nil
+	return result, nil
 }
 
-func (m *mongoClient) DeleteMany(d Document, filter bson.M) (int64, error) {
+func (m *mongoClient) UpdateMany(d Document, filter bson.M, input interface{}) (*UpdateResult, error) {
 	ctx, cancel := m.getContext()
+	defer cancel()
 
-	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
+	collection, err := m.GetCollection(d)
+
+	if err != nil {
+		return nil, err
+	}
+
+	update, arrayFilters, err := updateDocument(input, m.updateConfig(d))
+
+	if err != nil {
+		return nil, newOperationError("UpdateMany", d, filter, err)
 	}
 
+	res, err := collection.UpdateMany(ctx, filter, update, updateOptions(arrayFilters))
+
+	if err != nil {
+		return nil, newOperationError("UpdateMany", d, filter, err)
+	}
+
+	return newUpdateResult(res), nil
+}
+
+func (m *mongoClient) UpdateWhere(d Document, filter bson.M, input interface{}) (*UpdateResult, error) {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
 	collection, err := m.GetCollection(d)
 
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	if collection == nil {
-		return 0, errors.New(fmt.Sprintf("No collection found for document named %s", d.DocumentName()))
+	update, arrayFilters, err := updateDocument(input, m.updateConfig(d))
+
+	if err != nil {
+		return nil, newOperationError("UpdateWhere", d, filter, err)
 	}
 
-	dr, err := collection.DeleteMany(ctx, filter)
+	res, err := collection.UpdateOne(ctx, filter, update, updateOptions(arrayFilters))
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
+	if err != nil {
+		return nil, newOperationError("UpdateWhere", d, filter, err)
 	}
 
+	return newUpdateResult(res), nil
+}
+
+// ApplyMergePatch applies the JSON merge patch to the document whose _id is
+// id, see NewMergePatch. Unlike Update, ErrNotFound is returned whenever no
+// document has this id.
+func (m *mongoClient) ApplyMergePatch(d Document, id string, patch []byte) (*UpdateResult, error) {
+	p, err := NewMergePatch(d, patch, m.naming)
+
 	if err != nil {
-		return 0, err
+		return nil, newOperationError("ApplyMergePatch", d, bson.M{"_id": id}, err)
 	}
 
-	return dr.DeletedCount, nil
+	return p.Apply(m.baseContext(), m, d, id)
 }
 
-func (m *mongoClient) Update(d Document, id string, input interface{}) error {
-	ctx, cancel := m.getContext()
+// ApplyJSONPatch applies the operations of a JSON Patch to the document whose
+// _id is id, see NewJSONPatch. Patches needing several updates run in a
+// transaction, so that they are applied entirely or not at all.
+func (m *mongoClient) ApplyJSONPatch(d Document, id string, ops []PatchOperation) (*UpdateResult, error) {
+	p, err := NewJSONPatch(d, ops, m.naming)
+
+	if err != nil {
+		return nil, newOperationError("ApplyJSONPatch", d, bson.M{"_id": id}, err)
+	}
+
+	return p.Apply(m.baseContext(), m, d, id)
+}
 
+// baseContext returns the context of the client, without the default timeout
+// of getContext, for operations which may run long.
+func (m *mongoClient) baseContext() context.Context {
 	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
+		return m.ctx
 	}
 
+	return context.Background()
+}
+
+func prepareInsert(d Document) {
+	if d.GetID() == "" {
+		d.SetID(uuid.New())
+	}
+	d.SetCreatedAt()
+	d.SetUpdatedAt()
+}
+
+// FindOneAndUpdate atomically updates the first document matching filter with
+// input, as Update does, and decodes it into d as it was before the update, or
+// after it when returnAfter is set. When Upsert inserts a new document and
+// returnAfter is not set, ErrNotFound is returned as there is no previous
+// state to decode.
+func (m *mongoClient) FindOneAndUpdate(d Document, filter bson.M, input interface{}, returnAfter bool, opts ...*FindAndModifyOptions) error {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
 	collection, err := m.GetCollection(d)
 
 	if err != nil {
 		return err
 	}
 
-	if collection == nil {
-		return errors.New(fmt.Sprintf("No collection found for document named %s", d.DocumentName()))
+	var findAndModify *FindAndModifyOptions
+
+	if len(opts) > 0 {
+		findAndModify = opts[0]
 	}
 
-	filter := bson.M{"_id": id}
+	findOptions := findAndModify.findOptions().Named(m.naming, d)
+	update, arrayFilters, err := updateDocument(input, m.updateConfig(d))
 
-	updates := FlattenedMapFromInterface(input)
-	updates["updatedAt"] = time.Now()
+	if err != nil {
+		return newOperationError("FindOneAndUpdate", d, filter, err)
+	}
 
-	_, err = collection.UpdateOne(ctx, filter, bson.D{
-		{Key: "$set", Value: updates},
-	})
+	mongoOptions := options.FindOneAndUpdate()
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
+	if returnAfter {
+		mongoOptions.SetReturnDocument(options.After)
 	}
 
-	return err
-}
+	if filters := arrayFiltersOption(arrayFilters); filters != nil {
+		mongoOptions.SetArrayFilters(*filters)
+	}
 
-func (m *mongoClient) UpdateMany(d Document, filter bson.M, input interface{}) error {
-	ctx, cancel := m.getContext()
+	if sort := findOptions.SortDocument(); sort != nil {
+		mongoOptions.SetSort(sort)
+	}
 
-	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
+	if projection := findOptions.ProjectionDocument(); projection != nil {
+		mongoOptions.SetProjection(projection)
+	}
+
+	if findAndModify != nil && findAndModify.Upsert {
+		document, ok := update.(bson.D)
+
+		if !ok {
+			return newOperationError("FindOneAndUpdate", d, filter, errPipelineUpsert)
+		}
+
+		mongoOptions.SetUpsert(true)
+		update = UpsertDocument(document, filter)
 	}
 
+	err = collection.FindOneAndUpdate(ctx, filter, update, mongoOptions).Decode(d)
+
+	return newOperationError("FindOneAndUpdate", d, filter, err)
+}
+
+// FindOneAndDelete atomically deletes the first document matching filter and
+// decodes it into d.
+func (m *mongoClient) FindOneAndDelete(d Document, filter bson.M, opts ...*FindAndModifyOptions) error {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
 	collection, err := m.GetCollection(d)
 
 	if err != nil {
 		return err
 	}
 
-	if collection == nil {
-		return errors.New(fmt.Sprintf("No collection found for document named %s", d.DocumentName()))
+	var findAndModify *FindAndModifyOptions
+
+	if len(opts) > 0 {
+		findAndModify = opts[0]
 	}
 
-	updates := FlattenedMapFromInterface(input)
+	findOptions := findAndModify.findOptions().Named(m.naming, d)
 
-	updates["updatedAt"] = time.Now()
+	mongoOptions := options.FindOneAndDelete()
 
-	_, err = collection.UpdateMany(ctx, filter, bson.D{
-		{Key: "$set", Value: updates},
-	})
+	if sort := findOptions.SortDocument(); sort != nil {
+		mongoOptions.SetSort(sort)
+	}
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
+	if projection := findOptions.ProjectionDocument(); projection != nil {
+		mongoOptions.SetProjection(projection)
 	}
 
-	return err
+	err = collection.FindOneAndDelete(ctx, filter, mongoOptions).Decode(d)
+
+	return newOperationError("FindOneAndDelete", d, filter, err)
 }
 
-func (m *mongoClient) UpdateWhere(d Document, filter bson.M, input interface{}) error {
-	ctx, cancel := m.getContext()
+func (m *mongoClient) updateConfig(d Document) UpdateConfig {
+	return UpdateConfig{Naming: m.naming, Nulls: m.nulls, Document: d}
+}
 
-	if m.ctx != nil {
-		ctx = *m.ctx
-		cancel()
+// namedOptions maps the fields of the find options onto the keys of d with
+// the naming strategy of the client.
+func (m *mongoClient) namedOptions(d Document, findOptions []*FindOptions) []*FindOptions {
+	if len(findOptions) == 0 {
+		return findOptions
 	}
 
-	collection, err := m.GetCollection(d)
+	return []*FindOptions{findOptions[0].Named(m.naming, d)}
+}
+
+// findQuery translates FindOptions into the filter and driver options of a
+// find command. filters is copied before being extended.
+func findQuery(filters bson.M, findOptions []*FindOptions) (bson.M, *options.FindOptions, error) {
+	mongoOptions := options.Find()
+
+	if len(findOptions) == 0 || findOptions[0] == nil {
+		return filters, mongoOptions, nil
+	}
+
+	findOption := findOptions[0]
+
+	if sort := findOption.SortDocument(); sort != nil {
+		mongoOptions.Sort = sort
+	}
+
+	mongoOptions.Collation = findOption.Collation
+
+	if projection := findOption.ProjectionDocument(); projection != nil {
+		mongoOptions.Projection = projection
+	}
+
+	if findOption.Pagination != nil {
+		skip, err := findOption.Pagination.Offset()
+
+		if err != nil {
+			return filters, nil, err
+		}
+
+		if skip > 0 {
+			mongoOptions.SetSkip(skip)
+		}
+
+		mongoOptions.Limit = findOption.Pagination.Limit
+
+		if findOption.Pagination.LastID != "" {
+			query := bson.M{}
+
+			for k, v := range filters {
+				query[k] = v
+			}
+
+			query["_id"] = bson.M{"$gt": findOption.Pagination.LastID}
+			filters = query
+		}
+	}
+
+	return filters, mongoOptions, nil
+}
+
+// upsertPipeline builds a pipeline update replacing the whole document with d,
+// except for createdAt which keeps its stored value and is only taken from d
+// when the document is inserted, mimicking $setOnInsert. d is encoded with
+// registry, the driver default when nil.
+func upsertPipeline(d Document, registry *bsoncodec.Registry) (mongo.Pipeline, error) {
+	if registry == nil {
+		registry = bson.DefaultRegistry
+	}
+
+	raw, err := bson.MarshalWithRegistry(registry, d)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if collection == nil {
-		return errors.New(fmt.Sprintf("No collection found for document named %s", d.DocumentName()))
+	var replacement bson.D
+
+	err = bson.Unmarshal(raw, &replacement)
+
+	if err != nil {
+		return nil, err
 	}
 
-	updates := FlattenedMapFromInterface(input)
-	updates["updatedAt"] = time.Now()
+	var createdAt interface{}
 
-	_, err = collection.UpdateOne(ctx, filter, bson.D{
-		{Key: "$set", Value: updates},
-	})
+	fields := replacement[:0]
 
-	if m.ctx != nil {
-		m.ctx = nil
-	} else {
-		cancel()
+	for _, e := range replacement {
+		if e.Key == "createdAt" {
+			createdAt = e.Value
+			continue
+		}
+		fields = append(fields, e)
+	}
+
+	merged := bson.A{bson.M{"$literal": fields}}
+
+	if createdAt != nil {
+		merged = append(merged, bson.M{
+			"createdAt": bson.M{"$ifNull": bson.A{"$createdAt", bson.M{"$literal": createdAt}}},
+		})
 	}
 
-	return err
+	return mongo.Pipeline{
+		{{Key: "$replaceWith", Value: bson.M{"$mergeObjects": merged}}},
+	}, nil
 }
 
 func (m *mongoClient) GenerateUUID() uuid.UUID {
@@ -657,7 +1053,11 @@ func (m *mongoClient) GetURI() string {
 
 func NewClient(config ClientConfig) (Client, error) {
 	newClient := &mongoClient{
-		database: config.Database,
+		conn:          &connection{},
+		database:      config.Database,
+		strictUpdates: config.StrictUpdates,
+		naming:        config.NamingStrategy,
+		nulls:         config.NullPolicy,
 	}
 
 	uri, err := config.generateURI()
@@ -1,7 +1,11 @@
 package mongo
 
 import (
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"os"
 	"testing"
 )
@@ -97,9 +101,10 @@ func TestReplaceOrPersistReplace(t *testing.T) {
 		},
 	}
 
-	err := testClient.ReplaceOrPersist(&foo)
+	inserted, err := testClient.ReplaceOrPersist(&foo)
 
 	assert.Nil(t, err)
+	assert.False(t, inserted)
 }
 
 func TestReplaceOrPersistPersist(t *testing.T) {
@@ -109,11 +114,12 @@ func TestReplaceOrPersistPersist(t *testing.T) {
 		Action: "Bar Persisted",
 	}
 
-	err := testClient.ReplaceOrPersist(&foo)
+	inserted, err := testClient.ReplaceOrPersist(&foo)
 
 	os.Setenv("TEST_UUID_2", foo.GetID())
 
 	assert.Nil(t, err)
+	assert.True(t, inserted)
 }
 
 func TestFindOneByIDNewlyPersisted(t *testing.T) {
@@ -158,7 +164,202 @@ func TestUpdate(t *testing.T) {
 
 	foo.Action = "Updated testing the test of the testers"
 
-	err := testClient.Update(&foo, existingUUID, foo)
+	_, err := testClient.Update(&foo, existingUUID, foo)
 
 	assert.Nil(t, err)
 }
+
+func TestIndependentClients(t *testing.T) {
+	first, err := dummyConnect()
+	assert.Nil(t, err)
+
+	second, err := NewClient(ClientConfig{
+		Host:     "localhost",
+		Port:     27017,
+		Database: "other_test_db",
+	})
+	assert.Nil(t, err)
+
+	firstDriver, err := first.GetClient()
+	assert.Nil(t, err)
+
+	secondDriver, err := second.GetClient()
+	assert.Nil(t, err)
+
+	assert.NotSame(t, firstDriver, secondDriver)
+
+	assert.Nil(t, first.Disconnect())
+
+	_, err = first.GetClient()
+	assert.NotNil(t, err)
+
+	_, err = second.GetClient()
+	assert.Nil(t, err)
+
+	assert.Nil(t, second.Disconnect())
+}
+
+func TestWithContextDoesNotMutateClient(t *testing.T) {
+	base := &mongoClient{conn: &connection{}, database: "test_db"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scoped := base.WithContext(ctx)
+
+	assert.NotSame(t, base, scoped)
+	assert.Nil(t, base.ctx)
+
+	cancel()
+
+	scopedCtx, scopedCancel := scoped.(*mongoClient).getContext()
+	defer scopedCancel()
+
+	assert.Equal(t, context.Canceled, scopedCtx.Err())
+
+	defaultCtx, defaultCancel := base.getContext()
+	defer defaultCancel()
+
+	_, hasDeadline := defaultCtx.Deadline()
+	assert.True(t, hasDeadline)
+	assert.Nil(t, defaultCtx.Err())
+}
+
+func TestWithContextSharesConnection(t *testing.T) {
+	c, err := dummyConnect()
+	assert.Nil(t, err)
+
+	scoped := c.WithContext(context.Background())
+	assert.Nil(t, scoped.Disconnect())
+
+	_, err = c.GetCollection(&Foo{})
+	assert.True(t, errors.Is(err, ErrNotConnected))
+	assert.True(t, errors.Is(c.Disconnect(), ErrNotConnected))
+
+	assert.Nil(t, c.Connect())
+
+	client, err := scoped.GetClient()
+	assert.Nil(t, err)
+	assert.NotNil(t, client)
+	assert.Nil(t, scoped.Disconnect())
+}
+
+func TestWithTransactionNotInitialized(t *testing.T) {
+	c := &mongoClient{conn: &connection{}, database: "test_db"}
+
+	err := c.WithTransaction(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+
+	assert.NotNil(t, err)
+}
+
+func TestSessionPropagatesThroughWithContext(t *testing.T) {
+	c, err := dummyConnect()
+	assert.Nil(t, err)
+
+	defer c.Disconnect()
+
+	driver, err := c.GetClient()
+	assert.Nil(t, err)
+
+	session, err := driver.StartSession()
+	assert.Nil(t, err)
+
+	defer session.EndSession(context.Background())
+
+	sessCtx := mongo.NewSessionContext(context.Background(), session)
+
+	opCtx, cancel := c.WithContext(sessCtx).(*mongoClient).getContext()
+	defer cancel()
+
+	assert.Equal(t, session, mongo.SessionFromContext(opCtx))
+}
+
+func TestUpsertPipelineKeepsCreatedAt(t *testing.T) {
+	foo := Foo{
+		BasicDocument: BasicDocument{
+			ID: "foo-1",
+		},
+		Action: "Bar",
+	}
+	foo.SetCreatedAt()
+	foo.SetUpdatedAt()
+
+	pipeline, err := upsertPipeline(&foo, nil)
+	assert.Nil(t, err)
+	assert.Len(t, pipeline, 1)
+
+	stage := pipeline[0][0]
+	assert.Equal(t, "$replaceWith", stage.Key)
+
+	merged := stage.Value.(bson.M)["$mergeObjects"].(bson.A)
+	assert.Len(t, merged, 2)
+
+	replacement := merged[0].(bson.M)["$literal"].(bson.D)
+	assert.Equal(t, bson.D{
+		{Key: "_id", Value: "foo-1"},
+		{Key: "updatedAt", Value: replacement[1].Value},
+		{Key: "action", Value: "Bar"},
+	}, replacement)
+
+	createdAt := merged[1].(bson.M)["createdAt"].(bson.M)["$ifNull"].(bson.A)
+	assert.Equal(t, "$createdAt", createdAt[0])
+	assert.NotNil(t, createdAt[1].(bson.M)["$literal"])
+}
+
+func TestUpsertPipelineNamingStrategy(t *testing.T) {
+	order := namedOrder{BasicDocument: BasicDocument{ID: "o-1"}, Details: namedDetails{DisplayName: "Jane", Tagged: "x"}}
+	order.SetCreatedAt()
+
+	pipeline, err := upsertPipeline(&order, SnakeCaseNaming.Registry())
+	assert.Nil(t, err)
+
+	merged := pipeline[0][0].Value.(bson.M)["$mergeObjects"].(bson.A)
+	replacement := merged[0].(bson.M)["$literal"].(bson.D)
+
+	assert.Contains(t, replacement, bson.E{Key: "display_name", Value: "Jane"})
+	assert.Contains(t, replacement, bson.E{Key: "tag_name", Value: "x"})
+	assert.Contains(t, merged[1].(bson.M), "createdAt")
+}
+
+func TestUpsertDocumentSetsInsertFields(t *testing.T) {
+	update, err := UpdateDocument(bson.M{"action": "Bar"})
+	assert.Nil(t, err)
+
+	update = UpsertDocument(update, bson.M{"action": "Bar"})
+	assert.Len(t, update, 2)
+	assert.Equal(t, "$setOnInsert", update[1].Key)
+
+	onInsert := update[1].Value.(bson.M)
+	assert.NotEmpty(t, onInsert["_id"])
+	assert.NotNil(t, onInsert["createdAt"])
+
+	update, err = UpdateDocument(bson.M{"createdAt": "2020-01-01"})
+	assert.Nil(t, err)
+
+	update = UpsertDocument(update, bson.M{"action": "Bar"})
+	assert.NotContains(t, update[1].Value.(bson.M), "createdAt")
+
+	for _, filter := range []bson.M{{"_id": "a"}, {"_id": bson.M{"$eq": "a"}}} {
+		update = UpsertDocument(bson.D{}, filter)
+		assert.NotContains(t, update[0].Value.(bson.M), "_id")
+	}
+
+	update = UpsertDocument(bson.D{}, bson.M{"_id": bson.M{"$in": bson.A{"a", "b"}}})
+	assert.Contains(t, update[0].Value.(bson.M), "_id")
+}
+
+func TestFindQueryOffset(t *testing.T) {
+	limit := int64(10)
+
+	_, mongoOptions, err := findQuery(nil, []*FindOptions{{Pagination: &PaginationOption{Limit: &limit, Page: 2}}})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), *mongoOptions.Skip)
+	assert.Equal(t, int64(10), *mongoOptions.Limit)
+
+	_, mongoOptions, err = findQuery(nil, []*FindOptions{{Pagination: &PaginationOption{Limit: &limit}}})
+	assert.Nil(t, err)
+	assert.Nil(t, mongoOptions.Skip)
+
+	_, _, err = findQuery(nil, []*FindOptions{{Pagination: &PaginationOption{Limit: &limit, Cursor: "cursor"}}})
+	assert.True(t, errors.Is(err, ErrInvalidCursor))
+}
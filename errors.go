@@ -0,0 +1,124 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrNotFound      = errors.New("document not found")
+	ErrDuplicateKey  = errors.New("duplicate key")
+	ErrNotConnected  = errors.New("MongoDB client was not initialized")
+	ErrConflict      = errors.New("write conflict")
+	ErrWriteConcern  = errors.New("write concern error")
+	ErrInvalidCursor = errors.New("invalid pagination cursor")
+	ErrSkipTooLarge  = errors.New("pagination skip exceeds the maximum allowed")
+	ErrInvalidPatch  = errors.New("invalid patch")
+	ErrPatchFailed   = errors.New("patch does not apply to the document")
+)
+
+// writeConflictCode is the server error code returned when two operations
+// modify the same document concurrently, typically inside transactions.
+const writeConflictCode = 112
+
+// OperationError is returned by every Client operation. It keeps the driver
+// error available through errors.As/errors.Unwrap and matches the package
+// sentinel errors through errors.Is.
+type OperationError struct {
+	Op         string
+	Collection string
+	Filter     interface{}
+	Err        error
+}
+
+func (e *OperationError) Error() string {
+	msg := e.Op
+
+	if e.Collection != "" {
+		msg = fmt.Sprintf("%s %s", msg, e.Collection)
+	}
+
+	if e.Filter != nil {
+		msg = fmt.Sprintf("%s with filter %v", msg, e.Filter)
+	}
+
+	return fmt.Sprintf("%s: %s", msg, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *OperationError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return errors.Is(e.Err, mongo.ErrNoDocuments)
+	case ErrDuplicateKey:
+		return mongo.IsDuplicateKeyError(e.Err)
+	case ErrConflict:
+		var serverErr mongo.ServerError
+		return errors.As(e.Err, &serverErr) && serverErr.HasErrorCode(writeConflictCode)
+	case ErrWriteConcern:
+		return hasWriteConcernError(e.Err)
+	}
+
+	return false
+}
+
+func hasWriteConcernError(err error) bool {
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		return writeErr.WriteConcernError != nil
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) {
+		return bulkErr.WriteConcernError != nil
+	}
+
+	return false
+}
+
+// FlattenError is returned when an update input cannot be flattened. Path is
+// the dotted path of the offending field, empty when it could not be found.
+type FlattenError struct {
+	Path string
+	Err  error
+}
+
+func (e *FlattenError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("cannot flatten update input: %s", e.Err)
+	}
+
+	return fmt.Sprintf("cannot flatten field %s: %s", e.Path, e.Err)
+}
+
+func (e *FlattenError) Unwrap() error {
+	return e.Err
+}
+
+func newOperationError(op string, d Document, filter interface{}, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var opErr *OperationError
+	if errors.As(err, &opErr) {
+		return err
+	}
+
+	collection := ""
+
+	if d != nil {
+		collection = d.DocumentName()
+	}
+
+	return &OperationError{
+		Op:         op,
+		Collection: collection,
+		Filter:     filter,
+		Err:        err,
+	}
+}
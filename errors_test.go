@@ -0,0 +1,98 @@
+package mongo
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+func TestOperationErrorIs(t *testing.T) {
+	tests := []struct {
+		err      error
+		sentinel error
+	}{
+		{
+			err:      mongo.ErrNoDocuments,
+			sentinel: ErrNotFound,
+		},
+		{
+			err:      ErrNotFound,
+			sentinel: ErrNotFound,
+		},
+		{
+			err: mongo.WriteException{
+				WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}},
+			},
+			sentinel: ErrDuplicateKey,
+		},
+		{
+			err:      mongo.CommandError{Code: 112, Name: "WriteConflict"},
+			sentinel: ErrConflict,
+		},
+		{
+			err: mongo.WriteException{
+				WriteConcernError: &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"},
+			},
+			sentinel: ErrWriteConcern,
+		},
+		{
+			err:      ErrNotConnected,
+			sentinel: ErrNotConnected,
+		},
+	}
+
+	for _, test := range tests {
+		err := newOperationError("Test", &Foo{}, bson.M{"_id": "foo"}, test.err)
+
+		assert.True(t, errors.Is(err, test.sentinel), test.sentinel.Error())
+		assert.Equal(t, test.err, errors.Unwrap(err))
+
+		var opErr *OperationError
+		assert.True(t, errors.As(err, &opErr))
+		assert.Equal(t, "Test", opErr.Op)
+		assert.Equal(t, "foo", opErr.Collection)
+	}
+}
+
+func TestOperationErrorIsNotOtherSentinels(t *testing.T) {
+	err := newOperationError("FindOne", &Foo{}, nil, mongo.ErrNoDocuments)
+
+	assert.False(t, errors.Is(err, ErrDuplicateKey))
+	assert.False(t, errors.Is(err, ErrConflict))
+	assert.False(t, errors.Is(err, ErrWriteConcern))
+	assert.False(t, errors.Is(err, ErrNotConnected))
+}
+
+func TestOperationErrorMessage(t *testing.T) {
+	err := newOperationError("Delete", &Foo{}, bson.M{"_id": "foo"}, ErrNotFound)
+
+	assert.Equal(t, "Delete foo with filter map[_id:foo]: document not found", err.Error())
+}
+
+func TestOperationErrorIsNotWrappedTwice(t *testing.T) {
+	err := newOperationError("FindOne", &Foo{}, nil, mongo.ErrNoDocuments)
+
+	assert.Same(t, err, newOperationError("FindOneById", &Foo{}, nil, err))
+	assert.Nil(t, newOperationError("FindOne", &Foo{}, nil, nil))
+}
+
+func TestNotConnectedClient(t *testing.T) {
+	c := &mongoClient{conn: &connection{}, database: "test_db"}
+
+	_, err := c.GetCollection(&Foo{})
+	assert.True(t, errors.Is(err, ErrNotConnected))
+
+	err = c.Persist(&Foo{})
+	assert.True(t, errors.Is(err, ErrNotConnected))
+
+	_, err = c.Count(&Foo{}, nil)
+	assert.True(t, errors.Is(err, ErrNotConnected))
+
+	_, err = c.Exists(&Foo{}, nil)
+	assert.True(t, errors.Is(err, ErrNotConnected))
+
+	assert.True(t, errors.Is(c.Disconnect(), ErrNotConnected))
+	assert.True(t, errors.Is(c.HealthCheck(), ErrNotConnected))
+}
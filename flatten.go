@@ -0,0 +1,500 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	errCycle       = errors.New("cycle detected")
+	errInlineField = errors.New("inline fields must be structs or maps")
+)
+
+// flattenKind tells whether values of a type are walked as documents or set
+// as a whole.
+type flattenKind int
+
+const (
+	flattenLeaf flattenKind = iota
+	flattenStruct
+	flattenMap
+)
+
+// typeInfo is the metadata cached for every type met while flattening.
+// safe is set when no value of the type can fail to marshal, so its values
+// are not checked one by one.
+type typeInfo struct {
+	kind   flattenKind
+	fields []fieldInfo
+	safe   bool
+}
+
+// fieldInfo describes a struct field as the driver encodes it, following its
+// bson struct tag.
+type fieldInfo struct {
+	name      string
+	index     int
+	omitEmpty bool
+	minSize   bool
+	inline    bool
+}
+
+// typeKey indexes the type cache, field names depending on the naming
+// strategy.
+type typeKey struct {
+	t      reflect.Type
+	naming *NamingStrategy
+}
+
+var typeCache sync.Map
+
+var (
+	tTime           = reflect.TypeOf(time.Time{})
+	tMarshaler      = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+	tValueMarshaler = reflect.TypeOf((*bson.ValueMarshaler)(nil)).Elem()
+	tZeroer         = reflect.TypeOf((*bsoncodec.Zeroer)(nil)).Elem()
+	primitivePkg    = reflect.TypeOf(bson.M{}).PkgPath()
+)
+
+func cachedType(t reflect.Type, naming *NamingStrategy) *typeInfo {
+	return buildType(t, naming, nil)
+}
+
+// buildType returns the cached typeInfo of t, computing it when missing. A
+// typeInfo is only published once complete, so concurrent callers never see
+// a partial one. pending holds the types being computed by this call: a
+// recursive type meets itself there, not yet safe, so its values are
+// checked one by one.
+func buildType(t reflect.Type, naming *NamingStrategy, pending map[reflect.Type]*typeInfo) *typeInfo {
+	key := typeKey{t: t, naming: naming}
+
+	if info, ok := typeCache.Load(key); ok {
+		return info.(*typeInfo)
+	}
+
+	if info, ok := pending[t]; ok {
+		return info
+	}
+
+	info := &typeInfo{kind: kindOf(t)}
+
+	if info.kind == flattenStruct {
+		info.fields = structFields(t, naming)
+	}
+
+	if pending == nil {
+		pending = make(map[reflect.Type]*typeInfo)
+	}
+
+	pending[t] = info
+	info.safe = safeType(t, naming, pending)
+	delete(pending, t)
+
+	cached, _ := typeCache.LoadOrStore(key, info)
+
+	return cached.(*typeInfo)
+}
+
+// wholeType reports whether values of t are always set as a whole: types
+// with a marshaler, time.Time and the bson primitives other than bson.M, D
+// and A.
+func wholeType(t reflect.Type) bool {
+	if t.PkgPath() == primitivePkg {
+		return t.Kind() != reflect.Map && t.Kind() != reflect.Slice
+	}
+
+	return t == tTime || marshals(t)
+}
+
+func marshals(t reflect.Type) bool {
+	return t.Implements(tMarshaler) || t.Implements(tValueMarshaler) ||
+		reflect.PtrTo(t).Implements(tMarshaler) || reflect.PtrTo(t).Implements(tValueMarshaler)
+}
+
+func kindOf(t reflect.Type) flattenKind {
+	if wholeType(t) {
+		return flattenLeaf
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return flattenStruct
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return flattenMap
+		}
+	}
+
+	return flattenLeaf
+}
+
+func structFields(t reflect.Type, naming *NamingStrategy) []fieldInfo {
+	var fields []fieldInfo
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		tags, err := naming.ParseStructTags(sf)
+
+		if err != nil || tags.Skip {
+			continue
+		}
+
+		fields = append(fields, fieldInfo{
+			name:      tags.Name,
+			index:     i,
+			omitEmpty: tags.OmitEmpty,
+			minSize:   tags.MinSize,
+			inline:    tags.Inline,
+		})
+	}
+
+	return fields
+}
+
+func safeType(t reflect.Type, naming *NamingStrategy, pending map[reflect.Type]*typeInfo) bool {
+	if wholeType(t) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice, reflect.Array:
+		return buildType(t.Elem(), naming, pending).safe
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && buildType(t.Elem(), naming, pending).safe
+	case reflect.Struct:
+		for _, field := range pending[t].fields {
+			if !buildType(t.Field(field.index).Type, naming, pending).safe {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// isEmpty reports whether an omitempty field is left out, as the driver
+// does.
+func isEmpty(v reflect.Value) bool {
+	if v.Type().Implements(tZeroer) && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		return v.Interface().(bsoncodec.Zeroer).IsZero()
+	}
+
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// flattener collects the dotted fields of a value. visiting holds the
+// pointers and maps on the current path, to stop on cycles. The raw keys of
+// bson inputs are mapped onto the fields of target when set.
+type flattener struct {
+	fields   map[string]interface{}
+	visiting map[uintptr]bool
+	naming   *NamingStrategy
+	elements bool
+	target   reflect.Type
+}
+
+func newFlattener(naming *NamingStrategy) *flattener {
+	return &flattener{
+		fields:   make(map[string]interface{}),
+		visiting: make(map[uintptr]bool),
+		naming:   naming,
+	}
+}
+
+// enter dereferences v, stopping at pointers with their own marshaler. The
+// returned pointers must be passed to leave once v has been walked.
+func (f *flattener) enter(path string, v reflect.Value) (reflect.Value, []uintptr, error) {
+	var entered []uintptr
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, entered, nil
+		}
+
+		if v.Kind() == reflect.Ptr {
+			if marshals(v.Type()) {
+				break
+			}
+
+			if f.visiting[v.Pointer()] {
+				return reflect.Value{}, entered, &FlattenError{Path: path, Err: errCycle}
+			}
+
+			f.visiting[v.Pointer()] = true
+			entered = append(entered, v.Pointer())
+		}
+
+		v = v.Elem()
+	}
+
+	return v, entered, nil
+}
+
+func (f *flattener) leave(entered []uintptr) {
+	for _, p := range entered {
+		delete(f.visiting, p)
+	}
+}
+
+// document adds the fields of the struct v under prefix. _id and id are
+// skipped at the top level since updates never change them.
+func (f *flattener) document(prefix string, v reflect.Value, top bool) error {
+	for _, field := range cachedType(v.Type(), f.naming).fields {
+		fv := v.Field(field.index)
+
+		if top && (field.name == "_id" || field.name == "id") {
+			continue
+		}
+
+		if field.omitEmpty && isEmpty(fv) {
+			continue
+		}
+
+		var err error
+
+		if field.inline {
+			err = f.inline(prefix, fv, top)
+		} else {
+			err = f.field(joinPath(prefix, field.name), fv, field.minSize)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *flattener) inline(prefix string, v reflect.Value, top bool) error {
+	v, entered, err := f.enter(prefix, v)
+	defer f.leave(entered)
+
+	if err != nil || !v.IsValid() {
+		return err
+	}
+
+	switch cachedType(v.Type(), f.naming).kind {
+	case flattenStruct:
+		return f.document(prefix, v, top)
+	case flattenMap:
+		return f.entries(prefix, v, top)
+	}
+
+	return &FlattenError{Path: prefix, Err: errInlineField}
+}
+
+func (f *flattener) entries(prefix string, v reflect.Value, top bool) error {
+	if v.IsNil() {
+		return nil
+	}
+
+	if f.visiting[v.Pointer()] {
+		return &FlattenError{Path: prefix, Err: errCycle}
+	}
+
+	f.visiting[v.Pointer()] = true
+	defer delete(f.visiting, v.Pointer())
+
+	iter := v.MapRange()
+
+	for iter.Next() {
+		key := iter.Key().String()
+
+		if top && (key == "_id" || key == "id") {
+			continue
+		}
+
+		err := f.field(joinPath(prefix, key), iter.Value(), false)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// field adds v at path, walking it when it is a document. Nil values are
+// skipped rather than set to null, unlike null Optional values.
+func (f *flattener) field(path string, v reflect.Value, minSize bool) error {
+	v, entered, err := f.enter(path, v)
+	defer f.leave(entered)
+
+	if err != nil || !v.IsValid() {
+		return err
+	}
+
+	if opt, ok := v.Interface().(optionalValue); ok {
+		value, set, null := opt.optional()
+
+		if null {
+			f.fields[path] = nil
+		}
+
+		if !set || null {
+			return nil
+		}
+
+		return f.field(path, reflect.ValueOf(value), minSize)
+	}
+
+	info := cachedType(v.Type(), f.naming)
+
+	switch info.kind {
+	case flattenStruct:
+		return f.document(path, v, false)
+	case flattenMap:
+		return f.entries(path, v, false)
+	}
+
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.IsNil() {
+		return nil
+	}
+
+	if f.elements && f.documentElements(v.Type()) {
+		for i := 0; i < v.Len(); i++ {
+			if err := f.field(joinPath(path, strconv.Itoa(i)), v.Index(i), false); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if !info.safe {
+		err = f.check(path, v)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	value := v.Interface()
+
+	if minSize && v.Kind() == reflect.Int64 && v.Int() >= math.MinInt32 && v.Int() <= math.MaxInt32 {
+		value = int32(v.Int())
+	}
+
+	f.fields[path] = value
+
+	return nil
+}
+
+// documentElements reports whether t is an array of subdocuments.
+func (f *flattener) documentElements(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return false
+	}
+
+	elem := t.Elem()
+
+	for elem.Kind() == reflect.Ptr && !marshals(elem) {
+		elem = elem.Elem()
+	}
+
+	return cachedType(elem, f.naming).kind != flattenLeaf
+}
+
+// check returns a *FlattenError naming the first part of v which cannot be
+// marshalled.
+func (f *flattener) check(path string, v reflect.Value) error {
+	if !v.IsValid() || cachedType(v.Type(), f.naming).safe {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer, reflect.Uintptr:
+		return &FlattenError{Path: path, Err: fmt.Errorf("unsupported type %s", v.Type())}
+	case reflect.Ptr, reflect.Interface:
+		elem, entered, err := f.enter(path, v)
+		defer f.leave(entered)
+
+		if err != nil {
+			return err
+		}
+
+		return f.check(path, elem)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := f.check(joinPath(path, strconv.Itoa(i)), v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+
+		if f.visiting[v.Pointer()] {
+			return &FlattenError{Path: path, Err: errCycle}
+		}
+
+		f.visiting[v.Pointer()] = true
+		defer delete(f.visiting, v.Pointer())
+
+		iter := v.MapRange()
+
+		for iter.Next() {
+			if err := f.check(joinPath(path, fmt.Sprint(iter.Key().Interface())), iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for _, field := range cachedType(v.Type(), f.naming).fields {
+			fieldPath := joinPath(path, field.name)
+
+			if field.inline {
+				fieldPath = path
+			}
+
+			if err := f.check(fieldPath, v.Field(field.index)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
@@ -0,0 +1,517 @@
+package mongo
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// defaultTextLanguage is the default_language of text indexes created
+// without one.
+const defaultTextLanguage = "english"
+
+type IndexKind string
+
+const (
+	IndexText     IndexKind = "text"
+	Index2DSphere IndexKind = "2dsphere"
+	IndexHashed   IndexKind = "hashed"
+)
+
+// IndexKey is one field of an index. Order is used for regular (and
+// wildcard, with a Field ending in "$**") keys, Kind for special ones.
+type IndexKey struct {
+	Field string
+	Order OrderType
+	Kind  IndexKind
+}
+
+type IndexSpec struct {
+	Name               string
+	Keys               []IndexKey
+	Unique             bool
+	Sparse             bool
+	ExpireAfter        *time.Duration
+	PartialFilter      bson.M
+	Collation          *options.Collation
+	Weights            bson.M
+	DefaultLanguage    string
+	WildcardProjection bson.M
+}
+
+// IndexedDocument is implemented by documents declaring the indexes of their
+// collection, see Client.EnsureIndexes.
+type IndexedDocument interface {
+	Document
+	Indexes() []IndexSpec
+}
+
+type EnsureIndexesOptions struct {
+	// DropUndeclared drops the indexes of the collection which are not
+	// declared by the document anymore. The _id index is never dropped.
+	DropUndeclared bool
+}
+
+type IndexReference struct {
+	Collection string
+	Name       string
+}
+
+type IndexDrift struct {
+	IndexReference
+	Reasons []string
+}
+
+type IndexReport struct {
+	Created    []IndexReference
+	Drifted    []IndexDrift
+	Undeclared []IndexReference
+	Dropped    []IndexReference
+}
+
+type existingIndex struct {
+	Name                    string `bson:"name"`
+	Key                     bson.D `bson:"key"`
+	Unique                  bool   `bson:"unique"`
+	Sparse                  bool   `bson:"sparse"`
+	ExpireAfterSeconds      *int64 `bson:"expireAfterSeconds"`
+	PartialFilterExpression bson.M `bson:"partialFilterExpression"`
+	Collation               bson.M `bson:"collation"`
+	Weights                 bson.M `bson:"weights"`
+	DefaultLanguage         string `bson:"default_language"`
+	WildcardProjection      bson.M `bson:"wildcardProjection"`
+}
+
+func (k IndexKey) value() interface{} {
+	if k.Kind != "" {
+		return string(k.Kind)
+	}
+
+	if k.Order == 0 {
+		return int32(OrderASC)
+	}
+
+	return int32(k.Order)
+}
+
+func (s IndexSpec) keys() bson.D {
+	keys := bson.D{}
+
+	for _, key := range s.Keys {
+		keys = append(keys, bson.E{Key: key.Field, Value: key.value()})
+	}
+
+	return keys
+}
+
+func (s IndexSpec) isText() bool {
+	for _, key := range s.Keys {
+		if key.Kind == IndexText {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IndexName returns the name of the index, defaulting to the one the server
+// would generate, e.g. "status_1_createdAt_-1".
+func (s IndexSpec) IndexName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	var parts []string
+
+	for _, key := range s.Keys {
+		parts = append(parts, fmt.Sprintf("%s_%v", key.Field, key.value()))
+	}
+
+	return strings.Join(parts, "_")
+}
+
+func (s IndexSpec) model() mongo.IndexModel {
+	opts := options.Index().SetName(s.IndexName())
+
+	if s.Unique {
+		opts.SetUnique(true)
+	}
+
+	if s.Sparse {
+		opts.SetSparse(true)
+	}
+
+	if s.ExpireAfter != nil {
+		opts.SetExpireAfterSeconds(int32(s.ExpireAfter.Seconds()))
+	}
+
+	if s.PartialFilter != nil {
+		opts.SetPartialFilterExpression(s.PartialFilter)
+	}
+
+	if s.Collation != nil {
+		opts.SetCollation(s.Collation)
+	}
+
+	if s.Weights != nil {
+		opts.SetWeights(s.Weights)
+	}
+
+	if s.DefaultLanguage != "" {
+		opts.SetDefaultLanguage(s.DefaultLanguage)
+	}
+
+	if s.WildcardProjection != nil {
+		opts.SetWildcardProjection(s.WildcardProjection)
+	}
+
+	return mongo.IndexModel{
+		Keys:    s.keys(),
+		Options: opts,
+	}
+}
+
+func sameIndexKeys(declared, existing bson.D) bool {
+	if len(declared) != len(existing) {
+		return false
+	}
+
+	for i := range declared {
+		if declared[i].Key != existing[i].Key {
+			return false
+		}
+
+		if fmt.Sprint(toFloat(declared[i].Value)) != fmt.Sprint(toFloat(existing[i].Value)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func toFloat(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case int:
+		return float64(n)
+	}
+
+	return v
+}
+
+func normalizeFilter(filter bson.M) bson.M {
+	if filter == nil {
+		return nil
+	}
+
+	raw, err := bson.Marshal(filter)
+
+	if err != nil {
+		return filter
+	}
+
+	normalized := bson.M{}
+
+	if err = bson.Unmarshal(raw, &normalized); err != nil {
+		return filter
+	}
+
+	return normalized
+}
+
+// normalizeNumbers turns the numbers held by v into float64, as the server
+// may return them with another type than the declared one.
+func normalizeNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case bson.M:
+		normalized := bson.M{}
+
+		for k, e := range value {
+			normalized[k] = normalizeNumbers(e)
+		}
+
+		return normalized
+	case bson.A:
+		normalized := make(bson.A, len(value))
+
+		for i, e := range value {
+			normalized[i] = normalizeNumbers(e)
+		}
+
+		return normalized
+	}
+
+	return toFloat(v)
+}
+
+func sameDocument(declared, existing bson.M) bool {
+	return reflect.DeepEqual(normalizeNumbers(normalizeFilter(declared)), normalizeNumbers(normalizeFilter(existing)))
+}
+
+// sameCollation compares the options set by the declared collation with the
+// existing one. Options left unset take locale dependent defaults on the
+// server, so they are not compared.
+func sameCollation(declared *options.Collation, existing bson.M) bool {
+	if declared == nil || declared.Locale == "" || declared.Locale == "simple" {
+		return existing == nil || existing["locale"] == "simple"
+	}
+
+	if existing == nil {
+		return false
+	}
+
+	var declaredOptions bson.M
+
+	if err := bson.Unmarshal(declared.ToDocument(), &declaredOptions); err != nil {
+		return false
+	}
+
+	for k, v := range declaredOptions {
+		if fmt.Sprint(toFloat(v)) != fmt.Sprint(toFloat(existing[k])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// textWeights returns the weights of the fields of a text index, 1 unless
+// declared otherwise.
+func (s IndexSpec) textWeights() bson.M {
+	weights := bson.M{}
+
+	for _, key := range s.Keys {
+		if key.Kind == IndexText {
+			weights[key.Field] = 1
+		}
+	}
+
+	for field, weight := range s.Weights {
+		weights[field] = weight
+	}
+
+	return weights
+}
+
+func indexDrift(spec IndexSpec, existing existingIndex) []string {
+	var reasons []string
+
+	if existing.Name != spec.IndexName() {
+		reasons = append(reasons, fmt.Sprintf("name is %s", existing.Name))
+	}
+
+	if !spec.isText() && !sameIndexKeys(spec.keys(), existing.Key) {
+		reasons = append(reasons, "keys differ")
+	}
+
+	if spec.Unique != existing.Unique {
+		reasons = append(reasons, "unique differs")
+	}
+
+	if spec.Sparse != existing.Sparse {
+		reasons = append(reasons, "sparse differs")
+	}
+
+	var expireAfter *int64
+
+	if spec.ExpireAfter != nil {
+		seconds := int64(spec.ExpireAfter.Seconds())
+		expireAfter = &seconds
+	}
+
+	if !reflect.DeepEqual(expireAfter, existing.ExpireAfterSeconds) {
+		reasons = append(reasons, "expireAfterSeconds differs")
+	}
+
+	if !sameDocument(spec.PartialFilter, existing.PartialFilterExpression) {
+		reasons = append(reasons, "partialFilterExpression differs")
+	}
+
+	if !sameCollation(spec.Collation, existing.Collation) {
+		reasons = append(reasons, "collation differs")
+	}
+
+	if !sameDocument(spec.WildcardProjection, existing.WildcardProjection) {
+		reasons = append(reasons, "wildcardProjection differs")
+	}
+
+	// The server reports the weights and language of every text index.
+	if spec.isText() && existing.Weights != nil && !sameDocument(spec.textWeights(), existing.Weights) {
+		reasons = append(reasons, "weights differ")
+	}
+
+	language := spec.DefaultLanguage
+
+	if language == "" {
+		language = defaultTextLanguage
+	}
+
+	if spec.isText() && existing.DefaultLanguage != "" && existing.DefaultLanguage != language {
+		reasons = append(reasons, "default_language differs")
+	}
+
+	return reasons
+}
+
+// diffIndexes compares the declared indexes of a collection with the existing
+// ones. Existing indexes are matched by name first, then by keys.
+func diffIndexes(collection string, declared []IndexSpec, existing []existingIndex) ([]IndexSpec, []IndexDrift, []IndexReference) {
+	var missing []IndexSpec
+	var drifted []IndexDrift
+	var undeclared []IndexReference
+
+	matched := make(map[string]bool)
+
+	for _, spec := range declared {
+		var found *existingIndex
+
+		for i := range existing {
+			if existing[i].Name == spec.IndexName() {
+				found = &existing[i]
+				break
+			}
+		}
+
+		if found == nil {
+			for i := range existing {
+				if !matched[existing[i].Name] && sameIndexKeys(spec.keys(), existing[i].Key) {
+					found = &existing[i]
+					break
+				}
+			}
+		}
+
+		if found == nil {
+			missing = append(missing, spec)
+			continue
+		}
+
+		matched[found.Name] = true
+
+		if reasons := indexDrift(spec, *found); len(reasons) > 0 {
+			drifted = append(drifted, IndexDrift{
+				IndexReference: IndexReference{Collection: collection, Name: spec.IndexName()},
+				Reasons:        reasons,
+			})
+		}
+	}
+
+	for _, index := range existing {
+		if index.Name == "_id_" || matched[index.Name] {
+			continue
+		}
+
+		undeclared = append(undeclared, IndexReference{Collection: collection, Name: index.Name})
+	}
+
+	return missing, drifted, undeclared
+}
+
+// EnsureIndexes creates the missing indexes declared by the given documents
+// implementing IndexedDocument. Existing indexes are never modified: the ones
+// not matching their declaration are only reported as drifted. Undeclared
+// indexes are reported, and dropped when opts.DropUndeclared is set.
+//
+// Index builds can take long on large collections, so they are only bounded
+// by the context of the client, not by the default timeout.
+func (m *mongoClient) EnsureIndexes(opts *EnsureIndexesOptions, docs ...Document) (*IndexReport, error) {
+	if opts == nil {
+		opts = &EnsureIndexesOptions{}
+	}
+
+	report := &IndexReport{}
+
+	for _, d := range docs {
+		indexed, ok := d.(IndexedDocument)
+
+		if !ok {
+			continue
+		}
+
+		collection, err := m.GetCollection(d)
+
+		if err != nil {
+			return report, err
+		}
+
+		existing, err := m.listIndexes(collection)
+
+		if err != nil {
+			return report, newOperationError("EnsureIndexes", d, nil, err)
+		}
+
+		missing, drifted, undeclared := diffIndexes(d.DocumentName(), indexed.Indexes(), existing)
+
+		report.Drifted = append(report.Drifted, drifted...)
+		report.Undeclared = append(report.Undeclared, undeclared...)
+
+		if len(missing) > 0 {
+			models := make([]mongo.IndexModel, len(missing))
+
+			for i, spec := range missing {
+				models[i] = spec.model()
+			}
+
+			names, err := m.createIndexes(collection, models)
+
+			if err != nil {
+				return report, newOperationError("EnsureIndexes", d, nil, err)
+			}
+
+			for _, name := range names {
+				report.Created = append(report.Created, IndexReference{Collection: d.DocumentName(), Name: name})
+			}
+		}
+
+		if opts.DropUndeclared {
+			for _, index := range undeclared {
+				err = m.dropIndex(collection, index.Name)
+
+				if err != nil {
+					return report, newOperationError("EnsureIndexes", d, nil, err)
+				}
+
+				report.Dropped = append(report.Dropped, index)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func (m *mongoClient) listIndexes(collection *mongo.Collection) ([]existingIndex, error) {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
+	cursor, err := collection.Indexes().List(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var existing []existingIndex
+
+	err = cursor.All(ctx, &existing)
+
+	return existing, err
+}
+
+func (m *mongoClient) createIndexes(collection *mongo.Collection, models []mongo.IndexModel) ([]string, error) {
+	return collection.Indexes().CreateMany(m.baseContext(), models)
+}
+
+func (m *mongoClient) dropIndex(collection *mongo.Collection, name string) error {
+	ctx, cancel := m.getContext()
+	defer cancel()
+
+	_, err := collection.Indexes().DropOne(ctx, name)
+
+	return err
+}
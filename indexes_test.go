@@ -0,0 +1,161 @@
+package mongo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"testing"
+	"time"
+)
+
+func TestIndexName(t *testing.T) {
+	tests := []struct {
+		spec   IndexSpec
+		output string
+	}{
+		{
+			spec:   IndexSpec{Keys: []IndexKey{{Field: "email"}}},
+			output: "email_1",
+		},
+		{
+			spec:   IndexSpec{Keys: []IndexKey{{Field: "status", Order: OrderASC}, {Field: "createdAt", Order: OrderDESC}}},
+			output: "status_1_createdAt_-1",
+		},
+		{
+			spec:   IndexSpec{Keys: []IndexKey{{Field: "location", Kind: Index2DSphere}}},
+			output: "location_2dsphere",
+		},
+		{
+			spec:   IndexSpec{Keys: []IndexKey{{Field: "$**"}}},
+			output: "$**_1",
+		},
+		{
+			spec:   IndexSpec{Name: "custom", Keys: []IndexKey{{Field: "email"}}},
+			output: "custom",
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.output, test.spec.IndexName())
+	}
+}
+
+func TestIndexModel(t *testing.T) {
+	ttl := 24 * time.Hour
+
+	spec := IndexSpec{
+		Keys:          []IndexKey{{Field: "status"}, {Field: "createdAt", Order: OrderDESC}},
+		Unique:        true,
+		ExpireAfter:   &ttl,
+		PartialFilter: bson.M{"status": "active"},
+	}
+
+	model := spec.model()
+
+	assert.Equal(t, bson.D{{Key: "status", Value: int32(1)}, {Key: "createdAt", Value: int32(-1)}}, model.Keys)
+	assert.Equal(t, "status_1_createdAt_-1", *model.Options.Name)
+	assert.True(t, *model.Options.Unique)
+	assert.Nil(t, model.Options.Sparse)
+	assert.Equal(t, int32(86400), *model.Options.ExpireAfterSeconds)
+	assert.Equal(t, bson.M{"status": "active"}, model.Options.PartialFilterExpression)
+}
+
+func TestDiffIndexes(t *testing.T) {
+	ttl := time.Hour
+	seconds := int64(3600)
+
+	declared := []IndexSpec{
+		{Keys: []IndexKey{{Field: "email"}}, Unique: true},
+		{Keys: []IndexKey{{Field: "expiresAt"}}, ExpireAfter: &ttl},
+		{Keys: []IndexKey{{Field: "status"}}},
+		{Name: "by_name", Keys: []IndexKey{{Field: "name"}}},
+		{Keys: []IndexKey{{Field: "title", Kind: IndexText}}},
+	}
+
+	existing := []existingIndex{
+		{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}},
+		{Name: "email_1", Key: bson.D{{Key: "email", Value: int32(1)}}, Unique: true},
+		{Name: "expiresAt_1", Key: bson.D{{Key: "expiresAt", Value: 1.0}}, ExpireAfterSeconds: &seconds},
+		{Name: "name_1", Key: bson.D{{Key: "name", Value: int32(1)}}},
+		{Name: "title_text", Key: bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}}, Unique: true},
+		{Name: "legacy_1", Key: bson.D{{Key: "legacy", Value: int32(1)}}},
+	}
+
+	missing, drifted, undeclared := diffIndexes("foo", declared, existing)
+
+	assert.Len(t, missing, 1)
+	assert.Equal(t, "status_1", missing[0].IndexName())
+
+	assert.Equal(t, []IndexDrift{
+		{
+			IndexReference: IndexReference{Collection: "foo", Name: "by_name"},
+			Reasons:        []string{"name is name_1"},
+		},
+		{
+			IndexReference: IndexReference{Collection: "foo", Name: "title_text"},
+			Reasons:        []string{"unique differs"},
+		},
+	}, drifted)
+
+	assert.Equal(t, []IndexReference{{Collection: "foo", Name: "legacy_1"}}, undeclared)
+}
+
+func TestIndexDriftOptions(t *testing.T) {
+	text := IndexSpec{
+		Keys:            []IndexKey{{Field: "title", Kind: IndexText}, {Field: "body", Kind: IndexText}},
+		Weights:         bson.M{"title": 10},
+		DefaultLanguage: "french",
+	}
+
+	existingText := existingIndex{
+		Name:            "title_text_body_text",
+		Key:             bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+		Weights:         bson.M{"title": int32(10), "body": int32(1)},
+		DefaultLanguage: "french",
+	}
+
+	assert.Empty(t, indexDrift(text, existingText))
+
+	existingText.Weights = bson.M{"title": int32(5), "body": int32(1)}
+	existingText.DefaultLanguage = "english"
+
+	assert.Equal(t, []string{"weights differ", "default_language differs"}, indexDrift(text, existingText))
+
+	collated := IndexSpec{
+		Keys:      []IndexKey{{Field: "name"}},
+		Collation: &options.Collation{Locale: "fr", Strength: 2},
+	}
+
+	existing := existingIndex{
+		Name: "name_1",
+		Key:  bson.D{{Key: "name", Value: int32(1)}},
+		Collation: bson.M{
+			"locale": "fr", "caseLevel": false, "caseFirst": "off", "strength": int32(2),
+			"numericOrdering": false, "alternate": "non-ignorable", "maxVariable": "punct",
+			"normalization": false, "backwards": false, "version": "57.1",
+		},
+	}
+
+	assert.Empty(t, indexDrift(collated, existing))
+
+	existing.Collation["strength"] = int32(3)
+	assert.Equal(t, []string{"collation differs"}, indexDrift(collated, existing))
+
+	existing.Collation = nil
+	assert.Equal(t, []string{"collation differs"}, indexDrift(collated, existing))
+
+	collated.Collation = nil
+	assert.Empty(t, indexDrift(collated, existing))
+
+	wildcard := IndexSpec{Keys: []IndexKey{{Field: "$**"}}, WildcardProjection: bson.M{"secret": 0}}
+	existingWildcard := existingIndex{
+		Name:               "$**_1",
+		Key:                bson.D{{Key: "$**", Value: int32(1)}},
+		WildcardProjection: bson.M{"secret": int32(0)},
+	}
+
+	assert.Empty(t, indexDrift(wildcard, existingWildcard))
+
+	existingWildcard.WildcardProjection = bson.M{"secret": int32(0), "token": int32(0)}
+	assert.Equal(t, []string{"wildcardProjection differs"}, indexDrift(wildcard, existingWildcard))
+}
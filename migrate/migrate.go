@@ -0,0 +1,501 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	mongo "github.com/luxation/go-mongo/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultCollection     = "_migrations"
+	defaultLockCollection = "_migrations_lock"
+	defaultLockTTL        = 5 * time.Minute
+	lockID                = "migrations"
+)
+
+var (
+	ErrLocked    = errors.New("migrations are locked by another process")
+	ErrLockLost  = errors.New("migrations lock was lost")
+	ErrNoDown    = errors.New("migration has no Down step")
+	ErrNoVersion = errors.New("migration version must be greater than 0")
+)
+
+// MigrationFunc receives a client scoped to ctx. When the migration runs in
+// a transaction, every call made through this client joins it.
+type MigrationFunc func(ctx context.Context, client mongo.Client) error
+
+type Migration struct {
+	Version     uint64
+	Description string
+	Up          MigrationFunc
+	Down        MigrationFunc
+}
+
+type Config struct {
+	// Collection stores the applied versions, defaults to "_migrations".
+	Collection string
+	// LockCollection stores the distributed lock, defaults to "_migrations_lock".
+	LockCollection string
+	// LockTTL is the time after which a lock left by a crashed process can be
+	// taken over, defaults to 5 minutes. The lock is refreshed before each step
+	// and every third of LockTTL while a step runs; a step whose lock is lost
+	// has its context cancelled and fails with ErrLockLost.
+	LockTTL time.Duration
+	// Owner identifies the process holding the lock, defaults to the hostname,
+	// the pid and a random suffix.
+	Owner string
+	// UseTransactions runs each step and the update of its record in a single
+	// transaction when the deployment is a replica set or a sharded cluster.
+	UseTransactions bool
+}
+
+type RunOptions struct {
+	// Target is the version to migrate to. Up applies the pending migrations
+	// up to and including Target, 0 meaning all of them. Down rolls back the
+	// applied migrations above Target, 0 meaning all of them.
+	Target uint64
+	// DryRun only reports the migrations which would run.
+	DryRun bool
+}
+
+// record is the document of an applied migration, stored in
+// Config.Collection.
+type record struct {
+	Version     uint64    `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+	collection  string
+}
+
+func (r *record) GetID() string        { return strconv.FormatUint(r.Version, 10) }
+func (r *record) SetID(uuid.UUID)      {}
+func (r *record) DocumentName() string { return r.collection }
+func (r *record) SetCreatedAt()        { r.AppliedAt = time.Now() }
+func (r *record) SetUpdatedAt()        {}
+
+// lockDocument is the distributed lock, stored in Config.LockCollection.
+type lockDocument struct {
+	ID         string    `bson:"_id"`
+	Owner      string    `bson:"owner"`
+	AcquiredAt time.Time `bson:"acquiredAt"`
+	ExpiresAt  time.Time `bson:"expiresAt"`
+	collection string
+}
+
+func (l *lockDocument) GetID() string        { return l.ID }
+func (l *lockDocument) SetID(id uuid.UUID)   { l.ID = id.String() }
+func (l *lockDocument) DocumentName() string { return l.collection }
+func (l *lockDocument) SetCreatedAt()        {}
+func (l *lockDocument) SetUpdatedAt()        {}
+
+// transactionSupporter is implemented by clients which know whether they
+// support transactions without asking a server, like mongotest.MemoryClient.
+type transactionSupporter interface {
+	SupportsTransactions() bool
+}
+
+type Migrator struct {
+	client     mongo.Client
+	config     Config
+	migrations []Migration
+}
+
+func NewMigrator(client mongo.Client, config Config, migrations ...Migration) (*Migrator, error) {
+	if config.Collection == "" {
+		config.Collection = defaultCollection
+	}
+
+	if config.LockCollection == "" {
+		config.LockCollection = defaultLockCollection
+	}
+
+	if config.LockTTL <= 0 {
+		config.LockTTL = defaultLockTTL
+	}
+
+	if config.Owner == "" {
+		hostname, _ := os.Hostname()
+		config.Owner = fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString())
+	}
+
+	m := &Migrator{
+		client: client,
+		config: config,
+	}
+
+	err := m.Register(migrations...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *Migrator) Register(migrations ...Migration) error {
+	versions := make(map[uint64]bool, len(m.migrations))
+
+	for _, migration := range m.migrations {
+		versions[migration.Version] = true
+	}
+
+	for _, migration := range migrations {
+		if migration.Version == 0 {
+			return ErrNoVersion
+		}
+
+		if migration.Up == nil {
+			return fmt.Errorf("migration %d has no Up step", migration.Version)
+		}
+
+		if versions[migration.Version] {
+			return fmt.Errorf("migration %d is registered twice", migration.Version)
+		}
+
+		versions[migration.Version] = true
+		m.migrations = append(m.migrations, migration)
+	}
+
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+
+	return nil
+}
+
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+func pending(migrations []Migration, applied map[uint64]bool, target uint64) []Migration {
+	var plan []Migration
+
+	for _, migration := range migrations {
+		if target != 0 && migration.Version > target {
+			break
+		}
+
+		if !applied[migration.Version] {
+			plan = append(plan, migration)
+		}
+	}
+
+	return plan
+}
+
+func rollbacks(migrations []Migration, applied map[uint64]bool, target uint64) []Migration {
+	var plan []Migration
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+
+		if migration.Version <= target {
+			break
+		}
+
+		if applied[migration.Version] {
+			plan = append(plan, migration)
+		}
+	}
+
+	return plan
+}
+
+// Applied returns the versions recorded as applied.
+func (m *Migrator) Applied(ctx context.Context) (map[uint64]bool, error) {
+	applied := make(map[uint64]bool)
+
+	err := m.client.WithContext(ctx).FindAll(m.records(), bson.M{}, func(cursor mongo.ResultCursor) error {
+		var r record
+
+		if err := cursor.Decode(&r); err != nil {
+			return err
+		}
+
+		applied[r.Version] = true
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Version returns the highest applied version, 0 when none was applied.
+func (m *Migrator) Version(ctx context.Context) (uint64, error) {
+	applied, err := m.Applied(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var version uint64
+
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+
+	return version, nil
+}
+
+// Up applies the pending migrations in ascending order and returns the ones
+// which ran, or would run in dry-run mode.
+func (m *Migrator) Up(ctx context.Context, opts RunOptions) ([]Migration, error) {
+	return m.run(ctx, opts, true)
+}
+
+// Down rolls back the applied migrations above opts.Target in descending
+// order and returns the ones which ran, or would run in dry-run mode.
+func (m *Migrator) Down(ctx context.Context, opts RunOptions) ([]Migration, error) {
+	return m.run(ctx, opts, false)
+}
+
+func (m *Migrator) run(ctx context.Context, opts RunOptions, up bool) ([]Migration, error) {
+	if !opts.DryRun {
+		err := m.lock(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer m.unlock(ctx)
+	}
+
+	applied, err := m.Applied(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []Migration
+
+	if up {
+		plan = pending(m.migrations, applied, opts.Target)
+	} else {
+		plan = rollbacks(m.migrations, applied, opts.Target)
+
+		for _, migration := range plan {
+			if migration.Down == nil {
+				return nil, fmt.Errorf("migration %d: %w", migration.Version, ErrNoDown)
+			}
+		}
+	}
+
+	if opts.DryRun {
+		return plan, nil
+	}
+
+	transactional := false
+
+	if m.config.UseTransactions {
+		transactional, err = m.supportsTransactions(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var done []Migration
+
+	for _, migration := range plan {
+		err = m.refreshLock(ctx)
+
+		if err != nil {
+			return done, err
+		}
+
+		err = m.locked(ctx, func(ctx context.Context) error {
+			return m.step(ctx, migration, up, transactional)
+		})
+
+		if err != nil {
+			return done, fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// locked runs fn while refreshing the lock in the background, so that steps
+// running longer than LockTTL keep it. The context of fn is cancelled when
+// the lock is lost, and ErrLockLost is returned.
+func (m *Migrator) locked(ctx context.Context, fn func(ctx context.Context) error) error {
+	stepCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lost := make(chan error, 1)
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(m.config.LockTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stepCtx.Done():
+				return
+			case <-ticker.C:
+				if err := m.refreshLock(ctx); err != nil {
+					lost <- err
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := fn(stepCtx)
+
+	cancel()
+	<-stopped
+
+	select {
+	case lockErr := <-lost:
+		return lockErr
+	default:
+		return err
+	}
+}
+
+func (m *Migrator) step(ctx context.Context, migration Migration, up bool, transactional bool) error {
+	apply := func(ctx context.Context) error {
+		client := m.client.WithContext(ctx)
+
+		if up {
+			err := migration.Up(ctx, client)
+
+			if err != nil {
+				return err
+			}
+
+			return m.save(ctx, migration)
+		}
+
+		err := migration.Down(ctx, client)
+
+		if err != nil {
+			return err
+		}
+
+		return m.forget(ctx, migration)
+	}
+
+	if transactional {
+		return m.client.WithTransaction(ctx, apply)
+	}
+
+	return apply(ctx)
+}
+
+func (m *Migrator) records() *record {
+	return &record{collection: m.config.Collection}
+}
+
+func (m *Migrator) save(ctx context.Context, migration Migration) error {
+	return m.client.WithContext(ctx).Persist(&record{
+		Version:     migration.Version,
+		Description: migration.Description,
+		collection:  m.config.Collection,
+	})
+}
+
+func (m *Migrator) forget(ctx context.Context, migration Migration) error {
+	_, err := m.client.WithContext(ctx).DeleteMany(m.records(), bson.M{"_id": migration.Version})
+
+	return err
+}
+
+func (m *Migrator) supportsTransactions(ctx context.Context) (bool, error) {
+	if supporter, ok := m.client.(transactionSupporter); ok {
+		return supporter.SupportsTransactions(), nil
+	}
+
+	client, err := m.client.GetClient()
+
+	if err != nil {
+		return false, err
+	}
+
+	var hello bson.M
+
+	err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello)
+
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := hello["setName"]; ok {
+		return true, nil
+	}
+
+	return hello["msg"] == "isdbgrid", nil
+}
+
+func (m *Migrator) lockDocument() *lockDocument {
+	return &lockDocument{collection: m.config.LockCollection}
+}
+
+// lock takes the distributed lock. The lock document can only be upserted
+// when it does not exist or has expired, any other process gets a duplicate
+// key error.
+func (m *Migrator) lock(ctx context.Context) error {
+	now := time.Now()
+
+	update := mongo.NewUpdate().
+		Set("owner", m.config.Owner).
+		Set("acquiredAt", now).
+		Set("expiresAt", now.Add(m.config.LockTTL))
+
+	err := m.client.WithContext(ctx).FindOneAndUpdate(m.lockDocument(), bson.M{
+		"_id":       lockID,
+		"expiresAt": bson.M{"$lt": now},
+	}, update, true, &mongo.FindAndModifyOptions{Upsert: true})
+
+	if errors.Is(err, mongo.ErrDuplicateKey) {
+		return ErrLocked
+	}
+
+	return err
+}
+
+func (m *Migrator) refreshLock(ctx context.Context) error {
+	res, err := m.client.WithContext(ctx).UpdateWhere(m.lockDocument(), bson.M{
+		"_id":   lockID,
+		"owner": m.config.Owner,
+	}, mongo.NewUpdate().Set("expiresAt", time.Now().Add(m.config.LockTTL)))
+
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrLockLost
+	}
+
+	return nil
+}
+
+func (m *Migrator) unlock(ctx context.Context) error {
+	_, err := m.client.WithContext(ctx).DeleteMany(m.lockDocument(), bson.M{
+		"_id":   lockID,
+		"owner": m.config.Owner,
+	})
+
+	return err
+}
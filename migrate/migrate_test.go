@@ -0,0 +1,282 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	mongo "github.com/luxation/go-mongo/v2"
+	"github.com/luxation/go-mongo/v2/mongotest"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+)
+
+type setting struct {
+	mongo.BasicDocument `bson:",inline"`
+	Value               string `bson:"value"`
+}
+
+func (s setting) DocumentName() string { return "settings" }
+
+func persistSetting(id string) MigrationFunc {
+	return func(ctx context.Context, client mongo.Client) error {
+		return client.Persist(&setting{BasicDocument: mongo.BasicDocument{ID: id}, Value: id})
+	}
+}
+
+func deleteSetting(id string) MigrationFunc {
+	return func(ctx context.Context, client mongo.Client) error {
+		_, err := client.DeleteMany(&setting{}, bson.M{"_id": id})
+		return err
+	}
+}
+
+func settings(t *testing.T, client mongo.Client) int64 {
+	count, err := client.Count(&setting{}, bson.M{})
+	assert.Nil(t, err)
+
+	return count
+}
+
+func noop(ctx context.Context, client mongo.Client) error {
+	return nil
+}
+
+func versions(migrations []Migration) []uint64 {
+	var res []uint64
+
+	for _, migration := range migrations {
+		res = append(res, migration.Version)
+	}
+
+	return res
+}
+
+func TestNewMigratorDefaults(t *testing.T) {
+	m, err := NewMigrator(nil, Config{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "_migrations", m.config.Collection)
+	assert.Equal(t, "_migrations_lock", m.config.LockCollection)
+	assert.Equal(t, 5*time.Minute, m.config.LockTTL)
+	assert.NotEmpty(t, m.config.Owner)
+}
+
+func TestRegisterSortsMigrations(t *testing.T) {
+	m, err := NewMigrator(nil, Config{},
+		Migration{Version: 3, Up: noop},
+		Migration{Version: 1, Up: noop},
+	)
+	assert.Nil(t, err)
+
+	err = m.Register(Migration{Version: 2, Up: noop})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []uint64{1, 2, 3}, versions(m.Migrations()))
+}
+
+func TestRegisterValidation(t *testing.T) {
+	_, err := NewMigrator(nil, Config{}, Migration{Up: noop})
+	assert.Equal(t, ErrNoVersion, err)
+
+	_, err = NewMigrator(nil, Config{}, Migration{Version: 1})
+	assert.EqualError(t, err, "migration 1 has no Up step")
+
+	_, err = NewMigrator(nil, Config{}, Migration{Version: 1, Up: noop}, Migration{Version: 1, Up: noop})
+	assert.EqualError(t, err, "migration 1 is registered twice")
+}
+
+func TestPlans(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Up: noop},
+		{Version: 2, Up: noop},
+		{Version: 3, Up: noop},
+		{Version: 4, Up: noop},
+	}
+
+	applied := map[uint64]bool{1: true, 3: true}
+
+	assert.Equal(t, []uint64{2, 4}, versions(pending(migrations, applied, 0)))
+	assert.Equal(t, []uint64{2}, versions(pending(migrations, applied, 3)))
+	assert.Nil(t, pending(migrations, applied, 1))
+
+	assert.Equal(t, []uint64{3, 1}, versions(rollbacks(migrations, applied, 0)))
+	assert.Equal(t, []uint64{3}, versions(rollbacks(migrations, applied, 2)))
+	assert.Nil(t, rollbacks(migrations, applied, 3))
+}
+
+func TestUpAndDown(t *testing.T) {
+	client := mongotest.NewMemoryClient()
+	ctx := context.Background()
+
+	m, err := NewMigrator(client, Config{},
+		Migration{Version: 1, Up: persistSetting("a"), Down: deleteSetting("a")},
+		Migration{Version: 2, Up: persistSetting("b"), Down: deleteSetting("b")},
+		Migration{Version: 3, Up: persistSetting("c"), Down: deleteSetting("c")},
+	)
+	assert.Nil(t, err)
+
+	done, err := m.Up(ctx, RunOptions{Target: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2}, versions(done))
+	assert.Equal(t, int64(2), settings(t, client))
+
+	done, err = m.Up(ctx, RunOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{3}, versions(done))
+
+	version, err := m.Version(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), version)
+
+	done, err = m.Down(ctx, RunOptions{Target: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{3, 2}, versions(done))
+	assert.Equal(t, int64(1), settings(t, client))
+
+	applied, err := m.Applied(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[uint64]bool{1: true}, applied)
+
+	exists, err := client.Exists(&lockDocument{collection: m.config.LockCollection}, bson.M{})
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestDownWithoutDownStep(t *testing.T) {
+	client := mongotest.NewMemoryClient()
+	ctx := context.Background()
+
+	m, err := NewMigrator(client, Config{}, Migration{Version: 1, Up: persistSetting("a")})
+	assert.Nil(t, err)
+
+	_, err = m.Up(ctx, RunOptions{})
+	assert.Nil(t, err)
+
+	_, err = m.Down(ctx, RunOptions{})
+	assert.True(t, errors.Is(err, ErrNoDown))
+	assert.Equal(t, int64(1), settings(t, client))
+}
+
+func TestDryRun(t *testing.T) {
+	client := mongotest.NewMemoryClient()
+	ctx := context.Background()
+
+	m, err := NewMigrator(client, Config{},
+		Migration{Version: 1, Up: persistSetting("a"), Down: deleteSetting("a")},
+		Migration{Version: 2, Up: persistSetting("b"), Down: deleteSetting("b")},
+	)
+	assert.Nil(t, err)
+
+	done, err := m.Up(ctx, RunOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2}, versions(done))
+	assert.Equal(t, int64(0), settings(t, client))
+
+	version, err := m.Version(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), version)
+
+	_, err = m.Up(ctx, RunOptions{})
+	assert.Nil(t, err)
+
+	done, err = m.Down(ctx, RunOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{2, 1}, versions(done))
+	assert.Equal(t, int64(2), settings(t, client))
+}
+
+func TestLockKeptDuringLongSteps(t *testing.T) {
+	client := mongotest.NewMemoryClient()
+	ctx := context.Background()
+	config := Config{LockTTL: 30 * time.Millisecond}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	first, err := NewMigrator(client, config, Migration{Version: 1, Up: func(ctx context.Context, client mongo.Client) error {
+		close(started)
+		<-release
+		return nil
+	}})
+	assert.Nil(t, err)
+
+	second, err := NewMigrator(client, config, Migration{Version: 1, Up: noop})
+	assert.Nil(t, err)
+
+	errs := make(chan error, 1)
+
+	go func() {
+		_, err := first.Up(ctx, RunOptions{})
+		errs <- err
+	}()
+
+	<-started
+	time.Sleep(4 * config.LockTTL)
+
+	_, err = second.Up(ctx, RunOptions{})
+	assert.Equal(t, ErrLocked, err)
+
+	close(release)
+	assert.Nil(t, <-errs)
+
+	done, err := second.Up(ctx, RunOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, done)
+}
+
+func TestLockLostAbortsStep(t *testing.T) {
+	client := mongotest.NewMemoryClient()
+	ctx := context.Background()
+
+	var m *Migrator
+
+	m, err := NewMigrator(client, Config{LockTTL: 30 * time.Millisecond}, Migration{Version: 1, Up: func(ctx context.Context, client mongo.Client) error {
+		_, err := client.DeleteMany(m.lockDocument(), bson.M{})
+
+		if err != nil {
+			return err
+		}
+
+		<-ctx.Done()
+
+		return ctx.Err()
+	}})
+	assert.Nil(t, err)
+
+	_, err = m.Up(ctx, RunOptions{})
+	assert.True(t, errors.Is(err, ErrLockLost))
+
+	version, err := m.Version(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), version)
+}
+
+func TestTransactionalStepRollsBack(t *testing.T) {
+	client := mongotest.NewMemoryClient()
+	ctx := context.Background()
+	failure := errors.New("failure")
+
+	m, err := NewMigrator(client, Config{UseTransactions: true},
+		Migration{Version: 1, Up: persistSetting("a")},
+		Migration{Version: 2, Up: func(ctx context.Context, client mongo.Client) error {
+			err := persistSetting("b")(ctx, client)
+
+			if err != nil {
+				return err
+			}
+
+			return failure
+		}},
+	)
+	assert.Nil(t, err)
+
+	done, err := m.Up(ctx, RunOptions{})
+	assert.True(t, errors.Is(err, failure))
+	assert.Equal(t, []uint64{1}, versions(done))
+	assert.Equal(t, int64(1), settings(t, client))
+
+	applied, err := m.Applied(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, map[uint64]bool{1: true}, applied)
+}
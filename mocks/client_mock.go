@@ -13,6 +13,7 @@ import (
 	mongo "github.com/luxation/go-mongo/v2"
 	primitive "go.mongodb.org/mongo-driver/bson/primitive"
 	mongo0 "go.mongodb.org/mongo-driver/mongo"
+	options "go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // MockClient is a mock of Client interface.
@@ -38,6 +39,90 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 	return m.recorder
 }
 
+// Aggregate mocks base method.
+func (m *MockClient) Aggregate(arg0 mongo.Document, arg1 primitive.A, arg2 mongo.ResultDecoder, arg3 ...*options.AggregateOptions) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1, arg2}
+	for _, a := range arg3 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Aggregate", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Aggregate indicates an expected call of Aggregate.
+func (mr *MockClientMockRecorder) Aggregate(arg0, arg1, arg2 interface{}, arg3 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1, arg2}, arg3...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Aggregate", reflect.TypeOf((*MockClient)(nil).Aggregate), varargs...)
+}
+
+// AggregateStream mocks base method.
+func (m *MockClient) AggregateStream(arg0 mongo.Document, arg1 primitive.A, arg2 ...*options.AggregateOptions) (mongo.Stream, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "AggregateStream", varargs...)
+	ret0, _ := ret[0].(mongo.Stream)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AggregateStream indicates an expected call of AggregateStream.
+func (mr *MockClientMockRecorder) AggregateStream(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AggregateStream", reflect.TypeOf((*MockClient)(nil).AggregateStream), varargs...)
+}
+
+// ApplyJSONPatch mocks base method.
+func (m *MockClient) ApplyJSONPatch(arg0 mongo.Document, arg1 string, arg2 []mongo.PatchOperation) (*mongo.UpdateResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ApplyJSONPatch", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*mongo.UpdateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ApplyJSONPatch indicates an expected call of ApplyJSONPatch.
+func (mr *MockClientMockRecorder) ApplyJSONPatch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApplyJSONPatch", reflect.TypeOf((*MockClient)(nil).ApplyJSONPatch), arg0, arg1, arg2)
+}
+
+// ApplyMergePatch mocks base method.
+func (m *MockClient) ApplyMergePatch(arg0 mongo.Document, arg1 string, arg2 []byte) (*mongo.UpdateResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ApplyMergePatch", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*mongo.UpdateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ApplyMergePatch indicates an expected call of ApplyMergePatch.
+func (mr *MockClientMockRecorder) ApplyMergePatch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApplyMergePatch", reflect.TypeOf((*MockClient)(nil).ApplyMergePatch), arg0, arg1, arg2)
+}
+
+// BulkWrite mocks base method.
+func (m *MockClient) BulkWrite(arg0 *mongo.BulkWriteBuilder) (*mongo.BulkWriteResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BulkWrite", arg0)
+	ret0, _ := ret[0].(*mongo.BulkWriteResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BulkWrite indicates an expected call of BulkWrite.
+func (mr *MockClientMockRecorder) BulkWrite(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BulkWrite", reflect.TypeOf((*MockClient)(nil).BulkWrite), arg0)
+}
+
 // Connect mocks base method.
 func (m *MockClient) Connect() error {
 	m.ctrl.T.Helper()
@@ -52,6 +137,21 @@ func (mr *MockClientMockRecorder) Connect() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Connect", reflect.TypeOf((*MockClient)(nil).Connect))
 }
 
+// Count mocks base method.
+func (m *MockClient) Count(arg0 mongo.Document, arg1 primitive.M) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Count", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Count indicates an expected call of Count.
+func (mr *MockClientMockRecorder) Count(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Count", reflect.TypeOf((*MockClient)(nil).Count), arg0, arg1)
+}
+
 // Delete mocks base method.
 func (m *MockClient) Delete(arg0 mongo.Document) error {
 	m.ctrl.T.Helper()
@@ -66,6 +166,21 @@ func (mr *MockClientMockRecorder) Delete(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockClient)(nil).Delete), arg0)
 }
 
+// DeleteMany mocks base method.
+func (m *MockClient) DeleteMany(arg0 mongo.Document, arg1 primitive.M) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMany", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMany indicates an expected call of DeleteMany.
+func (mr *MockClientMockRecorder) DeleteMany(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMany", reflect.TypeOf((*MockClient)(nil).DeleteMany), arg0, arg1)
+}
+
 // DeleteWhere mocks base method.
 func (m *MockClient) DeleteWhere(arg0 mongo.Document, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
@@ -94,6 +209,71 @@ func (mr *MockClientMockRecorder) Disconnect() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Disconnect", reflect.TypeOf((*MockClient)(nil).Disconnect))
 }
 
+// Distinct mocks base method.
+func (m *MockClient) Distinct(arg0 mongo.Document, arg1 string, arg2 primitive.M) ([]interface{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Distinct", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]interface{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Distinct indicates an expected call of Distinct.
+func (mr *MockClientMockRecorder) Distinct(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Distinct", reflect.TypeOf((*MockClient)(nil).Distinct), arg0, arg1, arg2)
+}
+
+// EnsureIndexes mocks base method.
+func (m *MockClient) EnsureIndexes(arg0 *mongo.EnsureIndexesOptions, arg1 ...mongo.Document) (*mongo.IndexReport, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "EnsureIndexes", varargs...)
+	ret0, _ := ret[0].(*mongo.IndexReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnsureIndexes indicates an expected call of EnsureIndexes.
+func (mr *MockClientMockRecorder) EnsureIndexes(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureIndexes", reflect.TypeOf((*MockClient)(nil).EnsureIndexes), varargs...)
+}
+
+// EstimatedCount mocks base method.
+func (m *MockClient) EstimatedCount(arg0 mongo.Document) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EstimatedCount", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EstimatedCount indicates an expected call of EstimatedCount.
+func (mr *MockClientMockRecorder) EstimatedCount(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EstimatedCount", reflect.TypeOf((*MockClient)(nil).EstimatedCount), arg0)
+}
+
+// Exists mocks base method.
+func (m *MockClient) Exists(arg0 mongo.Document, arg1 primitive.M) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Exists", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Exists indicates an expected call of Exists.
+func (mr *MockClientMockRecorder) Exists(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockClient)(nil).Exists), arg0, arg1)
+}
+
 // FindAll mocks base method.
 func (m *MockClient) FindAll(arg0 mongo.Document, arg1 primitive.M, arg2 mongo.ResultDecoder, arg3 ...*mongo.FindOptions) error {
 	m.ctrl.T.Helper()
@@ -132,6 +312,44 @@ func (mr *MockClientMockRecorder) FindOne(arg0, arg1 interface{}, arg2 ...interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOne", reflect.TypeOf((*MockClient)(nil).FindOne), varargs...)
 }
 
+// FindOneAndDelete mocks base method.
+func (m *MockClient) FindOneAndDelete(arg0 mongo.Document, arg1 primitive.M, arg2 ...*mongo.FindAndModifyOptions) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "FindOneAndDelete", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FindOneAndDelete indicates an expected call of FindOneAndDelete.
+func (mr *MockClientMockRecorder) FindOneAndDelete(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOneAndDelete", reflect.TypeOf((*MockClient)(nil).FindOneAndDelete), varargs...)
+}
+
+// FindOneAndUpdate mocks base method.
+func (m *MockClient) FindOneAndUpdate(arg0 mongo.Document, arg1 primitive.M, arg2 interface{}, arg3 bool, arg4 ...*mongo.FindAndModifyOptions) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1, arg2, arg3}
+	for _, a := range arg4 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "FindOneAndUpdate", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FindOneAndUpdate indicates an expected call of FindOneAndUpdate.
+func (mr *MockClientMockRecorder) FindOneAndUpdate(arg0, arg1, arg2, arg3 interface{}, arg4 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1, arg2, arg3}, arg4...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOneAndUpdate", reflect.TypeOf((*MockClient)(nil).FindOneAndUpdate), varargs...)
+}
+
 // FindOneById mocks base method.
 func (m *MockClient) FindOneById(arg0 mongo.Document, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -146,6 +364,46 @@ func (mr *MockClientMockRecorder) FindOneById(arg0, arg1 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOneById", reflect.TypeOf((*MockClient)(nil).FindOneById), arg0, arg1)
 }
 
+// FindPage mocks base method.
+func (m *MockClient) FindPage(arg0 mongo.Document, arg1 primitive.M, arg2 mongo.ResultDecoder, arg3 ...*mongo.FindOptions) (*mongo.PageInfo, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1, arg2}
+	for _, a := range arg3 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "FindPage", varargs...)
+	ret0, _ := ret[0].(*mongo.PageInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindPage indicates an expected call of FindPage.
+func (mr *MockClientMockRecorder) FindPage(arg0, arg1, arg2 interface{}, arg3 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1, arg2}, arg3...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindPage", reflect.TypeOf((*MockClient)(nil).FindPage), varargs...)
+}
+
+// FindStream mocks base method.
+func (m *MockClient) FindStream(arg0 mongo.Document, arg1 primitive.M, arg2 ...*mongo.FindOptions) (mongo.Stream, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "FindStream", varargs...)
+	ret0, _ := ret[0].(mongo.Stream)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindStream indicates an expected call of FindStream.
+func (mr *MockClientMockRecorder) FindStream(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindStream", reflect.TypeOf((*MockClient)(nil).FindStream), varargs...)
+}
+
 // GenerateUUID mocks base method.
 func (m *MockClient) GenerateUUID() uuid.UUID {
 	m.ctrl.T.Helper()
@@ -160,6 +418,21 @@ func (mr *MockClientMockRecorder) GenerateUUID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateUUID", reflect.TypeOf((*MockClient)(nil).GenerateUUID))
 }
 
+// GetClient mocks base method.
+func (m *MockClient) GetClient() (*mongo0.Client, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClient")
+	ret0, _ := ret[0].(*mongo0.Client)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClient indicates an expected call of GetClient.
+func (mr *MockClientMockRecorder) GetClient() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClient", reflect.TypeOf((*MockClient)(nil).GetClient))
+}
+
 // GetCollection mocks base method.
 func (m *MockClient) GetCollection(arg0 mongo.Document) (*mongo0.Collection, error) {
 	m.ctrl.T.Helper()
@@ -232,6 +505,20 @@ func (mr *MockClientMockRecorder) Persist(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Persist", reflect.TypeOf((*MockClient)(nil).Persist), arg0)
 }
 
+// PersistMany mocks base method.
+func (m *MockClient) PersistMany(arg0 []mongo.Document) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PersistMany", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PersistMany indicates an expected call of PersistMany.
+func (mr *MockClientMockRecorder) PersistMany(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PersistMany", reflect.TypeOf((*MockClient)(nil).PersistMany), arg0)
+}
+
 // Replace mocks base method.
 func (m *MockClient) Replace(arg0 mongo.Document) error {
 	m.ctrl.T.Helper()
@@ -246,12 +533,28 @@ func (mr *MockClientMockRecorder) Replace(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replace", reflect.TypeOf((*MockClient)(nil).Replace), arg0)
 }
 
+// ReplaceMany mocks base method.
+func (m *MockClient) ReplaceMany(arg0 []mongo.Document) (*mongo.BulkWriteResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceMany", arg0)
+	ret0, _ := ret[0].(*mongo.BulkWriteResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReplaceMany indicates an expected call of ReplaceMany.
+func (mr *MockClientMockRecorder) ReplaceMany(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceMany", reflect.TypeOf((*MockClient)(nil).ReplaceMany), arg0)
+}
+
 // ReplaceOrPersist mocks base method.
-func (m *MockClient) ReplaceOrPersist(arg0 mongo.Document) error {
+func (m *MockClient) ReplaceOrPersist(arg0 mongo.Document) (bool, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "ReplaceOrPersist", arg0)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // ReplaceOrPersist indicates an expected call of ReplaceOrPersist.
@@ -261,11 +564,12 @@ func (mr *MockClientMockRecorder) ReplaceOrPersist(arg0 interface{}) *gomock.Cal
 }
 
 // Update mocks base method.
-func (m *MockClient) Update(arg0 mongo.Document, arg1 string, arg2 interface{}) error {
+func (m *MockClient) Update(arg0 mongo.Document, arg1 string, arg2 interface{}) (*mongo.UpdateResult, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Update", arg0, arg1, arg2)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*mongo.UpdateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Update indicates an expected call of Update.
@@ -275,11 +579,12 @@ func (mr *MockClientMockRecorder) Update(arg0, arg1, arg2 interface{}) *gomock.C
 }
 
 // UpdateMany mocks base method.
-func (m *MockClient) UpdateMany(arg0 mongo.Document, arg1 primitive.M, arg2 interface{}) error {
+func (m *MockClient) UpdateMany(arg0 mongo.Document, arg1 primitive.M, arg2 interface{}) (*mongo.UpdateResult, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "UpdateMany", arg0, arg1, arg2)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*mongo.UpdateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // UpdateMany indicates an expected call of UpdateMany.
@@ -289,11 +594,12 @@ func (mr *MockClientMockRecorder) UpdateMany(arg0, arg1, arg2 interface{}) *gomo
 }
 
 // UpdateWhere mocks base method.
-func (m *MockClient) UpdateWhere(arg0 mongo.Document, arg1 primitive.M, arg2 interface{}) error {
+func (m *MockClient) UpdateWhere(arg0 mongo.Document, arg1 primitive.M, arg2 interface{}) (*mongo.UpdateResult, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "UpdateWhere", arg0, arg1, arg2)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*mongo.UpdateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // UpdateWhere indicates an expected call of UpdateWhere.
@@ -315,3 +621,17 @@ func (mr *MockClientMockRecorder) WithContext(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithContext", reflect.TypeOf((*MockClient)(nil).WithContext), arg0)
 }
+
+// WithTransaction mocks base method.
+func (m *MockClient) WithTransaction(arg0 context.Context, arg1 func(context.Context) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithTransaction", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithTransaction indicates an expected call of WithTransaction.
+func (mr *MockClientMockRecorder) WithTransaction(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithTransaction", reflect.TypeOf((*MockClient)(nil).WithTransaction), arg0, arg1)
+}
@@ -3,11 +3,15 @@ package mongo
 import (
 	"errors"
 	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"strings"
 )
 
 type OrderType int
 
+const textScoreMeta = "textScore"
+
 const (
 	OrderASC  OrderType = 1
 	OrderDESC OrderType = -1
@@ -29,16 +33,214 @@ type ConnectionOptions struct {
 type FindOptions struct {
 	Sort       []SortOption
 	Pagination *PaginationOption
+	Projection []ProjectionOption
+	Collation  *options.Collation
 }
 
+// SortOption orders the results by SortField. When TextScore is set, the
+// results are ordered by the relevance of a $text query instead of Order.
 type SortOption struct {
 	SortField string
 	Order     OrderType
+	TextScore bool
+}
+
+// FindAndModifyOptions selects and shapes the document returned by
+// FindOneAndUpdate and FindOneAndDelete. Sort picks the document to modify
+// when several match. Upsert only applies to FindOneAndUpdate.
+type FindAndModifyOptions struct {
+	Sort       []SortOption
+	Projection []ProjectionOption
+	Upsert     bool
+}
+
+func (o *FindAndModifyOptions) findOptions() *FindOptions {
+	if o == nil {
+		return &FindOptions{}
+	}
+
+	return &FindOptions{
+		Sort:       o.Sort,
+		Projection: o.Projection,
+	}
 }
 
+// DefaultMaxSkip is the largest number of documents FindPage skips when
+// PaginationOption.MaxSkip is not set.
+const DefaultMaxSkip = 10000
+
+// PaginationOption limits the number of results. Cursor is a PageInfo
+// cursor returned by FindPage, selecting the page to read next.
+//
+// Skip or Page, counted from 1, make FindPage read pages by offset and
+// report the total count instead. The other finds skip as many documents.
+// Skipping costs a scan of the skipped documents, so offsets above MaxSkip
+// are rejected.
+//
+// LastID only keeps the documents whose _id is greater, regardless of Sort.
+// Deprecated: use FindPage and Cursor instead.
 type PaginationOption struct {
-	Limit  *int64
-	LastID string
+	Limit   *int64
+	Cursor  string
+	Skip    int64
+	Page    int64
+	MaxSkip int64
+	LastID  string
+}
+
+// Offset returns the number of documents skipped before the first result,
+// given by Skip or by Page and Limit. Cursors are only read by FindPage, so
+// Offset fails when one is set.
+func (p *PaginationOption) Offset() (int64, error) {
+	if p == nil {
+		return 0, nil
+	}
+
+	if p.Cursor != "" {
+		return 0, fmt.Errorf("%w: cursors are only read by FindPage", ErrInvalidCursor)
+	}
+
+	if p.Skip < 0 || p.Page < 0 {
+		return 0, errors.New("pagination skip and page cannot be negative")
+	}
+
+	if p.Skip != 0 && p.Page != 0 {
+		return 0, errors.New("pagination skip and page cannot be combined")
+	}
+
+	skip := p.Skip
+
+	if p.Page > 0 {
+		if p.Limit == nil || *p.Limit <= 0 {
+			return 0, errors.New("pagination limit must be set")
+		}
+
+		skip = (p.Page - 1) * *p.Limit
+	}
+
+	maxSkip := p.MaxSkip
+
+	if maxSkip <= 0 {
+		maxSkip = DefaultMaxSkip
+	}
+
+	if skip > maxSkip {
+		return 0, fmt.Errorf("%w: %d > %d", ErrSkipTooLarge, skip, maxSkip)
+	}
+
+	return skip, nil
+}
+
+// ProjectionOption includes Field in the returned documents, or excludes it
+// when Exclude is set. Slice and ElemMatch restrict the elements returned
+// for an array field instead. Documents decoded from a projection only hold
+// the selected fields, so they should not be passed to Replace.
+type ProjectionOption struct {
+	Field     string
+	Exclude   bool
+	Slice     *SliceOption
+	ElemMatch bson.M
+	TextScore bool
+}
+
+// SliceOption returns Limit elements of an array after skipping Skip ones.
+// A negative Skip counts from the end of the array, and without Skip a
+// negative Limit returns the last elements.
+type SliceOption struct {
+	Skip  int64
+	Limit int64
+}
+
+// SortDocument returns the sort specification sent to MongoDB, keeping the
+// declared order of the fields, or nil when no sort is set.
+func (o *FindOptions) SortDocument() bson.D {
+	if o == nil || len(o.Sort) == 0 {
+		return nil
+	}
+
+	sort := make(bson.D, 0, len(o.Sort))
+
+	for _, s := range o.Sort {
+		var value interface{} = s.Order
+
+		if s.TextScore {
+			value = bson.M{"$meta": textScoreMeta}
+		}
+
+		sort = append(sort, bson.E{Key: s.SortField, Value: value})
+	}
+
+	return sort
+}
+
+// ParseSort parses a comma separated list of fields such as
+// "-createdAt,name", where a leading "-" sorts the field in descending order
+// and an optional "+" in ascending order.
+func ParseSort(s string) ([]SortOption, error) {
+	var sort []SortOption
+
+	if strings.TrimSpace(s) == "" {
+		return sort, nil
+	}
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+
+		order := OrderASC
+
+		switch {
+		case strings.HasPrefix(field, "-"):
+			order = OrderDESC
+			field = field[1:]
+		case strings.HasPrefix(field, "+"):
+			field = field[1:]
+		}
+
+		if field == "" || strings.ContainsAny(field[:1], "$.+-") || strings.HasSuffix(field, ".") ||
+			strings.Contains(field, "..") || strings.ContainsAny(field, " \t") {
+			return nil, fmt.Errorf("invalid sort field %q", field)
+		}
+
+		sort = append(sort, SortOption{
+			SortField: field,
+			Order:     order,
+		})
+	}
+
+	return sort, nil
+}
+
+// ProjectionDocument returns the projection sent to MongoDB, or nil when no
+// projection is set.
+func (o *FindOptions) ProjectionDocument() bson.D {
+	if o == nil || len(o.Projection) == 0 {
+		return nil
+	}
+
+	projection := make(bson.D, 0, len(o.Projection))
+
+	for _, p := range o.Projection {
+		var value interface{}
+
+		switch {
+		case p.TextScore:
+			value = bson.M{"$meta": textScoreMeta}
+		case p.ElemMatch != nil:
+			value = bson.M{"$elemMatch": p.ElemMatch}
+		case p.Slice != nil && p.Slice.Skip != 0:
+			value = bson.M{"$slice": bson.A{p.Slice.Skip, p.Slice.Limit}}
+		case p.Slice != nil:
+			value = bson.M{"$slice": p.Slice.Limit}
+		case p.Exclude:
+			value = 0
+		default:
+			value = 1
+		}
+
+		projection = append(projection, bson.E{Key: p.Field, Value: value})
+	}
+
+	return projection
 }
 
 func (c *ConnectionOptions) generateParams() string {
@@ -63,14 +265,21 @@ func (c *ConnectionOptions) generateParams() string {
 	return strings.Join(params, "&")
 }
 
+// ClientConfig describes how to reach the database. StrictUpdates makes
+// Update return ErrNotFound when no document has the given id.
+// NamingStrategy keys the fields of documents and updates, BsonTagNaming
+// when nil. NullPolicy decides how the explicit nulls of updates are sent.
 type ClientConfig struct {
-	Host         string
-	Port         uint
-	Database     string
-	Clustered    bool
-	DBNameInPath bool
-	Credentials  *CredentialConfig
-	Options      *ConnectionOptions
+	Host           string
+	Port           uint
+	Database       string
+	Clustered      bool
+	DBNameInPath   bool
+	Credentials    *CredentialConfig
+	Options        *ConnectionOptions
+	StrictUpdates  bool
+	NamingStrategy *NamingStrategy
+	NullPolicy     NullPolicy
 }
 
 func (c *ClientConfig) generateURI() (string, error) {
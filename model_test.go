@@ -2,6 +2,7 @@ package mongo
 
 import (
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 	"testing"
 )
 
@@ -238,3 +239,84 @@ func TestUriGeneration(t *testing.T) {
 		}
 	}
 }
+
+func TestProjectionDocument(t *testing.T) {
+	var empty *FindOptions
+	assert.Nil(t, empty.ProjectionDocument())
+	assert.Nil(t, (&FindOptions{}).ProjectionDocument())
+
+	findOptions := &FindOptions{
+		Projection: []ProjectionOption{
+			{Field: "name"},
+			{Field: "_id", Exclude: true},
+			{Field: "comments", Slice: &SliceOption{Limit: -5}},
+			{Field: "history", Slice: &SliceOption{Skip: 10, Limit: 5}},
+			{Field: "orders", ElemMatch: bson.M{"status": "open"}},
+		},
+	}
+
+	assert.Equal(t, bson.D{
+		{Key: "name", Value: 1},
+		{Key: "_id", Value: 0},
+		{Key: "comments", Value: bson.M{"$slice": int64(-5)}},
+		{Key: "history", Value: bson.M{"$slice": bson.A{int64(10), int64(5)}}},
+		{Key: "orders", Value: bson.M{"$elemMatch": bson.M{"status": "open"}}},
+	}, findOptions.ProjectionDocument())
+}
+
+func TestSortDocument(t *testing.T) {
+	assert.Nil(t, (&FindOptions{}).SortDocument())
+
+	findOptions := &FindOptions{
+		Sort: []SortOption{
+			{SortField: "status", Order: OrderASC},
+			{SortField: "createdAt", Order: OrderDESC},
+			{SortField: "score", TextScore: true},
+		},
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, bson.D{
+			{Key: "status", Value: OrderASC},
+			{Key: "createdAt", Value: OrderDESC},
+			{Key: "score", Value: bson.M{"$meta": "textScore"}},
+		}, findOptions.SortDocument())
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		input  string
+		output []SortOption
+		err    bool
+	}{
+		{input: "", output: nil},
+		{input: "name", output: []SortOption{{SortField: "name", Order: OrderASC}}},
+		{
+			input: "-createdAt, +name,address.city",
+			output: []SortOption{
+				{SortField: "createdAt", Order: OrderDESC},
+				{SortField: "name", Order: OrderASC},
+				{SortField: "address.city", Order: OrderASC},
+			},
+		},
+		{input: "name,", err: true},
+		{input: "-", err: true},
+		{input: "--name", err: true},
+		{input: "$where", err: true},
+		{input: "address..city", err: true},
+		{input: "first name", err: true},
+	}
+
+	for _, test := range tests {
+		sort, err := ParseSort(test.input)
+
+		if test.err {
+			assert.NotNil(t, err, test.input)
+			continue
+		}
+
+		assert.Nil(t, err, test.input)
+		assert.Equal(t, test.output, sort, test.input)
+	}
+}
@@ -0,0 +1,537 @@
+package mongotest
+
+import (
+	"bytes"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// normalize round-trips v through BSON so that filters, updates and stored
+// documents share the same representation: bson.D for documents, bson.A for
+// arrays, int32/int64/float64 for numbers and primitive.DateTime for dates.
+func normalize(v interface{}) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+
+	raw, err := bson.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var d bson.D
+
+	err = bson.Unmarshal(raw, &d)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func lookupKey(d bson.D, key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// resolve returns the values reachable through the dotted path parts. Arrays
+// of documents are traversed element by element, and numeric parts index
+// into arrays, as MongoDB does when evaluating queries.
+func resolve(v interface{}, parts []string) []interface{} {
+	if len(parts) == 0 {
+		return []interface{}{v}
+	}
+
+	switch value := v.(type) {
+	case bson.D:
+		child, ok := lookupKey(value, parts[0])
+
+		if !ok {
+			return nil
+		}
+
+		return resolve(child, parts[1:])
+	case bson.A:
+		var values []interface{}
+
+		if index, err := strconv.Atoi(parts[0]); err == nil {
+			if index >= 0 && index < len(value) {
+				values = append(values, resolve(value[index], parts[1:])...)
+			}
+		}
+
+		for _, item := range value {
+			if _, ok := item.(bson.D); ok {
+				values = append(values, resolve(item, parts)...)
+			}
+		}
+
+		return values
+	}
+
+	return nil
+}
+
+func lookupPath(d bson.D, path string) []interface{} {
+	return resolve(d, strings.Split(path, "."))
+}
+
+// candidates expands array values so that a condition matches an array
+// either as a whole or through any of its elements.
+func candidates(values []interface{}) []interface{} {
+	var res []interface{}
+
+	for _, v := range values {
+		res = append(res, v)
+
+		if arr, ok := v.(bson.A); ok {
+			res = append(res, arr...)
+		}
+	}
+
+	return res
+}
+
+func matches(doc bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		ok, err := matchElement(doc, e)
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchElement(doc bson.D, e bson.E) (bool, error) {
+	switch e.Key {
+	case "$and", "$or", "$nor":
+		clauses, ok := e.Value.(bson.A)
+
+		if !ok {
+			return false, fmt.Errorf("%s expects an array", e.Key)
+		}
+
+		for _, clause := range clauses {
+			sub, ok := clause.(bson.D)
+
+			if !ok {
+				return false, fmt.Errorf("%s expects an array of documents", e.Key)
+			}
+
+			res, err := matches(doc, sub)
+
+			if err != nil {
+				return false, err
+			}
+
+			switch {
+			case e.Key == "$and" && !res:
+				return false, nil
+			case e.Key == "$or" && res:
+				return true, nil
+			case e.Key == "$nor" && res:
+				return false, nil
+			}
+		}
+
+		return e.Key != "$or", nil
+	case "$comment":
+		return true, nil
+	}
+
+	if strings.HasPrefix(e.Key, "$") {
+		return false, fmt.Errorf("unsupported top level operator %s", e.Key)
+	}
+
+	return matchCondition(lookupPath(doc, e.Key), e.Value)
+}
+
+func isOperatorDocument(v interface{}) (bson.D, bool) {
+	d, ok := v.(bson.D)
+
+	if !ok || len(d) == 0 {
+		return nil, false
+	}
+
+	return d, strings.HasPrefix(d[0].Key, "$")
+}
+
+func matchCondition(values []interface{}, condition interface{}) (bool, error) {
+	if regex, ok := condition.(primitive.Regex); ok {
+		return matchRegex(values, regex.Pattern, regex.Options)
+	}
+
+	operators, ok := isOperatorDocument(condition)
+
+	if !ok {
+		return matchEquality(values, condition), nil
+	}
+
+	for _, op := range operators {
+		res, err := matchOperator(values, op, operators)
+
+		if err != nil || !res {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchEquality(values []interface{}, expected interface{}) bool {
+	if expected == nil && len(values) == 0 {
+		return true
+	}
+
+	for _, v := range candidates(values) {
+		if equal(v, expected) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchOperator(values []interface{}, op bson.E, siblings bson.D) (bool, error) {
+	switch op.Key {
+	case "$eq":
+		return matchEquality(values, op.Value), nil
+	case "$ne":
+		return !matchEquality(values, op.Value), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, v := range candidates(values) {
+			cmp, ok := compareSameType(v, op.Value)
+
+			if !ok {
+				continue
+			}
+
+			if (op.Key == "$gt" && cmp > 0) || (op.Key == "$gte" && cmp >= 0) ||
+				(op.Key == "$lt" && cmp < 0) || (op.Key == "$lte" && cmp <= 0) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	case "$in", "$nin":
+		list, ok := op.Value.(bson.A)
+
+		if !ok {
+			return false, fmt.Errorf("%s expects an array", op.Key)
+		}
+
+		found := false
+
+		for _, expected := range list {
+			if regex, ok := expected.(primitive.Regex); ok {
+				res, err := matchRegex(values, regex.Pattern, regex.Options)
+
+				if err != nil {
+					return false, err
+				}
+
+				found = found || res
+				continue
+			}
+
+			if matchEquality(values, expected) {
+				found = true
+			}
+		}
+
+		return found == (op.Key == "$in"), nil
+	case "$exists":
+		exists := len(values) > 0
+		return exists == truthy(op.Value), nil
+	case "$regex":
+		pattern, options := "", ""
+
+		switch regex := op.Value.(type) {
+		case string:
+			pattern = regex
+		case primitive.Regex:
+			pattern, options = regex.Pattern, regex.Options
+		default:
+			return false, fmt.Errorf("$regex expects a string")
+		}
+
+		if opts, ok := lookupKey(siblings, "$options"); ok {
+			options, _ = opts.(string)
+		}
+
+		return matchRegex(values, pattern, options)
+	case "$options":
+		return true, nil
+	case "$not":
+		res, err := matchCondition(values, op.Value)
+		return !res, err
+	case "$size":
+		size, ok := toFloat(op.Value)
+
+		if !ok {
+			return false, fmt.Errorf("$size expects a number")
+		}
+
+		for _, v := range values {
+			if arr, ok := v.(bson.A); ok && float64(len(arr)) == size {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	case "$all":
+		list, ok := op.Value.(bson.A)
+
+		if !ok {
+			return false, fmt.Errorf("$all expects an array")
+		}
+
+		for _, expected := range list {
+			if !matchEquality(values, expected) {
+				return false, nil
+			}
+		}
+
+		return len(list) > 0, nil
+	case "$elemMatch":
+		sub, ok := op.Value.(bson.D)
+
+		if !ok {
+			return false, fmt.Errorf("$elemMatch expects a document")
+		}
+
+		for _, v := range values {
+			arr, ok := v.(bson.A)
+
+			if !ok {
+				continue
+			}
+
+			for _, item := range arr {
+				var res bool
+				var err error
+
+				if _, isOperator := isOperatorDocument(sub); isOperator {
+					res, err = matchCondition([]interface{}{item}, sub)
+				} else if itemDoc, isDoc := item.(bson.D); isDoc {
+					res, err = matches(itemDoc, sub)
+				}
+
+				if err != nil {
+					return false, err
+				}
+
+				if res {
+					return true, nil
+				}
+			}
+		}
+
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unsupported query operator %s", op.Key)
+}
+
+func matchRegex(values []interface{}, pattern, options string) (bool, error) {
+	flags := ""
+
+	for _, o := range options {
+		switch o {
+		case 'i', 'm', 's':
+			flags += string(o)
+		}
+	}
+
+	if flags != "" {
+		pattern = fmt.Sprintf("(?%s)%s", flags, pattern)
+	}
+
+	re, err := regexp.Compile(pattern)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, v := range candidates(values) {
+		if s, ok := v.(string); ok && re.MatchString(s) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func truthy(v interface{}) bool {
+	switch value := v.(type) {
+	case bool:
+		return value
+	case nil:
+		return false
+	}
+
+	if f, ok := toFloat(v); ok {
+		return f != 0
+	}
+
+	return true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+
+	return 0, false
+}
+
+// typeRank orders values of different types the way MongoDB sorts them.
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return 1
+	case int32, int64, int, float64, float32:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.D:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	}
+
+	return 12
+}
+
+// compareSameType compares values of the same type class, as range
+// operators do. The boolean is false when the values are not comparable.
+func compareSameType(a, b interface{}) (int, bool) {
+	if typeRank(a) != typeRank(b) {
+		return 0, false
+	}
+
+	return compare(a, b), true
+}
+
+func compare(a, b interface{}) int {
+	ra, rb := typeRank(a), typeRank(b)
+
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch av := a.(type) {
+	case string:
+		return strings.Compare(av, b.(string))
+	case bool:
+		bv := b.(bool)
+
+		switch {
+		case av == bv:
+			return 0
+		case bv:
+			return -1
+		}
+
+		return 1
+	case primitive.DateTime:
+		return compareInt64(int64(av), int64(b.(primitive.DateTime)))
+	case primitive.ObjectID:
+		bv := b.(primitive.ObjectID)
+		return bytes.Compare(av[:], bv[:])
+	case primitive.Timestamp:
+		return primitive.CompareTimestamp(av, b.(primitive.Timestamp))
+	case bson.A:
+		bv := b.(bson.A)
+
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if cmp := compare(av[i], bv[i]); cmp != 0 {
+				return cmp
+			}
+		}
+
+		return len(av) - len(bv)
+	case bson.D:
+		bv := b.(bson.D)
+
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if cmp := strings.Compare(av[i].Key, bv[i].Key); cmp != 0 {
+				return cmp
+			}
+
+			if cmp := compare(av[i].Value, bv[i].Value); cmp != 0 {
+				return cmp
+			}
+		}
+
+		return len(av) - len(bv)
+	}
+
+	if af, ok := toFloat(a); ok {
+		bf, _ := toFloat(b)
+
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+
+		return 0
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+func equal(a, b interface{}) bool {
+	if typeRank(a) != typeRank(b) {
+		return false
+	}
+
+	return compare(a, b) == 0
+}
@@ -0,0 +1,241 @@
+package mongotest
+
+import (
+	"errors"
+	"fmt"
+	mongo "github.com/luxation/go-mongo/v2"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+func TestMatches(t *testing.T) {
+	now := time.Now()
+
+	doc, err := normalize(bson.M{
+		"name":      "Alice",
+		"age":       32,
+		"score":     12.5,
+		"tags":      []string{"admin", "staff"},
+		"createdAt": now,
+		"address": bson.M{
+			"city": "Paris",
+			"zip":  "75001",
+		},
+		"orders": []bson.M{
+			{"sku": "a", "qty": 1},
+			{"sku": "b", "qty": 5},
+		},
+		"deleted": nil,
+	})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		filter bson.M
+		match  bool
+	}{
+		{filter: bson.M{}, match: true},
+		{filter: bson.M{"name": "Alice"}, match: true},
+		{filter: bson.M{"name": "Bob"}, match: false},
+		{filter: bson.M{"name": bson.M{"$eq": "Alice"}}, match: true},
+		{filter: bson.M{"name": bson.M{"$ne": "Alice"}}, match: false},
+		{filter: bson.M{"age": int32(32)}, match: true},
+		{filter: bson.M{"age": 32.0}, match: true},
+		{filter: bson.M{"age": bson.M{"$gt": 30, "$lte": 32}}, match: true},
+		{filter: bson.M{"age": bson.M{"$lt": 30}}, match: false},
+		{filter: bson.M{"age": bson.M{"$gt": "30"}}, match: false},
+		{filter: bson.M{"score": bson.M{"$gte": 12}}, match: true},
+		{filter: bson.M{"createdAt": bson.M{"$lt": now.Add(time.Hour)}}, match: true},
+		{filter: bson.M{"createdAt": bson.M{"$gt": now.Add(time.Hour)}}, match: false},
+		{filter: bson.M{"name": bson.M{"$in": []string{"Bob", "Alice"}}}, match: true},
+		{filter: bson.M{"name": bson.M{"$nin": []string{"Bob", "Alice"}}}, match: false},
+		{filter: bson.M{"name": bson.M{"$regex": "^ali", "$options": "i"}}, match: true},
+		{filter: bson.M{"name": primitive.Regex{Pattern: "^ali"}}, match: false},
+		{filter: bson.M{"name": bson.M{"$not": bson.M{"$regex": "^Bo"}}}, match: true},
+		{filter: bson.M{"address.city": "Paris"}, match: true},
+		{filter: bson.M{"address.country": bson.M{"$exists": false}}, match: true},
+		{filter: bson.M{"address.country": nil}, match: true},
+		{filter: bson.M{"deleted": nil}, match: true},
+		{filter: bson.M{"deleted": bson.M{"$exists": true}}, match: true},
+		{filter: bson.M{"tags": "admin"}, match: true},
+		{filter: bson.M{"tags": []string{"admin", "staff"}}, match: true},
+		{filter: bson.M{"tags": bson.M{"$all": []string{"staff", "admin"}}}, match: true},
+		{filter: bson.M{"tags": bson.M{"$size": 2}}, match: true},
+		{filter: bson.M{"tags.0": "admin"}, match: true},
+		{filter: bson.M{"orders.sku": "b"}, match: true},
+		{filter: bson.M{"orders.1.qty": 5}, match: true},
+		{filter: bson.M{"orders": bson.M{"$elemMatch": bson.M{"sku": "a", "qty": bson.M{"$gt": 2}}}}, match: false},
+		{filter: bson.M{"orders": bson.M{"$elemMatch": bson.M{"sku": "b", "qty": bson.M{"$gt": 2}}}}, match: true},
+		{filter: bson.M{"$or": []bson.M{{"name": "Bob"}, {"age": 32}}}, match: true},
+		{filter: bson.M{"$and": []bson.M{{"name": "Alice"}, {"age": 31}}}, match: false},
+		{filter: bson.M{"$nor": []bson.M{{"name": "Bob"}}}, match: true},
+	}
+
+	for _, test := range tests {
+		filter, err := normalize(test.filter)
+		assert.Nil(t, err)
+
+		res, err := matches(doc, filter)
+
+		assert.Nil(t, err, test.filter)
+		assert.Equal(t, test.match, res, test.filter)
+	}
+}
+
+func TestMatchesUnsupportedOperator(t *testing.T) {
+	filter, err := normalize(bson.M{"name": bson.M{"$where": "true"}})
+	assert.Nil(t, err)
+
+	_, err = matches(bson.D{{Key: "name", Value: "Alice"}}, filter)
+	assert.NotNil(t, err)
+}
+
+func TestApplyUpdate(t *testing.T) {
+	doc, err := normalize(bson.M{"_id": "1", "count": 1, "address": bson.M{"city": "Paris"}})
+	assert.Nil(t, err)
+
+	update, err := normalize(bson.D{
+		{Key: "$set", Value: bson.M{"address.zip": "75001", "name": "Alice"}},
+		{Key: "$inc", Value: bson.M{"count": int32(2)}},
+		{Key: "$unset", Value: bson.M{"address.city": ""}},
+		{Key: "$setOnInsert", Value: bson.M{"createdAt": "now"}},
+	})
+	assert.Nil(t, err)
+
+	doc, err = applyUpdate(doc, update, false, nil)
+	assert.Nil(t, err)
+
+	name, _ := getPath(doc, "name")
+	assert.Equal(t, "Alice", name)
+
+	zip, _ := getPath(doc, "address.zip")
+	assert.Equal(t, "75001", zip)
+
+	_, found := getPath(doc, "address.city")
+	assert.False(t, found)
+
+	count, _ := getPath(doc, "count")
+	assert.Equal(t, int32(3), count)
+
+	_, found = getPath(doc, "createdAt")
+	assert.False(t, found)
+}
+
+func TestApplyUpdateRejectsIDChange(t *testing.T) {
+	doc := bson.D{{Key: "_id", Value: "1"}}
+
+	update, err := normalize(bson.M{"$set": bson.M{"_id": "2"}})
+	assert.Nil(t, err)
+
+	_, err = applyUpdate(doc, update, false, nil)
+	assert.NotNil(t, err)
+}
+
+func TestApplyUpdateOperators(t *testing.T) {
+	doc, err := normalize(bson.D{
+		{Key: "_id", Value: "1"},
+		{Key: "price", Value: 10},
+		{Key: "low", Value: 5},
+		{Key: "high", Value: 5},
+		{Key: "title", Value: "Old"},
+		{Key: "tags", Value: bson.A{"a", "b"}},
+		{Key: "scores", Value: bson.A{4, 8}},
+		{Key: "comments", Value: bson.A{
+			bson.D{{Key: "text", Value: "hi"}, {Key: "spam", Value: false}},
+			bson.D{{Key: "text", Value: "buy"}, {Key: "spam", Value: true}},
+		}},
+	})
+	assert.Nil(t, err)
+
+	position := 0
+	slice := -3
+
+	update, err := normalize(mongo.NewUpdate().
+		Mul("price", 3).
+		Mul("missing", int64(2)).
+		Min("low", 2).
+		Max("high", 3).
+		Rename("title", "name").
+		Push("tags", "c").
+		AddToSet("tags", "a", "d").
+		PushEach("scores", []interface{}{1, 9}, mongo.PushModifiers{Position: &position, Sort: 1, Slice: &slice}).
+		Pull("comments", bson.M{"spam": true}).
+		CurrentDate("checkedAt").
+		Document())
+	assert.Nil(t, err)
+
+	doc, err = applyUpdate(doc, update, false, nil)
+	assert.Nil(t, err)
+
+	expected := map[string]interface{}{
+		"price":   int32(30),
+		"missing": int64(0),
+		"low":     int32(2),
+		"high":    int32(5),
+		"name":    "Old",
+		"tags":    bson.A{"a", "b", "c", "d"},
+		"scores":  bson.A{int32(4), int32(8), int32(9)},
+	}
+
+	for path, value := range expected {
+		current, _ := getPath(doc, path)
+		assert.Equal(t, value, current, path)
+	}
+
+	_, found := getPath(doc, "title")
+	assert.False(t, found)
+
+	comments, _ := getPath(doc, "comments")
+	assert.Len(t, comments, 1)
+
+	checkedAt, _ := getPath(doc, "checkedAt")
+	assert.IsType(t, primitive.DateTime(0), checkedAt)
+}
+
+func TestApplyUpdateArrayFilters(t *testing.T) {
+	doc, err := normalize(bson.D{
+		{Key: "_id", Value: "1"},
+		{Key: "items", Value: bson.A{
+			bson.D{{Key: "sku", Value: "a"}, {Key: "qty", Value: 0}},
+			bson.D{{Key: "sku", Value: "b"}, {Key: "qty", Value: 4}},
+			bson.D{{Key: "sku", Value: "c"}, {Key: "qty", Value: 0}},
+		}},
+	})
+	assert.Nil(t, err)
+
+	builder := mongo.NewUpdate().
+		Set("items.$[item].status", "sold out").
+		Inc("items.$[].version", 1).
+		ArrayFilter(bson.M{"item.qty": bson.M{"$lte": 0}})
+
+	update, err := normalize(builder.Document())
+	assert.Nil(t, err)
+
+	filters, err := normalizeAll(builder.ArrayFilters())
+	assert.Nil(t, err)
+
+	doc, err = applyUpdate(doc, update, false, filters)
+	assert.Nil(t, err)
+
+	for i, status := range []interface{}{"sold out", nil, "sold out"} {
+		current, _ := getPath(doc, fmt.Sprintf("items.%d.status", i))
+		assert.Equal(t, status, current)
+
+		version, _ := getPath(doc, fmt.Sprintf("items.%d.version", i))
+		assert.Equal(t, int32(1), version)
+	}
+
+	update, err = normalize(bson.M{"$set": bson.M{"items.$[other].qty": 1}})
+	assert.Nil(t, err)
+
+	_, err = applyUpdate(doc, update, false, filters)
+	assert.NotNil(t, err)
+
+	update, err = normalize(bson.M{"$set": bson.M{"items.$.qty": 1}})
+	assert.Nil(t, err)
+
+	_, err = applyUpdate(doc, update, false, filters)
+	assert.True(t, errors.Is(err, ErrNotSupported))
+}
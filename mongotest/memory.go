@@ -0,0 +1,1815 @@
+package mongotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	mongo "github.com/luxation/go-mongo/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrNotSupported = errors.New("not supported by the in-memory client")
+
+const duplicateKeyCode = 11000
+
+type store struct {
+	mu          sync.Mutex
+	connected   bool
+	collections map[string][]bson.D
+	indexes     map[string][]mongo.IndexSpec
+}
+
+func (s *store) snapshot() map[string][]bson.D {
+	collections := make(map[string][]bson.D, len(s.collections))
+
+	for name, docs := range s.collections {
+		collections[name] = append([]bson.D(nil), docs...)
+	}
+
+	return collections
+}
+
+// MemoryClient is a mongo.Client keeping its documents in memory. Filters
+// and updates are evaluated locally, so unit tests can exercise real data
+// flows without a running server. Operations needing a driver connection,
+// such as GetCollection, return ErrNotSupported.
+type MemoryClient struct {
+	store         *store
+	ctx           context.Context
+	strictUpdates bool
+	naming        *mongo.NamingStrategy
+	nulls         mongo.NullPolicy
+}
+
+var _ mongo.Client = (*MemoryClient)(nil)
+
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		store: &store{
+			connected:   true,
+			collections: make(map[string][]bson.D),
+			indexes:     make(map[string][]mongo.IndexSpec),
+		},
+	}
+}
+
+// SetStrictUpdates mirrors ClientConfig.StrictUpdates.
+func (m *MemoryClient) SetStrictUpdates(strict bool) *MemoryClient {
+	m.strictUpdates = strict
+	return m
+}
+
+// SetNamingStrategy mirrors ClientConfig.NamingStrategy.
+func (m *MemoryClient) SetNamingStrategy(naming *mongo.NamingStrategy) *MemoryClient {
+	m.naming = naming
+	return m
+}
+
+// SetNullPolicy mirrors ClientConfig.NullPolicy.
+func (m *MemoryClient) SetNullPolicy(policy mongo.NullPolicy) *MemoryClient {
+	m.nulls = policy
+	return m
+}
+
+func (m *MemoryClient) updateConfig(d mongo.Document) mongo.UpdateConfig {
+	return mongo.UpdateConfig{Naming: m.naming, Nulls: m.nulls, Document: d}
+}
+
+// Documents returns a copy of the raw documents stored in collection.
+func (m *MemoryClient) Documents(collection string) []bson.D {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	return append([]bson.D(nil), m.store.collections[collection]...)
+}
+
+// Reset drops every collection.
+func (m *MemoryClient) Reset() {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	m.store.collections = make(map[string][]bson.D)
+	m.store.indexes = make(map[string][]mongo.IndexSpec)
+}
+
+func operationError(op string, d mongo.Document, filter interface{}, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var opErr *mongo.OperationError
+	if errors.As(err, &opErr) {
+		return err
+	}
+
+	collection := ""
+
+	if d != nil {
+		collection = d.DocumentName()
+	}
+
+	return &mongo.OperationError{
+		Op:         op,
+		Collection: collection,
+		Filter:     filter,
+		Err:        err,
+	}
+}
+
+func duplicateKeyError(collection, index string, key interface{}) error {
+	return driver.WriteException{
+		WriteErrors: driver.WriteErrors{{
+			Code:    duplicateKeyCode,
+			Message: fmt.Sprintf("E11000 duplicate key error collection: %s index: %s dup key: %v", collection, index, key),
+		}},
+	}
+}
+
+// lock checks the state of the client and locks the store. The returned
+// function must be called to release it.
+func (m *MemoryClient) lock() (func(), error) {
+	if m.ctx != nil && m.ctx.Err() != nil {
+		return nil, m.ctx.Err()
+	}
+
+	m.store.mu.Lock()
+
+	if !m.store.connected {
+		m.store.mu.Unlock()
+		return nil, mongo.ErrNotConnected
+	}
+
+	return m.store.mu.Unlock, nil
+}
+
+// encode returns d as stored, its struct fields named by the naming
+// strategy.
+func (m *MemoryClient) encode(d interface{}) (bson.D, error) {
+	registry := m.naming.Registry()
+
+	if registry == nil || d == nil {
+		return normalize(d)
+	}
+
+	raw, err := bson.MarshalWithRegistry(registry, d)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.D
+
+	err = bson.Unmarshal(raw, &doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+func (m *MemoryClient) decode(doc bson.D, v interface{}) error {
+	raw, err := bson.Marshal(doc)
+
+	if err != nil {
+		return err
+	}
+
+	if registry := m.naming.Registry(); registry != nil {
+		return bson.UnmarshalWithRegistry(registry, raw, v)
+	}
+
+	return bson.Unmarshal(raw, v)
+}
+
+// namedOptions maps the fields of the find options onto the keys of d with
+// the naming strategy of the client.
+func (m *MemoryClient) namedOptions(d mongo.Document, findOptions []*mongo.FindOptions) []*mongo.FindOptions {
+	if len(findOptions) == 0 {
+		return findOptions
+	}
+
+	return []*mongo.FindOptions{findOptions[0].Named(m.naming, d)}
+}
+
+func prepareInsert(d mongo.Document) {
+	if d.GetID() == "" {
+		d.SetID(uuid.New())
+	}
+	d.SetCreatedAt()
+	d.SetUpdatedAt()
+}
+
+func (m *MemoryClient) Connect() error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	m.store.connected = true
+
+	return nil
+}
+
+func (m *MemoryClient) Disconnect() error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if !m.store.connected {
+		return operationError("Disconnect", nil, nil, mongo.ErrNotConnected)
+	}
+
+	m.store.connected = false
+
+	return nil
+}
+
+func (m *MemoryClient) HealthCheck() error {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return operationError("HealthCheck", nil, nil, err)
+	}
+
+	unlock()
+
+	return nil
+}
+
+func (m *MemoryClient) WithContext(ctx context.Context) mongo.Client {
+	scoped := *m
+	scoped.ctx = ctx
+	return &scoped
+}
+
+// WithTransaction runs fn and restores the previous state of every
+// collection when it fails. Concurrent writes are not isolated from the
+// transaction.
+func (m *MemoryClient) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return operationError("WithTransaction", nil, nil, err)
+	}
+
+	snapshot := m.store.snapshot()
+
+	unlock()
+
+	err = fn(ctx)
+
+	if err != nil {
+		m.store.mu.Lock()
+		m.store.collections = snapshot
+		m.store.mu.Unlock()
+
+		return operationError("WithTransaction", nil, nil, err)
+	}
+
+	return nil
+}
+
+// SupportsTransactions reports that WithTransaction rolls back failed
+// transactions, which GetClient cannot be asked about.
+func (m *MemoryClient) SupportsTransactions() bool {
+	return true
+}
+
+func (m *MemoryClient) GetCollectionByName(name string) (*driver.Collection, error) {
+	return nil, &mongo.OperationError{Op: "GetCollectionByName", Collection: name, Err: ErrNotSupported}
+}
+
+func (m *MemoryClient) GetCollection(d mongo.Document) (*driver.Collection, error) {
+	return nil, operationError("GetCollection", d, nil, ErrNotSupported)
+}
+
+func (m *MemoryClient) GetClient() (*driver.Client, error) {
+	return nil, operationError("GetClient", nil, nil, ErrNotSupported)
+}
+
+func (m *MemoryClient) GenerateUUID() uuid.UUID {
+	return uuid.New()
+}
+
+func (m *MemoryClient) GetURI() string {
+	return "memory://"
+}
+
+// find returns the indexes of the documents of collection matching filter.
+func (m *MemoryClient) find(collection string, filter interface{}) ([]int, error) {
+	normalized, err := normalize(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var res []int
+
+	for i, doc := range m.store.collections[collection] {
+		ok, err := matches(doc, normalized)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			res = append(res, i)
+		}
+	}
+
+	return res, nil
+}
+
+// checkUnique verifies that doc, stored at position skip (-1 for a new
+// document), does not break the _id or the unique indexes of collection.
+func (m *MemoryClient) checkUnique(collection string, doc bson.D, skip int) error {
+	id, _ := lookupKey(doc, "_id")
+
+	for i, other := range m.store.collections[collection] {
+		if i == skip {
+			continue
+		}
+
+		if otherID, _ := lookupKey(other, "_id"); equal(id, otherID) {
+			return duplicateKeyError(collection, "_id_", id)
+		}
+
+		for _, spec := range m.store.indexes[collection] {
+			if !spec.Unique {
+				continue
+			}
+
+			if spec.PartialFilter != nil {
+				partial, err := normalize(spec.PartialFilter)
+
+				if err != nil {
+					return err
+				}
+
+				docMatches, _ := matches(doc, partial)
+				otherMatches, _ := matches(other, partial)
+
+				if !docMatches || !otherMatches {
+					continue
+				}
+			}
+
+			same := true
+			present := false
+
+			for _, key := range spec.Keys {
+				value, ok := getPath(doc, key.Field)
+				otherValue, otherOk := getPath(other, key.Field)
+
+				present = present || ok
+
+				if ok != otherOk || !equal(value, otherValue) {
+					same = false
+					break
+				}
+			}
+
+			if same && (present || !spec.Sparse) {
+				return duplicateKeyError(collection, spec.IndexName(), id)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryClient) insert(collection string, doc bson.D) error {
+	if _, ok := lookupKey(doc, "_id"); !ok {
+		doc = append(bson.D{{Key: "_id", Value: uuid.NewString()}}, doc...)
+	}
+
+	err := m.checkUnique(collection, doc, -1)
+
+	if err != nil {
+		return err
+	}
+
+	m.store.collections[collection] = append(m.store.collections[collection], doc)
+
+	return nil
+}
+
+func (m *MemoryClient) replaceAt(collection string, index int, doc bson.D) error {
+	err := m.checkUnique(collection, doc, index)
+
+	if err != nil {
+		return err
+	}
+
+	m.store.collections[collection][index] = doc
+
+	return nil
+}
+
+func (m *MemoryClient) removeAt(collection string, indexes []int) {
+	removed := make(map[int]bool, len(indexes))
+
+	for _, i := range indexes {
+		removed[i] = true
+	}
+
+	var docs []bson.D
+
+	for i, doc := range m.store.collections[collection] {
+		if !removed[i] {
+			docs = append(docs, doc)
+		}
+	}
+
+	m.store.collections[collection] = docs
+}
+
+func normalizeAll(values []interface{}) ([]bson.D, error) {
+	res := make([]bson.D, len(values))
+
+	for i, v := range values {
+		normalized, err := normalize(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res[i] = normalized
+	}
+
+	return res, nil
+}
+
+// update applies update to the documents matching filter, to the first one
+// only unless many is set.
+func (m *MemoryClient) update(collection string, filter interface{}, update interface{}, filters []interface{}, many bool) (*mongo.UpdateResult, error) {
+	matched, err := m.find(collection, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !many && len(matched) > 1 {
+		matched = matched[:1]
+	}
+
+	normalized, err := normalizeUpdate(update)
+
+	if err != nil {
+		return nil, err
+	}
+
+	normalizedFilters, err := normalizeAll(filters)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &mongo.UpdateResult{MatchedCount: int64(len(matched))}
+
+	for _, i := range matched {
+		before := m.store.collections[collection][i]
+
+		doc, err := applyNormalized(before, normalized, normalizedFilters)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if equal(before, doc) {
+			continue
+		}
+
+		err = m.replaceAt(collection, i, doc)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result.ModifiedCount++
+	}
+
+	return result, nil
+}
+
+// sortDocuments orders docs by sorts. A collation with a strength of 1 or 2
+// compares strings case insensitively; other collation settings are ignored.
+func sortDocuments(docs []bson.D, sorts []mongo.SortOption, collation *options.Collation) error {
+	if len(sorts) == 0 {
+		return nil
+	}
+
+	for _, s := range sorts {
+		if s.TextScore {
+			return fmt.Errorf("%w: sorting on text score", ErrNotSupported)
+		}
+	}
+
+	caseInsensitive := collation != nil && collation.Strength > 0 && collation.Strength < 3
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, s := range sorts {
+			a, _ := getPath(docs[i], s.SortField)
+			b, _ := getPath(docs[j], s.SortField)
+
+			if caseInsensitive {
+				a, b = foldCase(a), foldCase(b)
+			}
+
+			cmp := compare(a, b)
+
+			if s.Order == mongo.OrderDESC {
+				cmp = -cmp
+			}
+
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+
+		return false
+	})
+
+	return nil
+}
+
+func foldCase(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return strings.ToLower(s)
+	}
+
+	return v
+}
+
+func (m *MemoryClient) query(d mongo.Document, filters bson.M, findOptions []*mongo.FindOptions) ([]bson.D, error) {
+	var findOption *mongo.FindOptions
+
+	if len(findOptions) > 0 {
+		findOption = findOptions[0]
+	}
+
+	query := bson.M{}
+
+	for k, v := range filters {
+		query[k] = v
+	}
+
+	if findOption != nil && findOption.Pagination != nil && findOption.Pagination.LastID != "" {
+		query["_id"] = bson.M{"$gt": findOption.Pagination.LastID}
+	}
+
+	matched, err := m.find(d.DocumentName(), query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]bson.D, len(matched))
+
+	for i, index := range matched {
+		docs[i] = m.store.collections[d.DocumentName()][index]
+	}
+
+	if findOption != nil {
+		err = sortDocuments(docs, findOption.Sort, findOption.Collation)
+
+		if err != nil {
+			return nil, err
+		}
+
+		skip, err := findOption.Pagination.Offset()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if skip >= int64(len(docs)) {
+			docs = nil
+		} else {
+			docs = docs[skip:]
+		}
+
+		if findOption.Pagination != nil && findOption.Pagination.Limit != nil && *findOption.Pagination.Limit > 0 {
+			if limit := int(*findOption.Pagination.Limit); limit < len(docs) {
+				docs = docs[:limit]
+			}
+		}
+
+		if projection := findOption.ProjectionDocument(); projection != nil {
+			projection, err = normalize(projection)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for i, doc := range docs {
+				docs[i], err = project(doc, projection)
+
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return docs, nil
+}
+
+func (m *MemoryClient) cursor(docs []bson.D) (*driver.Cursor, error) {
+	items := make([]interface{}, len(docs))
+
+	for i, doc := range docs {
+		items[i] = doc
+	}
+
+	return driver.NewCursorFromDocuments(items, nil, m.naming.Registry())
+}
+
+func (m *MemoryClient) context() context.Context {
+	if m.ctx != nil {
+		return m.ctx
+	}
+
+	return context.Background()
+}
+
+func (m *MemoryClient) decodeAll(docs []bson.D, decoder mongo.ResultDecoder) error {
+	cursor, err := m.cursor(docs)
+
+	if err != nil {
+		return err
+	}
+
+	ctx := m.context()
+
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		err = decoder(mongo.ResultCursor{Cursor: cursor})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+func (m *MemoryClient) FindAll(d mongo.Document, filters bson.M, decoder mongo.ResultDecoder, findOptions ...*mongo.FindOptions) error {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return operationError("FindAll", d, filters, err)
+	}
+
+	docs, err := m.query(d, filters, m.namedOptions(d, findOptions))
+
+	unlock()
+
+	if err != nil {
+		return operationError("FindAll", d, filters, err)
+	}
+
+	return operationError("FindAll", d, filters, m.decodeAll(docs, decoder))
+}
+
+func (m *MemoryClient) FindStream(d mongo.Document, filters bson.M, findOptions ...*mongo.FindOptions) (mongo.Stream, error) {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return nil, operationError("FindStream", d, filters, err)
+	}
+
+	docs, err := m.query(d, filters, m.namedOptions(d, findOptions))
+
+	unlock()
+
+	if err != nil {
+		return nil, operationError("FindStream", d, filters, err)
+	}
+
+	cursor, err := m.cursor(docs)
+
+	if err != nil {
+		return nil, operationError("FindStream", d, filters, err)
+	}
+
+	return cursor, nil
+}
+
+func (m *MemoryClient) FindPage(d mongo.Document, filters bson.M, decoder mongo.ResultDecoder, findOptions ...*mongo.FindOptions) (*mongo.PageInfo, error) {
+	query, err := mongo.NewPageQuery(filters, m.namedOptions(d, findOptions)...)
+
+	if err != nil {
+		return nil, operationError("FindPage", d, filters, err)
+	}
+
+	query.Registry = m.naming.Registry()
+
+	unlock, err := m.lock()
+
+	if err != nil {
+		return nil, operationError("FindPage", d, filters, err)
+	}
+
+	if query.Pipeline != nil {
+		docs := append([]bson.D(nil), m.store.collections[d.DocumentName()]...)
+
+		unlock()
+
+		docs, err = aggregate(docs, query.Pipeline)
+
+		if err != nil {
+			return nil, operationError("FindPage", d, filters, err)
+		}
+
+		facet, err := bson.Marshal(docs[0])
+
+		if err != nil {
+			return nil, operationError("FindPage", d, filters, err)
+		}
+
+		info, err := query.FacetPage(facet, decoder)
+
+		if err != nil {
+			return nil, operationError("FindPage", d, filters, err)
+		}
+
+		return info, nil
+	}
+
+	docs, err := m.query(d, query.Filter, []*mongo.FindOptions{query.Options})
+
+	unlock()
+
+	if err != nil {
+		return nil, operationError("FindPage", d, query.Filter, err)
+	}
+
+	rows := make([]bson.Raw, len(docs))
+
+	for i, doc := range docs {
+		rows[i], err = bson.Marshal(doc)
+
+		if err != nil {
+			return nil, operationError("FindPage", d, query.Filter, err)
+		}
+	}
+
+	info, err := query.Page(rows, decoder)
+
+	if err != nil {
+		return nil, operationError("FindPage", d, query.Filter, err)
+	}
+
+	return info, nil
+}
+
+func (m *MemoryClient) FindOne(d mongo.Document, filters bson.M, findOptions ...*mongo.FindOptions) error {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return operationError("FindOne", d, filters, err)
+	}
+
+	docs, err := m.query(d, filters, m.namedOptions(d, findOptions))
+
+	unlock()
+
+	if err != nil {
+		return operationError("FindOne", d, filters, err)
+	}
+
+	if len(docs) == 0 {
+		return operationError("FindOne", d, filters, driver.ErrNoDocuments)
+	}
+
+	return operationError("FindOne", d, filters, m.decode(docs[0], d))
+}
+
+func (m *MemoryClient) FindOneById(d mongo.Document, id string) error {
+	return m.FindOne(d, bson.M{"_id": id})
+}
+
+func (m *MemoryClient) Count(d mongo.Document, filter bson.M) (int64, error) {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return 0, operationError("Count", d, filter, err)
+	}
+
+	defer unlock()
+
+	matched, err := m.find(d.DocumentName(), filter)
+
+	if err != nil {
+		return 0, operationError("Count", d, filter, err)
+	}
+
+	return int64(len(matched)), nil
+}
+
+func (m *MemoryClient) EstimatedCount(d mongo.Document) (int64, error) {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return 0, operationError("EstimatedCount", d, nil, err)
+	}
+
+	defer unlock()
+
+	return int64(len(m.store.collections[d.DocumentName()])), nil
+}
+
+func (m *MemoryClient) Exists(d mongo.Document, filter bson.M) (bool, error) {
+	count, err := m.Count(d, filter)
+
+	if err != nil {
+		return false, operationError("Exists", d, filter, errors.Unwrap(err))
+	}
+
+	return count > 0, nil
+}
+
+// Distinct returns the distinct values of field among the matching
+// documents, array values contributing each of their elements.
+func (m *MemoryClient) Distinct(d mongo.Document, field string, filter bson.M) ([]interface{}, error) {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return nil, operationError("Distinct", d, filter, err)
+	}
+
+	defer unlock()
+
+	matched, err := m.find(d.DocumentName(), filter)
+
+	if err != nil {
+		return nil, operationError("Distinct", d, filter, err)
+	}
+
+	values := []interface{}{}
+
+	for _, index := range matched {
+		for _, value := range candidates(lookupPath(m.store.collections[d.DocumentName()][index], field)) {
+			if _, isArray := value.(bson.A); isArray {
+				continue
+			}
+
+			found := false
+
+			for _, v := range values {
+				if equal(v, value) {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				values = append(values, value)
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// Aggregate supports pipelines made of $match, $sort, $skip, $limit, $count
+// and $facet stages, and $project stages written as find projections.
+func (m *MemoryClient) Aggregate(d mongo.Document, pipeline bson.A, decoder mongo.ResultDecoder, aggregateOptions ...*options.AggregateOptions) error {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return operationError("Aggregate", d, pipeline, err)
+	}
+
+	docs := append([]bson.D(nil), m.store.collections[d.DocumentName()]...)
+
+	unlock()
+
+	docs, err = aggregate(docs, pipeline)
+
+	if err != nil {
+		return operationError("Aggregate", d, pipeline, err)
+	}
+
+	return operationError("Aggregate", d, pipeline, m.decodeAll(docs, decoder))
+}
+
+func (m *MemoryClient) AggregateStream(d mongo.Document, pipeline bson.A, aggregateOptions ...*options.AggregateOptions) (mongo.Stream, error) {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return nil, operationError("AggregateStream", d, pipeline, err)
+	}
+
+	docs := append([]bson.D(nil), m.store.collections[d.DocumentName()]...)
+
+	unlock()
+
+	docs, err = aggregate(docs, pipeline)
+
+	if err != nil {
+		return nil, operationError("AggregateStream", d, pipeline, err)
+	}
+
+	cursor, err := m.cursor(docs)
+
+	if err != nil {
+		return nil, operationError("AggregateStream", d, pipeline, err)
+	}
+
+	return cursor, nil
+}
+
+func aggregate(docs []bson.D, pipeline bson.A) ([]bson.D, error) {
+	wrapped, err := normalize(bson.M{"pipeline": pipeline})
+
+	if err != nil {
+		return nil, err
+	}
+
+	stages, _ := wrapped[0].Value.(bson.A)
+
+	for _, s := range stages {
+		stage, ok := s.(bson.D)
+
+		if !ok || len(stage) != 1 {
+			return nil, fmt.Errorf("a pipeline stage must be a document with a single field")
+		}
+
+		switch stage[0].Key {
+		case "$match":
+			filter, _ := stage[0].Value.(bson.D)
+
+			var res []bson.D
+
+			for _, doc := range docs {
+				ok, err := matches(doc, filter)
+
+				if err != nil {
+					return nil, err
+				}
+
+				if ok {
+					res = append(res, doc)
+				}
+			}
+
+			docs = res
+		case "$sort":
+			spec, _ := stage[0].Value.(bson.D)
+
+			var sorts []mongo.SortOption
+
+			for _, e := range spec {
+				order := mongo.OrderASC
+
+				if f, _ := toFloat(e.Value); f < 0 {
+					order = mongo.OrderDESC
+				}
+
+				_, meta := e.Value.(bson.D)
+
+				sorts = append(sorts, mongo.SortOption{SortField: e.Key, Order: order, TextScore: meta})
+			}
+
+			err = sortDocuments(docs, sorts, nil)
+
+			if err != nil {
+				return nil, err
+			}
+		case "$skip":
+			n, _ := toFloat(stage[0].Value)
+
+			if int(n) >= len(docs) {
+				docs = nil
+			} else {
+				docs = docs[int(n):]
+			}
+		case "$limit":
+			n, _ := toFloat(stage[0].Value)
+
+			if int(n) < len(docs) {
+				docs = docs[:int(n)]
+			}
+		case "$count":
+			field, _ := stage[0].Value.(string)
+
+			if len(docs) > 0 {
+				docs = []bson.D{{{Key: field, Value: int32(len(docs))}}}
+			}
+		case "$project":
+			projection, _ := stage[0].Value.(bson.D)
+
+			res := make([]bson.D, len(docs))
+
+			for i, doc := range docs {
+				res[i], err = project(doc, projection)
+
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			docs = res
+		case "$facet":
+			facets, _ := stage[0].Value.(bson.D)
+
+			res := bson.D{}
+
+			for _, facet := range facets {
+				sub, _ := facet.Value.(bson.A)
+
+				out, err := aggregate(docs, sub)
+
+				if err != nil {
+					return nil, err
+				}
+
+				items := bson.A{}
+
+				for _, doc := range out {
+					items = append(items, doc)
+				}
+
+				res = append(res, bson.E{Key: facet.Key, Value: items})
+			}
+
+			docs = []bson.D{res}
+		default:
+			return nil, fmt.Errorf("%w: aggregation stage %s", ErrNotSupported, stage[0].Key)
+		}
+	}
+
+	return docs, nil
+}
+
+func (m *MemoryClient) Persist(d mongo.Document) error {
+	prepareInsert(d)
+
+	doc, err := m.encode(d)
+
+	if err != nil {
+		return operationError("Persist", d, nil, err)
+	}
+
+	unlock, err := m.lock()
+
+	if err != nil {
+		return operationError("Persist", d, nil, err)
+	}
+
+	defer unlock()
+
+	return operationError("Persist", d, nil, m.insert(d.DocumentName(), doc))
+}
+
+func (m *MemoryClient) PersistMany(docs []mongo.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	d := docs[0]
+
+	normalized := make([]bson.D, len(docs))
+
+	for i, doc := range docs {
+		if doc.DocumentName() != d.DocumentName() {
+			return operationError("PersistMany", d, nil, fmt.Errorf("document %d belongs to collection %s", i, doc.DocumentName()))
+		}
+
+		prepareInsert(doc)
+
+		n, err := m.encode(doc)
+
+		if err != nil {
+			return operationError("PersistMany", d, nil, err)
+		}
+
+		normalized[i] = n
+	}
+
+	unlock, err := m.lock()
+
+	if err != nil {
+		return operationError("PersistMany", d, nil, err)
+	}
+
+	defer unlock()
+
+	for _, doc := range normalized {
+		err = m.insert(d.DocumentName(), doc)
+
+		if err != nil {
+			return operationError("PersistMany", d, nil, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryClient) ReplaceOrPersist(d mongo.Document) (bool, error) {
+	if d.GetID() == "" {
+		d.SetID(m.GenerateUUID())
+	}
+	d.SetCreatedAt()
+	d.SetUpdatedAt()
+
+	filter := bson.M{"_id": d.GetID()}
+
+	doc, err := m.encode(d)
+
+	if err != nil {
+		return false, operationError("ReplaceOrPersist", d, filter, err)
+	}
+
+	unlock, err := m.lock()
+
+	if err != nil {
+		return false, operationError("ReplaceOrPersist", d, filter, err)
+	}
+
+	defer unlock()
+
+	matched, err := m.find(d.DocumentName(), filter)
+
+	if err != nil {
+		return false, operationError("ReplaceOrPersist", d, filter, err)
+	}
+
+	if len(matched) == 0 {
+		return true, operationError("ReplaceOrPersist", d, filter, m.insert(d.DocumentName(), doc))
+	}
+
+	existing := m.store.collections[d.DocumentName()][matched[0]]
+
+	if createdAt, ok := lookupKey(existing, "createdAt"); ok {
+		doc, err = set(doc, "createdAt", createdAt)
+
+		if err != nil {
+			return false, operationError("ReplaceOrPersist", d, filter, err)
+		}
+	}
+
+	return false, operationError("ReplaceOrPersist", d, filter, m.replaceAt(d.DocumentName(), matched[0], doc))
+}
+
+func (m *MemoryClient) Replace(d mongo.Document) error {
+	d.SetUpdatedAt()
+
+	filter := bson.M{"_id": d.GetID()}
+
+	doc, err := m.encode(d)
+
+	if err != nil {
+		return operationError("Replace", d, filter, err)
+	}
+
+	unlock, err := m.lock()
+
+	if err != nil {
+		return operationError("Replace", d, filter, err)
+	}
+
+	defer unlock()
+
+	matched, err := m.find(d.DocumentName(), filter)
+
+	if err != nil {
+		return operationError("Replace", d, filter, err)
+	}
+
+	if len(matched) == 0 {
+		return operationError("Replace", d, filter, driver.ErrNoDocuments)
+	}
+
+	return operationError("Replace", d, filter, m.replaceAt(d.DocumentName(), matched[0], doc))
+}
+
+func (m *MemoryClient) deleteOne(op string, d mongo.Document, filter bson.M) error {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return operationError(op, d, filter, err)
+	}
+
+	defer unlock()
+
+	matched, err := m.find(d.DocumentName(), filter)
+
+	if err != nil {
+		return operationError(op, d, filter, err)
+	}
+
+	if len(matched) == 0 {
+		return operationError(op, d, filter, mongo.ErrNotFound)
+	}
+
+	m.removeAt(d.DocumentName(), matched[:1])
+
+	return nil
+}
+
+func (m *MemoryClient) Delete(d mongo.Document) error {
+	return m.deleteOne("Delete", d, bson.M{"_id": d.GetID()})
+}
+
+func (m *MemoryClient) DeleteWhere(d mongo.Document, key, value string) error {
+	return m.deleteOne("DeleteWhere", d, bson.M{key: value})
+}
+
+func (m *MemoryClient) DeleteMany(d mongo.Document, filter bson.M) (int64, error) {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return 0, operationError("DeleteMany", d, filter, err)
+	}
+
+	defer unlock()
+
+	matched, err := m.find(d.DocumentName(), filter)
+
+	if err != nil {
+		return 0, operationError("DeleteMany", d, filter, err)
+	}
+
+	m.removeAt(d.DocumentName(), matched)
+
+	return int64(len(matched)), nil
+}
+
+// updateOf returns the update the client sends for input, the pipeline of an
+// UpdatePipeline or an update document, along with its array filters.
+func (m *MemoryClient) updateOf(input interface{}, d mongo.Document) (interface{}, []interface{}, error) {
+	if pipeline, ok := mongo.PipelineUpdate(input); ok {
+		return pipeline, nil, nil
+	}
+
+	update, err := mongo.UpdateDocument(input, m.updateConfig(d))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filters, err := mongo.UpdateArrayFilters(input, m.updateConfig(d))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return update, filters, nil
+}
+
+func (m *MemoryClient) updateWithLock(op string, d mongo.Document, filter bson.M, input interface{}, many bool) (*mongo.UpdateResult, error) {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return nil, operationError(op, d, filter, err)
+	}
+
+	defer unlock()
+
+	update, filters, err := m.updateOf(input, d)
+
+	if err != nil {
+		return nil, operationError(op, d, filter, err)
+	}
+
+	result, err := m.update(d.DocumentName(), filter, update, filters, many)
+
+	if err != nil {
+		return nil, operationError(op, d, filter, err)
+	}
+
+	return result, nil
+}
+
+// Update behaves as the mongo client one, returning mongo.ErrNotFound when
+// strict updates are enabled and no document has this id.
+func (m *MemoryClient) Update(d mongo.Document, id string, input interface{}) (*mongo.UpdateResult, error) {
+	filter := bson.M{"_id": id}
+
+	result, err := m.updateWithLock("Update", d, filter, input, false)
+
+	if err == nil && m.strictUpdates && result.MatchedCount == 0 {
+		return result, operationError("Update", d, filter, mongo.ErrNotFound)
+	}
+
+	return result, err
+}
+
+func (m *MemoryClient) UpdateWhere(d mongo.Document, filter bson.M, input interface{}) (*mongo.UpdateResult, error) {
+	return m.updateWithLock("UpdateWhere", d, filter, input, false)
+}
+
+func (m *MemoryClient) UpdateMany(d mongo.Document, filter bson.M, input interface{}) (*mongo.UpdateResult, error) {
+	return m.updateWithLock("UpdateMany", d, filter, input, true)
+}
+
+func (m *MemoryClient) ApplyMergePatch(d mongo.Document, id string, patch []byte) (*mongo.UpdateResult, error) {
+	p, err := mongo.NewMergePatch(d, patch, m.naming)
+
+	if err != nil {
+		return nil, operationError("ApplyMergePatch", d, bson.M{"_id": id}, err)
+	}
+
+	return p.Apply(m.context(), m, d, id)
+}
+
+// ApplyJSONPatch applies ops as the client does, patches needing several
+// updates running through WithTransaction.
+func (m *MemoryClient) ApplyJSONPatch(d mongo.Document, id string, ops []mongo.PatchOperation) (*mongo.UpdateResult, error) {
+	p, err := mongo.NewJSONPatch(d, ops, m.naming)
+
+	if err != nil {
+		return nil, operationError("ApplyJSONPatch", d, bson.M{"_id": id}, err)
+	}
+
+	return p.Apply(m.context(), m, d, id)
+}
+
+// first returns the index of the first document matching filter in the
+// order given by sorts, or -1 when none matches.
+func (m *MemoryClient) first(collection string, filter interface{}, sorts []mongo.SortOption) (int, error) {
+	matched, err := m.find(collection, filter)
+
+	if err != nil || len(matched) == 0 {
+		return -1, err
+	}
+
+	docs := make([]bson.D, len(matched))
+
+	for i, index := range matched {
+		docs[i] = m.store.collections[collection][index]
+	}
+
+	err = sortDocuments(docs, sorts, nil)
+
+	if err != nil {
+		return -1, err
+	}
+
+	id, _ := lookupKey(docs[0], "_id")
+
+	for _, index := range matched {
+		if current, _ := lookupKey(m.store.collections[collection][index], "_id"); equal(current, id) {
+			return index, nil
+		}
+	}
+
+	return -1, nil
+}
+
+// upsertSeed returns the document an upsert starts from: the equality
+// conditions of filter.
+func upsertSeed(filter bson.M) (bson.D, error) {
+	normalized, err := normalize(filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := bson.D{}
+
+	for _, e := range normalized {
+		if strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+
+		if ops, isOperator := isOperatorDocument(e.Value); isOperator {
+			if len(ops) != 1 || ops[0].Key != "$eq" {
+				continue
+			}
+
+			e.Value = ops[0].Value
+		}
+
+		doc, err = set(doc, e.Key, e.Value)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// upsert applies update, completed by mongo.UpsertDocument as the client
+// does, to the document seeded from filter. As on the server, the _id taken
+// from filter cannot be changed.
+func upsert(seed bson.D, filter bson.M, update bson.D, arrayFilters []bson.D) (bson.D, error) {
+	normalized, err := normalize(mongo.UpsertDocument(update, filter))
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := applyUpdate(seed, normalized, true, arrayFilters)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if id, seeded := lookupKey(seed, "_id"); seeded {
+		if current, _ := lookupKey(doc, "_id"); !equal(id, current) {
+			return nil, fmt.Errorf("performing an update on the path '_id' would modify the immutable field '_id'")
+		}
+	}
+
+	return doc, nil
+}
+
+// decodeProjected decodes doc into d once projected as findOptions requires.
+func (m *MemoryClient) decodeProjected(doc bson.D, d mongo.Document, findOptions *mongo.FindOptions) error {
+	if projection := findOptions.ProjectionDocument(); projection != nil {
+		normalized, err := normalize(projection)
+
+		if err != nil {
+			return err
+		}
+
+		doc, err = project(doc, normalized)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.decode(doc, d)
+}
+
+func (m *MemoryClient) FindOneAndUpdate(d mongo.Document, filter bson.M, input interface{}, returnAfter bool, opts ...*mongo.FindAndModifyOptions) error {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return operationError("FindOneAndUpdate", d, filter, err)
+	}
+
+	defer unlock()
+
+	var findAndModify mongo.FindAndModifyOptions
+
+	if len(opts) > 0 && opts[0] != nil {
+		findAndModify = *opts[0]
+	}
+
+	findOptions := (&mongo.FindOptions{Sort: findAndModify.Sort, Projection: findAndModify.Projection}).Named(m.naming, d)
+
+	document, arrayFilters, err := m.updateOf(input, d)
+
+	if err != nil {
+		return operationError("FindOneAndUpdate", d, filter, err)
+	}
+
+	update, err := normalizeUpdate(document)
+
+	if err != nil {
+		return operationError("FindOneAndUpdate", d, filter, err)
+	}
+
+	filters, err := normalizeAll(arrayFilters)
+
+	if err != nil {
+		return operationError("FindOneAndUpdate", d, filter, err)
+	}
+
+	index, err := m.first(d.DocumentName(), filter, findOptions.Sort)
+
+	if err != nil {
+		return operationError("FindOneAndUpdate", d, filter, err)
+	}
+
+	if index < 0 {
+		if !findAndModify.Upsert {
+			return operationError("FindOneAndUpdate", d, filter, driver.ErrNoDocuments)
+		}
+
+		updateDocument, ok := document.(bson.D)
+
+		if !ok {
+			return operationError("FindOneAndUpdate", d, filter, fmt.Errorf("an UpdatePipeline cannot be upserted"))
+		}
+
+		doc, err := upsertSeed(filter)
+
+		if err == nil {
+			doc, err = upsert(doc, filter, updateDocument, filters)
+		}
+
+		if err == nil {
+			err = m.insert(d.DocumentName(), doc)
+		}
+
+		if err != nil {
+			return operationError("FindOneAndUpdate", d, filter, err)
+		}
+
+		if !returnAfter {
+			return operationError("FindOneAndUpdate", d, filter, driver.ErrNoDocuments)
+		}
+
+		docs := m.store.collections[d.DocumentName()]
+
+		return operationError("FindOneAndUpdate", d, filter, m.decodeProjected(docs[len(docs)-1], d, findOptions))
+	}
+
+	before := m.store.collections[d.DocumentName()][index]
+
+	after, err := applyNormalized(before, update, filters)
+
+	if err == nil {
+		err = m.replaceAt(d.DocumentName(), index, after)
+	}
+
+	if err != nil {
+		return operationError("FindOneAndUpdate", d, filter, err)
+	}
+
+	if returnAfter {
+		return operationError("FindOneAndUpdate", d, filter, m.decodeProjected(after, d, findOptions))
+	}
+
+	return operationError("FindOneAndUpdate", d, filter, m.decodeProjected(before, d, findOptions))
+}
+
+func (m *MemoryClient) FindOneAndDelete(d mongo.Document, filter bson.M, opts ...*mongo.FindAndModifyOptions) error {
+	unlock, err := m.lock()
+
+	if err != nil {
+		return operationError("FindOneAndDelete", d, filter, err)
+	}
+
+	defer unlock()
+
+	var findAndModify mongo.FindAndModifyOptions
+
+	if len(opts) > 0 && opts[0] != nil {
+		findAndModify = *opts[0]
+	}
+
+	findOptions := (&mongo.FindOptions{Sort: findAndModify.Sort, Projection: findAndModify.Projection}).Named(m.naming, d)
+
+	index, err := m.first(d.DocumentName(), filter, findOptions.Sort)
+
+	if err != nil {
+		return operationError("FindOneAndDelete", d, filter, err)
+	}
+
+	if index < 0 {
+		return operationError("FindOneAndDelete", d, filter, driver.ErrNoDocuments)
+	}
+
+	doc := m.store.collections[d.DocumentName()][index]
+
+	m.removeAt(d.DocumentName(), []int{index})
+
+	return operationError("FindOneAndDelete", d, filter, m.decodeProjected(doc, d, findOptions))
+}
+
+func (m *MemoryClient) writeModel(collection string, model driver.WriteModel, result *mongo.BulkWriteResult) error {
+	switch w := model.(type) {
+	case *driver.InsertOneModel:
+		doc, err := m.encode(w.Document)
+
+		if err != nil {
+			return err
+		}
+
+		err = m.insert(collection, doc)
+
+		if err == nil {
+			result.InsertedCount++
+		}
+
+		return err
+	case *driver.ReplaceOneModel:
+		doc, err := m.encode(w.Replacement)
+
+		if err != nil {
+			return err
+		}
+
+		matched, err := m.find(collection, w.Filter)
+
+		if err != nil || len(matched) == 0 {
+			return err
+		}
+
+		result.MatchedCount++
+		result.ModifiedCount++
+
+		return m.replaceAt(collection, matched[0], doc)
+	case *driver.UpdateOneModel:
+		var filters []interface{}
+
+		if w.ArrayFilters != nil {
+			filters = w.ArrayFilters.Filters
+		}
+
+		res, err := m.update(collection, w.Filter, w.Update, filters, false)
+
+		if err != nil {
+			return err
+		}
+
+		result.MatchedCount += res.MatchedCount
+		result.ModifiedCount += res.ModifiedCount
+
+		return nil
+	case *driver.UpdateManyModel:
+		var filters []interface{}
+
+		if w.ArrayFilters != nil {
+			filters = w.ArrayFilters.Filters
+		}
+
+		res, err := m.update(collection, w.Filter, w.Update, filters, true)
+
+		if err != nil {
+			return err
+		}
+
+		result.MatchedCount += res.MatchedCount
+		result.ModifiedCount += res.ModifiedCount
+
+		return nil
+	case *driver.DeleteOneModel:
+		matched, err := m.find(collection, w.Filter)
+
+		if err != nil || len(matched) == 0 {
+			return err
+		}
+
+		m.removeAt(collection, matched[:1])
+		result.DeletedCount++
+
+		return nil
+	case *driver.DeleteManyModel:
+		matched, err := m.find(collection, w.Filter)
+
+		if err != nil {
+			return err
+		}
+
+		m.removeAt(collection, matched)
+		result.DeletedCount += int64(len(matched))
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: write model %T", ErrNotSupported, model)
+}
+
+func (m *MemoryClient) BulkWrite(b *mongo.BulkWriteBuilder) (*mongo.BulkWriteResult, error) {
+	result := &mongo.BulkWriteResult{
+		UpsertedIDs: make(map[int]interface{}),
+	}
+
+	if err := b.Err(); err != nil {
+		return result, operationError("BulkWrite", b.Document(), nil, err)
+	}
+
+	if b.Len() == 0 {
+		return result, nil
+	}
+
+	models, err := b.Models(m.updateConfig(b.Document()))
+
+	if err != nil {
+		return result, operationError("BulkWrite", b.Document(), nil, err)
+	}
+
+	unlock, err := m.lock()
+
+	if err != nil {
+		return result, operationError("BulkWrite", b.Document(), nil, err)
+	}
+
+	defer unlock()
+
+	var bulkErr driver.BulkWriteException
+
+	for i, model := range models {
+		err = m.writeModel(b.Document().DocumentName(), model, result)
+
+		if err == nil {
+			continue
+		}
+
+		writeErr := driver.WriteError{Index: i, Message: err.Error()}
+
+		var writeException driver.WriteException
+
+		if errors.As(err, &writeException) && len(writeException.WriteErrors) > 0 {
+			writeErr.Code = writeException.WriteErrors[0].Code
+			writeErr.Message = writeException.WriteErrors[0].Message
+		}
+
+		bulkErr.WriteErrors = append(bulkErr.WriteErrors, driver.BulkWriteError{WriteError: writeErr, Request: model})
+		result.Errors = append(result.Errors, mongo.BulkWriteError{Index: i, Code: writeErr.Code, Message: writeErr.Message})
+
+		if b.IsOrdered() {
+			break
+		}
+	}
+
+	if len(bulkErr.WriteErrors) > 0 {
+		return result, operationError("BulkWrite", b.Document(), nil, bulkErr)
+	}
+
+	return result, nil
+}
+
+// ReplaceMany replaces docs through BulkWrite, as the client does.
+func (m *MemoryClient) ReplaceMany(docs []mongo.Document) (*mongo.BulkWriteResult, error) {
+	if len(docs) == 0 {
+		return &mongo.BulkWriteResult{UpsertedIDs: make(map[int]interface{})}, nil
+	}
+
+	d := docs[0]
+
+	for i, doc := range docs {
+		if doc.DocumentName() != d.DocumentName() {
+			return nil, operationError("ReplaceMany", d, nil, fmt.Errorf("document %d belongs to collection %s", i, doc.DocumentName()))
+		}
+	}
+
+	result, err := m.BulkWrite(mongo.NewBulkWrite(d).Replace(docs...))
+
+	if err == nil && result.MatchedCount < int64(len(docs)) {
+		err = operationError("ReplaceMany", d, nil, mongo.ErrNotFound)
+	}
+
+	return result, err
+}
+
+// EnsureIndexes records the declared indexes. Unique indexes are enforced by
+// later writes, the other ones are only reported.
+func (m *MemoryClient) EnsureIndexes(opts *mongo.EnsureIndexesOptions, docs ...mongo.Document) (*mongo.IndexReport, error) {
+	if opts == nil {
+		opts = &mongo.EnsureIndexesOptions{}
+	}
+
+	report := &mongo.IndexReport{}
+
+	unlock, err := m.lock()
+
+	if err != nil {
+		return report, operationError("EnsureIndexes", nil, nil, err)
+	}
+
+	defer unlock()
+
+	for _, d := range docs {
+		indexed, ok := d.(mongo.IndexedDocument)
+
+		if !ok {
+			continue
+		}
+
+		collection := d.DocumentName()
+		declared := indexed.Indexes()
+
+		existing := make(map[string]bool)
+
+		for _, spec := range m.store.indexes[collection] {
+			existing[spec.IndexName()] = true
+		}
+
+		kept := make(map[string]bool)
+
+		for _, spec := range declared {
+			kept[spec.IndexName()] = true
+
+			if !existing[spec.IndexName()] {
+				report.Created = append(report.Created, mongo.IndexReference{Collection: collection, Name: spec.IndexName()})
+			}
+		}
+
+		var specs []mongo.IndexSpec
+
+		for _, spec := range m.store.indexes[collection] {
+			if kept[spec.IndexName()] {
+				continue
+			}
+
+			reference := mongo.IndexReference{Collection: collection, Name: spec.IndexName()}
+			report.Undeclared = append(report.Undeclared, reference)
+
+			if opts.DropUndeclared {
+				report.Dropped = append(report.Dropped, reference)
+			} else {
+				specs = append(specs, spec)
+			}
+		}
+
+		m.store.indexes[collection] = append(specs, declared...)
+	}
+
+	return report, nil
+}
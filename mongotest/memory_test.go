@@ -0,0 +1,936 @@
+package mongotest
+
+import (
+	"context"
+	"errors"
+	mongo "github.com/luxation/go-mongo/v2"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"testing"
+	"time"
+)
+
+type Item struct {
+	mongo.BasicDocument `bson:",inline"`
+	Name                string `bson:"name"`
+	Category            string `bson:"category"`
+	Price               int    `bson:"price"`
+}
+
+func (i Item) DocumentName() string { return "items" }
+
+type UniqueItem struct {
+	Item `bson:",inline"`
+}
+
+func (i UniqueItem) Indexes() []mongo.IndexSpec {
+	return []mongo.IndexSpec{
+		{Keys: []mongo.IndexKey{{Field: "name"}}, Unique: true},
+	}
+}
+
+func seed(t *testing.T, client mongo.Client) {
+	for _, item := range []*Item{
+		{Name: "apple", Category: "fruit", Price: 3},
+		{Name: "banana", Category: "fruit", Price: 1},
+		{Name: "carrot", Category: "vegetable", Price: 2},
+	} {
+		assert.Nil(t, client.Persist(item))
+	}
+}
+
+func names(t *testing.T, client mongo.Client, filter bson.M, findOptions ...*mongo.FindOptions) []string {
+	var res []string
+
+	err := client.FindAll(&Item{}, filter, func(cursor mongo.ResultCursor) error {
+		var item Item
+
+		err := cursor.Decode(&item)
+
+		if err != nil {
+			return err
+		}
+
+		res = append(res, item.Name)
+
+		return nil
+	}, findOptions...)
+
+	assert.Nil(t, err)
+
+	return res
+}
+
+func TestMemoryClientPersistAndFind(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	var item Item
+
+	err := client.FindOne(&item, bson.M{"name": "banana"})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, item.GetID())
+	assert.False(t, item.CreatedAt.IsZero())
+	assert.Equal(t, 1, item.Price)
+
+	var byID Item
+
+	assert.Nil(t, client.FindOneById(&byID, item.GetID()))
+	assert.Equal(t, "banana", byID.Name)
+
+	err = client.FindOne(&Item{}, bson.M{"name": "durian"})
+	assert.True(t, errors.Is(err, mongo.ErrNotFound))
+
+	err = client.Persist(&byID)
+	assert.True(t, errors.Is(err, mongo.ErrDuplicateKey))
+}
+
+func TestMemoryClientFindAllSortAndLimit(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	limit := int64(2)
+
+	assert.Equal(t, []string{"apple", "carrot", "banana"}, names(t, client, nil, &mongo.FindOptions{
+		Sort: []mongo.SortOption{{SortField: "price", Order: mongo.OrderDESC}},
+	}))
+
+	assert.Equal(t, []string{"banana", "apple"}, names(t, client, bson.M{"category": "fruit"}, &mongo.FindOptions{
+		Sort:       []mongo.SortOption{{SortField: "price", Order: mongo.OrderASC}},
+		Pagination: &mongo.PaginationOption{Limit: &limit},
+	}))
+
+	assert.Equal(t, []string{"apple", "carrot"}, names(t, client, bson.M{"price": bson.M{"$gte": 2}}))
+}
+
+func TestMemoryClientFindSkip(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	limit := int64(2)
+	sort := []mongo.SortOption{{SortField: "price", Order: mongo.OrderDESC}}
+
+	assert.Equal(t, []string{"carrot", "banana"}, names(t, client, nil, &mongo.FindOptions{
+		Sort:       sort,
+		Pagination: &mongo.PaginationOption{Skip: 1},
+	}))
+
+	assert.Equal(t, []string{"banana"}, names(t, client, nil, &mongo.FindOptions{
+		Sort:       sort,
+		Pagination: &mongo.PaginationOption{Limit: &limit, Page: 2},
+	}))
+
+	var item Item
+	assert.Nil(t, client.FindOne(&item, nil, &mongo.FindOptions{Sort: sort, Pagination: &mongo.PaginationOption{Skip: 1}}))
+	assert.Equal(t, "carrot", item.Name)
+
+	err := client.FindOne(&item, nil, &mongo.FindOptions{Pagination: &mongo.PaginationOption{Skip: 3}})
+	assert.True(t, errors.Is(err, mongo.ErrNotFound))
+
+	err = client.FindAll(&Item{}, nil, func(mongo.ResultCursor) error { return nil }, &mongo.FindOptions{
+		Pagination: &mongo.PaginationOption{Limit: &limit, Cursor: "cursor"},
+	})
+	assert.True(t, errors.Is(err, mongo.ErrInvalidCursor))
+}
+
+func TestMemoryClientUpdatesAndDeletes(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	var banana Item
+	assert.Nil(t, client.FindOne(&banana, bson.M{"name": "banana"}))
+
+	result, err := client.Update(&Item{}, banana.GetID(), bson.M{"price": 4})
+	assert.Nil(t, err)
+	assert.Equal(t, &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, result)
+
+	result, err = client.UpdateMany(&Item{}, bson.M{"category": "fruit"}, bson.M{"category": "fresh"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.MatchedCount)
+
+	assert.Equal(t, []string{"apple", "banana"}, names(t, client, bson.M{"category": "fresh"}))
+	assert.Equal(t, []string{"banana"}, names(t, client, bson.M{"price": 4}))
+
+	assert.Nil(t, client.DeleteWhere(&Item{}, "name", "carrot"))
+	assert.True(t, errors.Is(client.DeleteWhere(&Item{}, "name", "carrot"), mongo.ErrNotFound))
+
+	deleted, err := client.DeleteMany(&Item{}, bson.M{"category": "fresh"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), deleted)
+	assert.Empty(t, client.Documents("items"))
+}
+
+func TestMemoryClientStrictUpdates(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	result, err := client.Update(&Item{}, "missing", bson.M{"price": 4})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), result.MatchedCount)
+
+	client.SetStrictUpdates(true)
+
+	result, err = client.Update(&Item{}, "missing", bson.M{"price": 4})
+	assert.True(t, errors.Is(err, mongo.ErrNotFound))
+	assert.Equal(t, int64(0), result.MatchedCount)
+
+	result, err = client.UpdateWhere(&Item{}, bson.M{"name": "missing"}, bson.M{"price": 4})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), result.MatchedCount)
+
+	var apple Item
+	assert.Nil(t, client.FindOne(&apple, bson.M{"name": "apple"}))
+
+	result, err = client.Update(&Item{}, apple.GetID(), mongo.NewUpdate().Set("name", "apple"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.MatchedCount)
+}
+
+func TestMemoryClientUpdateFlattenError(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	_, err := client.UpdateMany(&Item{}, bson.M{}, bson.M{"tags": make(chan string)})
+
+	var flattenErr *mongo.FlattenError
+	assert.True(t, errors.As(err, &flattenErr))
+	assert.Equal(t, "tags", flattenErr.Path)
+	assert.Equal(t, []string{"apple", "banana", "carrot"}, names(t, client, bson.M{"tags": bson.M{"$exists": false}}))
+}
+
+type Profile struct {
+	mongo.BasicDocument `bson:",inline"`
+	DisplayName         string
+	LoginCount          int
+}
+
+func (p Profile) DocumentName() string { return "profiles" }
+
+func TestMemoryClientNamingStrategy(t *testing.T) {
+	client := NewMemoryClient().SetNamingStrategy(mongo.SnakeCaseNaming)
+
+	for _, name := range []string{"bob", "alice"} {
+		assert.Nil(t, client.Persist(&Profile{DisplayName: name}))
+	}
+
+	assert.Contains(t, client.Documents("profiles")[0], bson.E{Key: "display_name", Value: "bob"})
+
+	_, err := client.UpdateWhere(&Profile{}, bson.M{"display_name": "bob"}, bson.M{"loginCount": 2})
+	assert.Nil(t, err)
+
+	var profiles []string
+
+	err = client.FindAll(&Profile{}, bson.M{}, func(cursor mongo.ResultCursor) error {
+		var profile Profile
+
+		if err := cursor.Decode(&profile); err != nil {
+			return err
+		}
+
+		profiles = append(profiles, profile.DisplayName)
+
+		return nil
+	}, &mongo.FindOptions{Sort: []mongo.SortOption{{SortField: "displayName", Order: mongo.OrderASC}}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, profiles)
+
+	var bob Profile
+	assert.Nil(t, client.FindOne(&bob, bson.M{"login_count": 2}))
+	assert.Equal(t, "bob", bob.DisplayName)
+
+	var projected Profile
+	assert.Nil(t, client.FindOne(&projected, bson.M{"display_name": "bob"}, &mongo.FindOptions{
+		Projection: []mongo.ProjectionOption{{Field: "createdAt"}, {Field: "loginCount"}},
+	}))
+	assert.False(t, projected.CreatedAt.IsZero())
+	assert.Equal(t, 2, projected.LoginCount)
+	assert.Empty(t, projected.DisplayName)
+
+	_, err = client.UpdateWhere(&Profile{}, bson.M{"display_name": "alice"}, mongo.NewUpdate().SetFields(bson.M{"loginCount": 5}))
+	assert.Nil(t, err)
+
+	_, err = client.BulkWrite(mongo.NewBulkWrite(&Profile{}).UpdateWhere(bson.M{"display_name": "bob"}, struct{ LoginCount int }{7}))
+	assert.Nil(t, err)
+
+	count, err := client.Count(&Profile{}, bson.M{"login_count": bson.M{"$in": bson.A{5, 7}}})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestMemoryClientNamingStrategyUpdateBuilder(t *testing.T) {
+	client := NewMemoryClient().SetNamingStrategy(mongo.SnakeCaseNaming)
+	profile := &Profile{DisplayName: "a"}
+	assert.Nil(t, client.Persist(profile))
+
+	_, err := client.Update(&Profile{}, profile.ID, bson.M{"displayName": "b"})
+	assert.Nil(t, err)
+
+	_, err = client.Update(&Profile{}, profile.ID, mongo.NewUpdate().Set("displayName", "c").Inc("loginCount", 2))
+	assert.Nil(t, err)
+
+	var keys []string
+
+	for _, e := range client.Documents("profiles")[0] {
+		keys = append(keys, e.Key)
+	}
+
+	assert.Contains(t, keys, "display_name")
+	assert.NotContains(t, keys, "displayName")
+	assert.NotContains(t, keys, "loginCount")
+
+	var updated Profile
+	assert.Nil(t, client.FindOneById(&updated, profile.ID))
+	assert.Equal(t, "c", updated.DisplayName)
+	assert.Equal(t, 2, updated.LoginCount)
+}
+
+type ItemPatch struct {
+	Category mongo.Optional[string] `bson:"category"`
+	Price    mongo.Optional[int]    `bson:"price"`
+}
+
+func TestMemoryClientOptionalPatch(t *testing.T) {
+	client := NewMemoryClient().SetNullPolicy(mongo.NullUnset)
+	seed(t, client)
+
+	_, err := client.UpdateWhere(&Item{}, bson.M{"name": "apple"}, ItemPatch{Category: mongo.Null[string](), Price: mongo.Set(0)})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"apple"}, names(t, client, bson.M{"category": bson.M{"$exists": false}, "price": 0}))
+
+	_, err = client.UpdateWhere(&Item{}, bson.M{"name": "banana"}, ItemPatch{Price: mongo.Set(5)})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"banana"}, names(t, client, bson.M{"category": "fruit", "price": 5}))
+
+	client.SetNullPolicy(mongo.NullSet)
+
+	_, err = client.UpdateWhere(&Item{}, bson.M{"name": "banana"}, ItemPatch{Category: mongo.Null[string]()})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"banana"}, names(t, client, bson.M{"category": bson.M{"$exists": true, "$eq": nil}}))
+}
+
+type OrderLine struct {
+	Sku string `bson:"sku"`
+	Qty int    `bson:"qty"`
+}
+
+type Order struct {
+	mongo.BasicDocument `bson:",inline"`
+	Lines               []OrderLine `bson:"lines"`
+}
+
+func (o Order) DocumentName() string { return "orders" }
+
+func TestMemoryClientArrayElements(t *testing.T) {
+	client := NewMemoryClient()
+
+	order := &Order{Lines: []OrderLine{{Sku: "A1", Qty: 1}, {Sku: "B2", Qty: 1}, {Sku: "C3", Qty: 1}}}
+	assert.Nil(t, client.Persist(order))
+
+	update := mongo.NewUpdate().SetElements("lines", bson.M{"sku": bson.M{"$in": bson.A{"A1", "C3"}}}, bson.M{"qty": 5})
+
+	result, err := client.Update(&Order{}, order.GetID(), update)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+
+	var stored Order
+	assert.Nil(t, client.FindOneById(&stored, order.GetID()))
+	assert.Equal(t, []OrderLine{{Sku: "A1", Qty: 5}, {Sku: "B2", Qty: 1}, {Sku: "C3", Qty: 5}}, stored.Lines)
+
+	_, err = client.Update(&Order{}, order.GetID(), mongo.ElementPaths(Order{Lines: []OrderLine{{Sku: "A0", Qty: 2}}}))
+	assert.Nil(t, err)
+
+	assert.Nil(t, client.FindOneById(&stored, order.GetID()))
+	assert.Equal(t, []OrderLine{{Sku: "A0", Qty: 2}, {Sku: "B2", Qty: 1}, {Sku: "C3", Qty: 5}}, stored.Lines)
+}
+
+type Customer struct {
+	mongo.BasicDocument `bson:",inline"`
+	Name                string            `json:"name" bson:"name"`
+	Email               string            `json:"email,omitempty" bson:"email,omitempty"`
+	Labels              map[string]string `json:"labels" bson:"labels"`
+	Lines               []OrderLine       `json:"lines" bson:"lines"`
+}
+
+func (c Customer) DocumentName() string { return "customers" }
+
+func TestMemoryClientMergePatch(t *testing.T) {
+	client := NewMemoryClient()
+
+	customer := &Customer{Name: "Ada", Email: "ada@example.com", Labels: map[string]string{"tier": "gold"}}
+	assert.Nil(t, client.Persist(customer))
+
+	result, err := client.ApplyMergePatch(&Customer{}, customer.GetID(), []byte(`{"name": "Grace", "email": null, "labels": {"region": "eu"}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+
+	var stored Customer
+	assert.Nil(t, client.FindOneById(&stored, customer.GetID()))
+	assert.Equal(t, "Grace", stored.Name)
+	assert.Equal(t, "", stored.Email)
+	assert.Equal(t, map[string]string{"tier": "gold", "region": "eu"}, stored.Labels)
+
+	_, err = client.ApplyMergePatch(&Customer{}, "missing", []byte(`{"name": "Grace"}`))
+	assert.True(t, errors.Is(err, mongo.ErrNotFound))
+
+	_, err = client.ApplyMergePatch(&Customer{}, customer.GetID(), []byte(`{"nickname": "G"}`))
+	assert.True(t, errors.Is(err, mongo.ErrInvalidPatch))
+}
+
+func TestMemoryClientMergePatchNullSubdocument(t *testing.T) {
+	client := NewMemoryClient()
+
+	customer := &Customer{Name: "Ada"}
+	assert.Nil(t, client.Persist(customer))
+	assert.Contains(t, client.Documents("customers")[0], bson.E{Key: "labels", Value: nil})
+
+	_, err := client.ApplyMergePatch(&Customer{}, customer.GetID(), []byte(`{"labels": {"tier": "gold"}}`))
+	assert.Nil(t, err)
+
+	_, err = client.ApplyMergePatch(&Customer{}, customer.GetID(), []byte(`{"labels": {"region": "eu"}}`))
+	assert.Nil(t, err)
+
+	var stored Customer
+	assert.Nil(t, client.FindOneById(&stored, customer.GetID()))
+	assert.Equal(t, map[string]string{"tier": "gold", "region": "eu"}, stored.Labels)
+}
+
+func TestMemoryClientJSONPatchAddIndex(t *testing.T) {
+	client := NewMemoryClient()
+
+	customer := &Customer{Name: "Ada", Lines: []OrderLine{{Sku: "A1"}, {Sku: "B2"}}}
+	assert.Nil(t, client.Persist(customer))
+
+	_, err := client.ApplyJSONPatch(&Customer{}, customer.GetID(), []mongo.PatchOperation{
+		{Op: "add", Path: "/lines/10", Value: []byte(`{"sku": "Z9"}`)},
+	})
+	assert.True(t, errors.Is(err, mongo.ErrPatchFailed))
+
+	_, err = client.ApplyJSONPatch(&Customer{}, customer.GetID(), []mongo.PatchOperation{
+		{Op: "add", Path: "/lines/2", Value: []byte(`{"sku": "C3"}`)},
+	})
+	assert.Nil(t, err)
+
+	var stored Customer
+	assert.Nil(t, client.FindOneById(&stored, customer.GetID()))
+	assert.Equal(t, []OrderLine{{Sku: "A1"}, {Sku: "B2"}, {Sku: "C3"}}, stored.Lines)
+}
+
+func TestMemoryClientSetUnderNull(t *testing.T) {
+	client := NewMemoryClient()
+
+	customer := &Customer{Name: "Ada", Lines: []OrderLine{{Sku: "A1"}}}
+	assert.Nil(t, client.Persist(customer))
+
+	_, err := client.Update(&Customer{}, customer.GetID(), mongo.NewUpdate().Set("labels.tier", "gold"))
+	assert.NotNil(t, err)
+
+	_, err = client.Update(&Customer{}, customer.GetID(), mongo.NewUpdate().Set("name.first", "Ada"))
+	assert.NotNil(t, err)
+
+	_, err = client.Update(&Customer{}, customer.GetID(), mongo.NewUpdate().Set("address.city", "Paris").Set("lines.2.sku", "B2"))
+	assert.Nil(t, err)
+
+	doc := client.Documents("customers")[0]
+	assert.Contains(t, doc, bson.E{Key: "labels", Value: nil})
+	assert.Contains(t, doc, bson.E{Key: "address", Value: bson.D{{Key: "city", Value: "Paris"}}})
+
+	lines, _ := getPath(doc, "lines")
+	assert.Equal(t, bson.A{nil, bson.D{{Key: "sku", Value: "B2"}}}, lines.(bson.A)[1:])
+}
+
+func TestMemoryClientJSONPatch(t *testing.T) {
+	client := NewMemoryClient()
+
+	customer := &Customer{Name: "Ada", Lines: []OrderLine{{Sku: "A1", Qty: 1}, {Sku: "B2", Qty: 2}, {Sku: "C3", Qty: 3}}}
+	assert.Nil(t, client.Persist(customer))
+
+	ops, err := mongo.ParseJSONPatch([]byte(`[
+		{"op": "test", "path": "/lines/1/sku", "value": "B2"},
+		{"op": "remove", "path": "/lines/1"},
+		{"op": "add", "path": "/lines/0", "value": {"sku": "Z0", "qty": 9}},
+		{"op": "replace", "path": "/lines/2/qty", "value": 4},
+		{"op": "add", "path": "/labels", "value": {"tier": "gold"}}
+	]`))
+	assert.Nil(t, err)
+
+	result, err := client.ApplyJSONPatch(&Customer{}, customer.GetID(), ops)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+
+	var stored Customer
+	assert.Nil(t, client.FindOneById(&stored, customer.GetID()))
+	assert.Equal(t, []OrderLine{{Sku: "Z0", Qty: 9}, {Sku: "A1", Qty: 1}, {Sku: "C3", Qty: 4}}, stored.Lines)
+	assert.Equal(t, map[string]string{"tier": "gold"}, stored.Labels)
+
+	ops = []mongo.PatchOperation{
+		{Op: "replace", Path: "/name", Value: []byte(`"Grace"`)},
+		{Op: "remove", Path: "/lines/0"},
+		{Op: "test", Path: "/lines/0/sku", Value: []byte(`"B2"`)},
+	}
+
+	_, err = client.ApplyJSONPatch(&Customer{}, customer.GetID(), ops)
+	assert.True(t, errors.Is(err, mongo.ErrPatchFailed))
+
+	assert.Nil(t, client.FindOneById(&stored, customer.GetID()))
+	assert.Equal(t, "Ada", stored.Name)
+	assert.Len(t, stored.Lines, 3)
+
+	_, err = client.ApplyJSONPatch(&Customer{}, customer.GetID(), []mongo.PatchOperation{{Op: "remove", Path: "/email"}})
+	assert.True(t, errors.Is(err, mongo.ErrPatchFailed))
+
+	_, err = client.ApplyJSONPatch(&Customer{}, "missing", []mongo.PatchOperation{{Op: "remove", Path: "/email"}})
+	assert.True(t, errors.Is(err, mongo.ErrNotFound))
+}
+
+func TestMemoryClientReplaceOrPersist(t *testing.T) {
+	client := NewMemoryClient()
+
+	item := &Item{Name: "apple"}
+
+	inserted, err := client.ReplaceOrPersist(item)
+	assert.Nil(t, err)
+	assert.True(t, inserted)
+
+	var stored Item
+	assert.Nil(t, client.FindOneById(&stored, item.GetID()))
+
+	replacement := &Item{BasicDocument: mongo.BasicDocument{ID: item.GetID()}, Name: "pear"}
+
+	inserted, err = client.ReplaceOrPersist(replacement)
+	assert.Nil(t, err)
+	assert.False(t, inserted)
+
+	var replaced Item
+	assert.Nil(t, client.FindOneById(&replaced, item.GetID()))
+	assert.Equal(t, "pear", replaced.Name)
+	assert.True(t, stored.CreatedAt.Equal(replaced.CreatedAt))
+
+	assert.True(t, errors.Is(client.Replace(&Item{BasicDocument: mongo.BasicDocument{ID: "missing"}}), mongo.ErrNotFound))
+}
+
+func TestMemoryClientBulkWrite(t *testing.T) {
+	client := NewMemoryClient()
+
+	apple := &Item{Name: "apple"}
+
+	b := mongo.NewBulkWrite(&Item{}).
+		Insert(apple, &Item{Name: "banana"}).
+		UpdateWhere(bson.M{"name": "banana"}, bson.M{"price": 2}).
+		Insert(apple).
+		DeleteMany(bson.M{"name": "apple"})
+
+	result, err := client.BulkWrite(b)
+
+	assert.True(t, errors.Is(err, mongo.ErrDuplicateKey))
+	assert.Equal(t, int64(2), result.InsertedCount)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+	assert.Len(t, result.Errors, 1)
+	assert.Equal(t, 3, result.Errors[0].Index)
+	assert.Len(t, client.Documents("items"), 2)
+
+	result, err = client.BulkWrite(mongo.NewBulkWrite(&Item{}).Ordered(false).Insert(apple).DeleteMany(bson.M{"name": "apple"}))
+
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(1), result.DeletedCount)
+	assert.Len(t, client.Documents("items"), 1)
+}
+
+func TestMemoryClientReplaceMany(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	var items []*Item
+	assert.Nil(t, client.FindAll(&Item{}, bson.M{"category": "fruit"}, func(cursor mongo.ResultCursor) error {
+		var item Item
+		items = append(items, &item)
+		return cursor.Decode(&item)
+	}))
+
+	docs := make([]mongo.Document, len(items))
+
+	for i, item := range items {
+		item.Price = 10
+		docs[i] = item
+	}
+
+	result, err := client.ReplaceMany(docs)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.MatchedCount)
+	assert.Equal(t, []string{"apple", "banana"}, names(t, client, bson.M{"price": 10}))
+
+	result, err = client.ReplaceMany([]mongo.Document{items[0], &Item{BasicDocument: mongo.BasicDocument{ID: "missing"}}})
+	assert.True(t, errors.Is(err, mongo.ErrNotFound))
+	assert.Equal(t, int64(1), result.MatchedCount)
+
+	_, err = client.ReplaceMany([]mongo.Document{items[0], &Order{}})
+	assert.NotNil(t, err)
+}
+
+func TestMemoryClientUniqueIndexes(t *testing.T) {
+	client := NewMemoryClient()
+
+	report, err := client.EnsureIndexes(nil, &UniqueItem{})
+	assert.Nil(t, err)
+	assert.Equal(t, []mongo.IndexReference{{Collection: "items", Name: "name_1"}}, report.Created)
+
+	assert.Nil(t, client.Persist(&UniqueItem{Item: Item{Name: "apple"}}))
+
+	err = client.Persist(&UniqueItem{Item: Item{Name: "apple"}})
+	assert.True(t, errors.Is(err, mongo.ErrDuplicateKey))
+}
+
+func TestMemoryClientTransactionRollback(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	failure := errors.New("failure")
+
+	err := client.WithTransaction(context.Background(), func(ctx context.Context) error {
+		_, err := client.WithContext(ctx).DeleteMany(&Item{}, bson.M{})
+
+		if err != nil {
+			return err
+		}
+
+		return failure
+	})
+
+	assert.True(t, errors.Is(err, failure))
+	assert.Len(t, client.Documents("items"), 3)
+}
+
+func TestMemoryClientContextAndConnection(t *testing.T) {
+	client := NewMemoryClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := client.WithContext(ctx).Persist(&Item{})
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	assert.Nil(t, client.Disconnect())
+	assert.True(t, errors.Is(client.Persist(&Item{}), mongo.ErrNotConnected))
+	assert.Nil(t, client.Connect())
+	assert.Nil(t, client.HealthCheck())
+
+	_, err = client.GetCollection(&Item{})
+	assert.True(t, errors.Is(err, ErrNotSupported))
+}
+
+func TestMemoryClientAggregate(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	var counts []bson.M
+
+	err := client.Aggregate(&Item{}, bson.A{
+		bson.M{"$match": bson.M{"category": "fruit"}},
+		bson.M{"$count": "total"},
+	}, func(cursor mongo.ResultCursor) error {
+		var res bson.M
+		err := cursor.Decode(&res)
+		counts = append(counts, res)
+		return err
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []bson.M{{"total": int32(2)}}, counts)
+
+	err = client.Aggregate(&Item{}, bson.A{bson.M{"$group": bson.M{"_id": "$category"}}}, func(cursor mongo.ResultCursor) error {
+		return nil
+	})
+	assert.True(t, errors.Is(err, ErrNotSupported))
+}
+
+func TestMemoryClientStreams(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	stream, err := client.FindStream(&Item{}, bson.M{"category": "fruit"}, &mongo.FindOptions{
+		Sort: []mongo.SortOption{{SortField: "price", Order: mongo.OrderASC}},
+	})
+	assert.Nil(t, err)
+
+	items, err := mongo.NewIterator[*Item](stream).All(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "banana", items[0].Name)
+
+	stream, err = client.AggregateStream(&Item{}, bson.A{bson.M{"$count": "total"}})
+	assert.Nil(t, err)
+
+	counts, errs, stop := mongo.NewChannel[bson.M](context.Background(), stream, 1)
+	defer stop()
+	assert.Equal(t, bson.M{"total": int32(3)}, <-counts)
+	assert.Nil(t, <-errs)
+
+	_, err = client.AggregateStream(&Item{}, bson.A{bson.M{"$group": bson.M{"_id": "$category"}}})
+	assert.True(t, errors.Is(err, ErrNotSupported))
+}
+
+func TestMemoryClientProjection(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	var item Item
+
+	err := client.FindOne(&item, bson.M{"name": "apple"}, &mongo.FindOptions{
+		Projection: []mongo.ProjectionOption{{Field: "name"}},
+	})
+
+	assert.Nil(t, err)
+	assert.NotEmpty(t, item.GetID())
+	assert.Equal(t, "apple", item.Name)
+	assert.Empty(t, item.Category)
+	assert.Zero(t, item.Price)
+
+	assert.Equal(t, []string{"", "", ""}, names(t, client, nil, &mongo.FindOptions{
+		Projection: []mongo.ProjectionOption{{Field: "name", Exclude: true}},
+	}))
+}
+
+func TestMemoryClientMultiKeySortAndCollation(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+	assert.Nil(t, client.Persist(&Item{Name: "Avocado", Category: "fruit", Price: 3}))
+
+	sort, err := mongo.ParseSort("category,-price,name")
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"Avocado", "apple", "banana", "carrot"}, names(t, client, nil, &mongo.FindOptions{Sort: sort}))
+
+	assert.Equal(t, []string{"apple", "Avocado", "banana", "carrot"}, names(t, client, nil, &mongo.FindOptions{
+		Sort:      []mongo.SortOption{{SortField: "name", Order: mongo.OrderASC}},
+		Collation: &options.Collation{Locale: "en", Strength: 2},
+	}))
+
+	err = client.FindAll(&Item{}, nil, func(cursor mongo.ResultCursor) error {
+		return nil
+	}, &mongo.FindOptions{Sort: []mongo.SortOption{{SortField: "score", TextScore: true}}})
+	assert.True(t, errors.Is(err, ErrNotSupported))
+}
+
+func TestMemoryClientKeysetPagination(t *testing.T) {
+	client := NewMemoryClient()
+	repository := mongo.NewRepository[*Item](client)
+
+	for i, name := range []string{"a", "b", "c", "d", "e"} {
+		assert.Nil(t, repository.Create(&Item{Name: name, Category: "fruit", Price: i % 2}))
+	}
+
+	limit := int64(2)
+
+	findOptions := &mongo.FindOptions{
+		Sort:       []mongo.SortOption{{SortField: "price", Order: mongo.OrderDESC}, {SortField: "name", Order: mongo.OrderASC}},
+		Pagination: &mongo.PaginationOption{Limit: &limit},
+	}
+
+	pageNames := func(page *mongo.Page[*Item]) []string {
+		var res []string
+
+		for _, item := range page.Items {
+			res = append(res, item.Name)
+		}
+
+		return res
+	}
+
+	var pages [][]string
+
+	page, err := repository.Page(bson.M{"category": "fruit"}, findOptions)
+
+	for err == nil {
+		pages = append(pages, pageNames(page))
+
+		if !page.HasMore {
+			break
+		}
+
+		findOptions.Pagination.Cursor = page.NextCursor
+		page, err = repository.Page(bson.M{"category": "fruit"}, findOptions)
+	}
+
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"b", "d"}, {"a", "c"}, {"e"}}, pages)
+
+	findOptions.Pagination.Cursor = page.PrevCursor
+
+	page, err = repository.Page(bson.M{"category": "fruit"}, findOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c"}, pageNames(page))
+	assert.NotEmpty(t, page.PrevCursor)
+
+	findOptions.Pagination.Cursor = page.PrevCursor
+
+	page, err = repository.Page(bson.M{"category": "fruit"}, findOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "d"}, pageNames(page))
+	assert.Empty(t, page.PrevCursor)
+	assert.True(t, page.HasMore)
+
+	findOptions.Pagination.Cursor = "garbage"
+
+	_, err = repository.Page(nil, findOptions)
+	assert.True(t, errors.Is(err, mongo.ErrInvalidCursor))
+}
+
+func TestMemoryClientOffsetPagination(t *testing.T) {
+	client := NewMemoryClient()
+	repository := mongo.NewRepository[*Item](client)
+
+	for i, name := range []string{"a", "b", "c", "d", "e"} {
+		assert.Nil(t, repository.Create(&Item{Name: name, Category: "fruit", Price: i}))
+	}
+
+	assert.Nil(t, repository.Create(&Item{Name: "f", Category: "vegetable"}))
+
+	limit := int64(2)
+
+	findOptions := &mongo.FindOptions{
+		Sort:       []mongo.SortOption{{SortField: "price", Order: mongo.OrderDESC}},
+		Pagination: &mongo.PaginationOption{Limit: &limit, Page: 2},
+		Projection: []mongo.ProjectionOption{{Field: "name"}},
+	}
+
+	page, err := repository.Page(bson.M{"category": "fruit"}, findOptions)
+	assert.Nil(t, err)
+	assert.Len(t, page.Items, 2)
+	assert.Equal(t, "c", page.Items[0].Name)
+	assert.Zero(t, page.Items[0].Price)
+	assert.Equal(t, "b", page.Items[1].Name)
+	assert.Equal(t, int64(5), page.TotalCount)
+	assert.Equal(t, int64(2), page.Page)
+	assert.True(t, page.HasMore)
+
+	findOptions.Pagination.Page = 3
+
+	page, err = repository.Page(bson.M{"category": "fruit"}, findOptions)
+	assert.Nil(t, err)
+	assert.Len(t, page.Items, 1)
+	assert.False(t, page.HasMore)
+
+	page, err = repository.Page(bson.M{"category": "none"}, findOptions)
+	assert.Nil(t, err)
+	assert.Empty(t, page.Items)
+	assert.Zero(t, page.TotalCount)
+
+	findOptions.Pagination.MaxSkip = 2
+
+	_, err = repository.Page(nil, findOptions)
+	assert.True(t, errors.Is(err, mongo.ErrSkipTooLarge))
+}
+
+func TestMemoryClientCountExistsDistinct(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	count, err := client.Count(&Item{}, bson.M{"category": "fruit"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	count, err = client.EstimatedCount(&Item{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+
+	exists, err := client.Exists(&Item{}, bson.M{"name": "carrot"})
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	exists, err = client.Exists(&Item{}, bson.M{"name": "durian"})
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	values, err := client.Distinct(&Item{}, "category", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"fruit", "vegetable"}, values)
+
+	values, err = client.Distinct(&Item{}, "price", bson.M{"category": "vegetable"})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int32(2)}, values)
+
+	assert.Nil(t, client.Disconnect())
+
+	_, err = client.Exists(&Item{}, nil)
+	assert.True(t, errors.Is(err, mongo.ErrNotConnected))
+}
+
+func TestMemoryClientFindOneAndModify(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	sort := &mongo.FindAndModifyOptions{Sort: []mongo.SortOption{{SortField: "price", Order: mongo.OrderDESC}}}
+
+	var before Item
+
+	err := client.FindOneAndUpdate(&before, bson.M{"category": "fruit"}, bson.M{"price": 10}, false, sort)
+	assert.Nil(t, err)
+	assert.Equal(t, "apple", before.Name)
+	assert.Equal(t, 3, before.Price)
+
+	var after Item
+
+	err = client.FindOneAndUpdate(&after, bson.M{"name": "banana"}, bson.M{"price": 5}, true, &mongo.FindAndModifyOptions{
+		Projection: []mongo.ProjectionOption{{Field: "price"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, after.Price)
+	assert.Empty(t, after.Name)
+
+	err = client.FindOneAndUpdate(&Item{}, bson.M{"name": "durian"}, bson.M{"price": 1}, true)
+	assert.True(t, errors.Is(err, mongo.ErrNotFound))
+
+	var upserted Item
+
+	err = client.FindOneAndUpdate(&upserted, bson.M{"name": "durian"}, bson.M{"price": 7}, true, &mongo.FindAndModifyOptions{Upsert: true})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, upserted.GetID())
+	assert.Equal(t, "durian", upserted.Name)
+	assert.Equal(t, 7, upserted.Price)
+	assert.False(t, upserted.CreatedAt.IsZero())
+
+	var byID Item
+
+	err = client.FindOneAndUpdate(&byID, bson.M{"_id": "fig"}, bson.M{"name": "fig"}, true, &mongo.FindAndModifyOptions{Upsert: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "fig", byID.GetID())
+	assert.Equal(t, "fig", byID.Name)
+	assert.False(t, byID.CreatedAt.IsZero())
+
+	_, err = client.DeleteMany(&Item{}, bson.M{"_id": "fig"})
+	assert.Nil(t, err)
+
+	err = client.FindOneAndUpdate(&Item{}, bson.M{"_id": "fig"}, mongo.NewUpdate().SetOnInsert("_id", "other"), true, &mongo.FindAndModifyOptions{Upsert: true})
+	assert.NotNil(t, err)
+
+	var deleted Item
+
+	err = client.FindOneAndDelete(&deleted, bson.M{"category": "fruit"}, sort)
+	assert.Nil(t, err)
+	assert.Equal(t, "apple", deleted.Name)
+	assert.Equal(t, 10, deleted.Price)
+	assert.Len(t, client.Documents("items"), 3)
+
+	err = client.FindOneAndDelete(&Item{}, bson.M{"name": "apple"})
+	assert.True(t, errors.Is(err, mongo.ErrNotFound))
+}
+
+func TestMemoryClientUpdateBuilder(t *testing.T) {
+	client := NewMemoryClient()
+	seed(t, client)
+
+	time.Sleep(2 * time.Millisecond)
+
+	_, err := client.UpdateMany(&Item{}, bson.M{"category": "fruit"}, mongo.NewUpdate().Inc("price", 10).Push("tags", "sale"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"apple", "banana"}, names(t, client, bson.M{"tags": "sale", "price": bson.M{"$gt": 10}}))
+
+	var banana Item
+	assert.Nil(t, client.FindOne(&banana, bson.M{"name": "banana"}))
+	assert.True(t, banana.UpdatedAt.After(banana.CreatedAt))
+}
@@ -0,0 +1,291 @@
+package mongotest
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+)
+
+// project applies a find projection to doc. Plain fields are either all
+// included or all excluded, _id excepted, as MongoDB requires. $elemMatch
+// counts as an inclusion while $slice keeps the other fields.
+func project(doc bson.D, projection bson.D) (bson.D, error) {
+	if len(projection) == 0 {
+		return doc, nil
+	}
+
+	var included, excluded [][]string
+	var operators []bson.E
+
+	excludeID := false
+
+	for _, e := range projection {
+		if ops, ok := e.Value.(bson.D); ok {
+			if len(ops) != 1 {
+				return nil, fmt.Errorf("projection of %s expects a single operator", e.Key)
+			}
+
+			switch ops[0].Key {
+			case "$slice":
+			case "$elemMatch":
+				if strings.Contains(e.Key, ".") {
+					return nil, fmt.Errorf("$elemMatch cannot be used on the nested field %s", e.Key)
+				}
+
+				included = append(included, []string{e.Key})
+			default:
+				return nil, fmt.Errorf("unsupported projection operator %s", ops[0].Key)
+			}
+
+			operators = append(operators, e)
+
+			continue
+		}
+
+		switch {
+		case truthy(e.Value):
+			included = append(included, strings.Split(e.Key, "."))
+		case e.Key == "_id":
+			excludeID = true
+		default:
+			excluded = append(excluded, strings.Split(e.Key, "."))
+		}
+	}
+
+	if len(included) > 0 && len(excluded) > 0 {
+		return nil, fmt.Errorf("cannot mix inclusion and exclusion in a projection")
+	}
+
+	var res bson.D
+
+	if len(included) > 0 {
+		if !excludeID {
+			included = append(included, []string{"_id"})
+		}
+
+		res = includePaths(doc, included).(bson.D)
+	} else {
+		if excludeID {
+			excluded = append(excluded, []string{"_id"})
+		}
+
+		res = excludePaths(doc, excluded).(bson.D)
+	}
+
+	for _, op := range operators {
+		spec := op.Value.(bson.D)[0]
+
+		var err error
+
+		switch spec.Key {
+		case "$slice":
+			value, ok := getPath(doc, op.Key)
+
+			if !ok {
+				continue
+			}
+
+			if arr, isArray := value.(bson.A); isArray {
+				value, err = sliceArray(arr, spec.Value)
+
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			res, err = set(res, op.Key, value)
+		case "$elemMatch":
+			res, err = elemMatch(doc, res, op.Key, spec.Value)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// includePaths returns the parts of v reachable through paths. Array
+// elements are projected one by one, dropping the ones that are not
+// documents.
+func includePaths(v interface{}, paths [][]string) interface{} {
+	switch value := v.(type) {
+	case bson.D:
+		res := bson.D{}
+
+		for _, e := range value {
+			var rest [][]string
+
+			whole := false
+
+			for _, p := range paths {
+				if p[0] != e.Key {
+					continue
+				}
+
+				if len(p) == 1 {
+					whole = true
+					break
+				}
+
+				rest = append(rest, p[1:])
+			}
+
+			if whole {
+				res = append(res, e)
+			} else if len(rest) > 0 {
+				if child := includePaths(e.Value, rest); child != nil {
+					res = append(res, bson.E{Key: e.Key, Value: child})
+				}
+			}
+		}
+
+		return res
+	case bson.A:
+		res := bson.A{}
+
+		for _, item := range value {
+			if child, ok := item.(bson.D); ok {
+				res = append(res, includePaths(child, paths))
+			}
+		}
+
+		return res
+	}
+
+	return nil
+}
+
+func excludePaths(v interface{}, paths [][]string) interface{} {
+	switch value := v.(type) {
+	case bson.D:
+		res := make(bson.D, 0, len(value))
+
+		for _, e := range value {
+			var rest [][]string
+
+			drop := false
+
+			for _, p := range paths {
+				if p[0] != e.Key {
+					continue
+				}
+
+				if len(p) == 1 {
+					drop = true
+					break
+				}
+
+				rest = append(rest, p[1:])
+			}
+
+			if drop {
+				continue
+			}
+
+			if len(rest) > 0 {
+				e = bson.E{Key: e.Key, Value: excludePaths(e.Value, rest)}
+			}
+
+			res = append(res, e)
+		}
+
+		return res
+	case bson.A:
+		res := make(bson.A, len(value))
+
+		for i, item := range value {
+			res[i] = excludePaths(item, paths)
+		}
+
+		return res
+	}
+
+	return v
+}
+
+func sliceArray(arr bson.A, spec interface{}) (bson.A, error) {
+	var skip, limit int
+
+	if pair, ok := spec.(bson.A); ok {
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("$slice expects a number or a [skip, limit] pair")
+		}
+
+		s, skipOk := toFloat(pair[0])
+		l, limitOk := toFloat(pair[1])
+
+		if !skipOk || !limitOk || l <= 0 {
+			return nil, fmt.Errorf("$slice expects a number or a [skip, limit] pair")
+		}
+
+		skip, limit = int(s), int(l)
+
+		if skip < 0 {
+			skip += len(arr)
+		}
+	} else {
+		n, ok := toFloat(spec)
+
+		if !ok {
+			return nil, fmt.Errorf("$slice expects a number or a [skip, limit] pair")
+		}
+
+		limit = int(n)
+
+		if limit < 0 {
+			skip, limit = len(arr)+limit, -limit
+		}
+	}
+
+	if skip < 0 {
+		skip = 0
+	}
+
+	if skip > len(arr) {
+		skip = len(arr)
+	}
+
+	end := skip + limit
+
+	if end > len(arr) {
+		end = len(arr)
+	}
+
+	return append(bson.A{}, arr[skip:end]...), nil
+}
+
+// elemMatch replaces the field key of res with the first element of the
+// array stored in doc matching condition, or removes it when none does.
+func elemMatch(doc, res bson.D, key string, condition interface{}) (bson.D, error) {
+	sub, ok := condition.(bson.D)
+
+	if !ok {
+		return nil, fmt.Errorf("$elemMatch expects a document")
+	}
+
+	value, _ := lookupKey(doc, key)
+	arr, _ := value.(bson.A)
+
+	for _, item := range arr {
+		var found bool
+		var err error
+
+		if _, isOperator := isOperatorDocument(sub); isOperator {
+			found, err = matchCondition([]interface{}{item}, sub)
+		} else if itemDoc, isDoc := item.(bson.D); isDoc {
+			found, err = matches(itemDoc, sub)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if found {
+			return set(res, key, bson.A{item})
+		}
+	}
+
+	return unset(res, key), nil
+}
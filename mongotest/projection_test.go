@@ -0,0 +1,76 @@
+package mongotest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+	doc, err := normalize(bson.D{
+		{Key: "_id", Value: "1"},
+		{Key: "name", Value: "Alice"},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Paris"}, {Key: "zip", Value: "75001"}}},
+		{Key: "tags", Value: bson.A{"a", "b", "c", "d"}},
+		{Key: "orders", Value: bson.A{
+			bson.D{{Key: "sku", Value: "a"}, {Key: "qty", Value: 1}},
+			bson.D{{Key: "sku", Value: "b"}, {Key: "qty", Value: 5}},
+		}},
+	})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		projection bson.D
+		expected   bson.D
+	}{
+		{
+			projection: bson.D{{Key: "name", Value: 1}},
+			expected:   bson.D{{Key: "_id", Value: "1"}, {Key: "name", Value: "Alice"}},
+		},
+		{
+			projection: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 0}},
+			expected:   bson.D{{Key: "name", Value: "Alice"}},
+		},
+		{
+			projection: bson.D{{Key: "address.city", Value: 1}, {Key: "orders.sku", Value: 1}, {Key: "_id", Value: 0}},
+			expected: bson.D{
+				{Key: "address", Value: bson.D{{Key: "city", Value: "Paris"}}},
+				{Key: "orders", Value: bson.A{bson.D{{Key: "sku", Value: "a"}}, bson.D{{Key: "sku", Value: "b"}}}},
+			},
+		},
+		{
+			projection: bson.D{{Key: "address", Value: 0}, {Key: "orders", Value: 0}, {Key: "tags", Value: bson.D{{Key: "$slice", Value: -2}}}},
+			expected:   bson.D{{Key: "_id", Value: "1"}, {Key: "name", Value: "Alice"}, {Key: "tags", Value: bson.A{"c", "d"}}},
+		},
+		{
+			projection: bson.D{{Key: "tags", Value: bson.D{{Key: "$slice", Value: bson.A{1, 2}}}}, {Key: "_id", Value: 1}},
+			expected:   bson.D{{Key: "_id", Value: "1"}, {Key: "tags", Value: bson.A{"b", "c"}}},
+		},
+		{
+			projection: bson.D{{Key: "orders", Value: bson.D{{Key: "$elemMatch", Value: bson.D{{Key: "qty", Value: bson.D{{Key: "$gt", Value: 2}}}}}}}},
+			expected: bson.D{
+				{Key: "_id", Value: "1"},
+				{Key: "orders", Value: bson.A{bson.D{{Key: "sku", Value: "b"}, {Key: "qty", Value: int32(5)}}}},
+			},
+		},
+		{
+			projection: bson.D{{Key: "orders", Value: bson.D{{Key: "$elemMatch", Value: bson.D{{Key: "sku", Value: "z"}}}}}},
+			expected:   bson.D{{Key: "_id", Value: "1"}},
+		},
+	}
+
+	for _, test := range tests {
+		projection, err := normalize(test.projection)
+		assert.Nil(t, err)
+
+		res, err := project(doc, projection)
+
+		assert.Nil(t, err, test.projection)
+		assert.Equal(t, test.expected, res, test.projection)
+	}
+}
+
+func TestProjectRejectsMixedModes(t *testing.T) {
+	_, err := project(bson.D{{Key: "_id", Value: "1"}}, bson.D{{Key: "name", Value: int32(1)}, {Key: "age", Value: int32(0)}})
+	assert.NotNil(t, err)
+}
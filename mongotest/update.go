@@ -0,0 +1,844 @@
+package mongotest
+
+import (
+	"fmt"
+	mongo "github.com/luxation/go-mongo/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setPath returns a copy of v where the dotted path parts holds value,
+// creating the intermediate documents where the path is missing. As on the
+// server, no field can be created in an existing null or scalar value.
+func setPath(v interface{}, parts []string, value interface{}) (interface{}, error) {
+	if len(parts) == 0 {
+		return value, nil
+	}
+
+	switch current := v.(type) {
+	case bson.D:
+		res := make(bson.D, 0, len(current)+1)
+		found := false
+
+		for _, e := range current {
+			if e.Key == parts[0] {
+				child, err := setPath(e.Value, parts[1:], value)
+
+				if err != nil {
+					return nil, err
+				}
+
+				e = bson.E{Key: e.Key, Value: child}
+				found = true
+			}
+
+			res = append(res, e)
+		}
+
+		if !found {
+			res = append(res, bson.E{Key: parts[0], Value: created(parts[1:], value)})
+		}
+
+		return res, nil
+	case bson.A:
+		index, err := strconv.Atoi(parts[0])
+
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("cannot create field %s in array", parts[0])
+		}
+
+		res := make(bson.A, len(current))
+		copy(res, current)
+
+		if index >= len(res) {
+			for len(res) < index {
+				res = append(res, nil)
+			}
+
+			return append(res, created(parts[1:], value)), nil
+		}
+
+		child, err := setPath(res[index], parts[1:], value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res[index] = child
+
+		return res, nil
+	case nil:
+		return nil, fmt.Errorf("cannot create field %s in a null value", parts[0])
+	}
+
+	return nil, fmt.Errorf("cannot create field %s in a non document value", parts[0])
+}
+
+// created returns value nested in the documents created for the dotted path
+// parts.
+func created(parts []string, value interface{}) interface{} {
+	for i := len(parts) - 1; i >= 0; i-- {
+		value = bson.D{{Key: parts[i], Value: value}}
+	}
+
+	return value
+}
+
+// unsetPath returns a copy of v without the dotted path parts. Array elements
+// are set to null, as $unset does.
+func unsetPath(v interface{}, parts []string) interface{} {
+	switch current := v.(type) {
+	case bson.D:
+		res := make(bson.D, 0, len(current))
+
+		for _, e := range current {
+			if e.Key == parts[0] {
+				if len(parts) == 1 {
+					continue
+				}
+
+				e = bson.E{Key: e.Key, Value: unsetPath(e.Value, parts[1:])}
+			}
+
+			res = append(res, e)
+		}
+
+		return res
+	case bson.A:
+		index, err := strconv.Atoi(parts[0])
+
+		if err != nil || index < 0 || index >= len(current) {
+			return current
+		}
+
+		res := make(bson.A, len(current))
+		copy(res, current)
+
+		if len(parts) == 1 {
+			res[index] = nil
+		} else {
+			res[index] = unsetPath(res[index], parts[1:])
+		}
+
+		return res
+	}
+
+	return v
+}
+
+// getPath returns the value stored at the dotted path, without expanding
+// arrays of documents.
+func getPath(doc bson.D, path string) (interface{}, bool) {
+	var current interface{} = doc
+
+	for _, part := range strings.Split(path, ".") {
+		switch value := current.(type) {
+		case bson.D:
+			child, ok := lookupKey(value, part)
+
+			if !ok {
+				return nil, false
+			}
+
+			current = child
+		case bson.A:
+			index, err := strconv.Atoi(part)
+
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+
+			current = value[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func set(doc bson.D, path string, value interface{}) (bson.D, error) {
+	if path == "_id" {
+		if current, ok := getPath(doc, path); ok && !equal(current, value) {
+			return nil, fmt.Errorf("the _id field cannot be modified")
+		}
+	}
+
+	res, err := setPath(doc, strings.Split(path, "."), value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(bson.D), nil
+}
+
+func unset(doc bson.D, path string) bson.D {
+	return unsetPath(doc, strings.Split(path, ".")).(bson.D)
+}
+
+func add(a, b interface{}) (interface{}, error) {
+	switch av := a.(type) {
+	case nil:
+		return b, nil
+	case int32:
+		switch bv := b.(type) {
+		case int32:
+			sum := int64(av) + int64(bv)
+
+			if sum == int64(int32(sum)) {
+				return int32(sum), nil
+			}
+
+			return sum, nil
+		case int64:
+			return int64(av) + bv, nil
+		}
+	case int64:
+		switch bv := b.(type) {
+		case int32:
+			return av + int64(bv), nil
+		case int64:
+			return av + bv, nil
+		}
+	}
+
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+
+	if !aok || !bok {
+		return nil, fmt.Errorf("cannot apply $inc to a value of non-numeric type")
+	}
+
+	return af + bf, nil
+}
+
+func mul(a, b interface{}) (interface{}, error) {
+	if a == nil {
+		switch b.(type) {
+		case int32:
+			a = int32(0)
+		case int64:
+			a = int64(0)
+		default:
+			a = 0.0
+		}
+	}
+
+	switch av := a.(type) {
+	case int32:
+		switch bv := b.(type) {
+		case int32:
+			product := int64(av) * int64(bv)
+
+			if product == int64(int32(product)) {
+				return int32(product), nil
+			}
+
+			return product, nil
+		case int64:
+			return int64(av) * bv, nil
+		}
+	case int64:
+		switch bv := b.(type) {
+		case int32:
+			return av * int64(bv), nil
+		case int64:
+			return av * bv, nil
+		}
+	}
+
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+
+	if !aok || !bok {
+		return nil, fmt.Errorf("cannot apply $mul to a value of non-numeric type")
+	}
+
+	return af * bf, nil
+}
+
+// expandPath resolves the positional operators of path against doc into the
+// concrete paths to update: $[] selects every element of an array and
+// $[identifier] the elements matching the array filters of identifier.
+func expandPath(doc bson.D, path string, arrayFilters []bson.D) ([]string, error) {
+	paths := []string{""}
+
+	for _, part := range strings.Split(path, ".") {
+		var next []string
+
+		for _, prefix := range paths {
+			if !strings.HasPrefix(part, "$") {
+				next = append(next, strings.TrimPrefix(prefix+"."+part, "."))
+				continue
+			}
+
+			if part == "$" {
+				return nil, fmt.Errorf("%w: the positional $ operator", ErrNotSupported)
+			}
+
+			if !strings.HasPrefix(part, "$[") || !strings.HasSuffix(part, "]") || prefix == "" {
+				return nil, fmt.Errorf("invalid positional operator %s in %s", part, path)
+			}
+
+			value, _ := getPath(doc, prefix)
+			arr, ok := value.(bson.A)
+
+			if !ok {
+				return nil, fmt.Errorf("cannot apply %s to the non array field %s", part, prefix)
+			}
+
+			identifier := part[2 : len(part)-1]
+
+			for i, item := range arr {
+				if identifier != "" {
+					ok, err := matchesArrayFilters(item, identifier, arrayFilters)
+
+					if err != nil {
+						return nil, err
+					}
+
+					if !ok {
+						continue
+					}
+				}
+
+				next = append(next, prefix+"."+strconv.Itoa(i))
+			}
+		}
+
+		paths = next
+	}
+
+	return paths, nil
+}
+
+func matchesArrayFilters(item interface{}, identifier string, arrayFilters []bson.D) (bool, error) {
+	found := false
+
+	for _, filter := range arrayFilters {
+		if len(filter) == 0 || strings.Split(filter[0].Key, ".")[0] != identifier {
+			continue
+		}
+
+		found = true
+
+		ok, err := matches(bson.D{{Key: identifier, Value: item}}, filter)
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	if !found {
+		return false, fmt.Errorf("no array filter found for identifier %s", identifier)
+	}
+
+	return true, nil
+}
+
+// arrayAt returns a copy of the array stored at path, or an empty array when
+// the field is missing.
+func arrayAt(doc bson.D, path, op string) (bson.A, error) {
+	value, found := getPath(doc, path)
+
+	if !found {
+		return bson.A{}, nil
+	}
+
+	arr, ok := value.(bson.A)
+
+	if !ok {
+		return nil, fmt.Errorf("%s expects %s to be an array", op, path)
+	}
+
+	return append(bson.A{}, arr...), nil
+}
+
+// each returns the values of an $each modifier, or value itself.
+func each(value interface{}) (bson.A, bson.D, error) {
+	spec, ok := value.(bson.D)
+
+	if !ok {
+		return bson.A{value}, nil, nil
+	}
+
+	values, found := lookupKey(spec, "$each")
+
+	if !found {
+		return bson.A{value}, nil, nil
+	}
+
+	arr, ok := values.(bson.A)
+
+	if !ok {
+		return nil, nil, fmt.Errorf("$each expects an array")
+	}
+
+	return arr, spec, nil
+}
+
+func sortArray(arr bson.A, spec interface{}) error {
+	if fields, ok := spec.(bson.D); ok {
+		sort.SliceStable(arr, func(i, j int) bool {
+			a, _ := arr[i].(bson.D)
+			b, _ := arr[j].(bson.D)
+
+			for _, field := range fields {
+				av, _ := getPath(a, field.Key)
+				bv, _ := getPath(b, field.Key)
+
+				cmp := compare(av, bv)
+
+				if order, _ := toFloat(field.Value); order < 0 {
+					cmp = -cmp
+				}
+
+				if cmp != 0 {
+					return cmp < 0
+				}
+			}
+
+			return false
+		})
+
+		return nil
+	}
+
+	order, ok := toFloat(spec)
+
+	if !ok {
+		return fmt.Errorf("$sort expects 1, -1 or a document")
+	}
+
+	sort.SliceStable(arr, func(i, j int) bool {
+		cmp := compare(arr[i], arr[j])
+
+		if order < 0 {
+			cmp = -cmp
+		}
+
+		return cmp < 0
+	})
+
+	return nil
+}
+
+func push(doc bson.D, path string, value interface{}) (bson.D, error) {
+	arr, err := arrayAt(doc, path, "$push")
+
+	if err != nil {
+		return nil, err
+	}
+
+	values, modifiers, err := each(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	position := len(arr)
+
+	if p, ok := lookupKey(modifiers, "$position"); ok {
+		n, _ := toFloat(p)
+		position = int(n)
+
+		if position < 0 {
+			position += len(arr)
+		}
+
+		if position < 0 {
+			position = 0
+		}
+
+		if position > len(arr) {
+			position = len(arr)
+		}
+	}
+
+	res := append(bson.A{}, arr[:position]...)
+	res = append(res, values...)
+	res = append(res, arr[position:]...)
+
+	if spec, ok := lookupKey(modifiers, "$sort"); ok {
+		err = sortArray(res, spec)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if spec, ok := lookupKey(modifiers, "$slice"); ok {
+		n, _ := toFloat(spec)
+
+		switch {
+		case n >= 0 && int(n) < len(res):
+			res = res[:int(n)]
+		case n < 0 && int(-n) < len(res):
+			res = res[len(res)+int(n):]
+		}
+	}
+
+	return set(doc, path, res)
+}
+
+func addToSet(doc bson.D, path string, value interface{}) (bson.D, error) {
+	arr, err := arrayAt(doc, path, "$addToSet")
+
+	if err != nil {
+		return nil, err
+	}
+
+	values, _, err := each(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range values {
+		found := false
+
+		for _, item := range arr {
+			if equal(item, v) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			arr = append(arr, v)
+		}
+	}
+
+	return set(doc, path, arr)
+}
+
+func pull(doc bson.D, path string, condition interface{}) (bson.D, error) {
+	if _, found := getPath(doc, path); !found {
+		return doc, nil
+	}
+
+	arr, err := arrayAt(doc, path, "$pull")
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := bson.A{}
+
+	for _, item := range arr {
+		var matched bool
+
+		if ops, isOperator := isOperatorDocument(condition); isOperator {
+			matched, err = matchCondition([]interface{}{item}, ops)
+		} else if query, isDoc := condition.(bson.D); isDoc {
+			if itemDoc, ok := item.(bson.D); ok {
+				matched, err = matches(itemDoc, query)
+			}
+		} else {
+			matched = equal(item, condition)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !matched {
+			res = append(res, item)
+		}
+	}
+
+	return set(doc, path, res)
+}
+
+func currentDate(spec interface{}) interface{} {
+	now := time.Now()
+
+	if d, ok := spec.(bson.D); ok {
+		if t, _ := lookupKey(d, "$type"); t == "timestamp" {
+			return primitive.Timestamp{T: uint32(now.Unix())}
+		}
+	}
+
+	return primitive.NewDateTimeFromTime(now)
+}
+
+// applyOperator applies the update operator op to the concrete path of doc.
+func applyOperator(doc bson.D, op, path string, value interface{}, inserted bool) (bson.D, error) {
+	switch op {
+	case "$set":
+		return set(doc, path, value)
+	case "$setOnInsert":
+		if inserted {
+			return set(doc, path, value)
+		}
+
+		return doc, nil
+	case "$unset":
+		return unset(doc, path), nil
+	case "$inc", "$mul":
+		current, _ := getPath(doc, path)
+
+		var res interface{}
+		var err error
+
+		if op == "$inc" {
+			res, err = add(current, value)
+		} else {
+			res, err = mul(current, value)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return set(doc, path, res)
+	case "$min", "$max":
+		current, found := getPath(doc, path)
+
+		if !found || (op == "$min" && compare(value, current) < 0) || (op == "$max" && compare(value, current) > 0) {
+			return set(doc, path, value)
+		}
+
+		return doc, nil
+	case "$push":
+		return push(doc, path, value)
+	case "$addToSet":
+		return addToSet(doc, path, value)
+	case "$pull":
+		return pull(doc, path, value)
+	case "$rename":
+		target, ok := value.(string)
+
+		if !ok {
+			return nil, fmt.Errorf("$rename expects a field name")
+		}
+
+		current, found := getPath(doc, path)
+
+		if !found {
+			return doc, nil
+		}
+
+		return set(unset(doc, path), target, current)
+	case "$currentDate":
+		return set(doc, path, currentDate(value))
+	}
+
+	return nil, fmt.Errorf("unsupported update operator %s", op)
+}
+
+// normalizeUpdate normalizes an update document, or the stages of an
+// UpdatePipeline which are returned as a bson.A.
+func normalizeUpdate(update interface{}) (interface{}, error) {
+	pipeline, ok := update.(mongo.UpdatePipeline)
+
+	if !ok {
+		return normalize(update)
+	}
+
+	wrapped, err := normalize(bson.M{"pipeline": pipeline})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapped[0].Value, nil
+}
+
+// applyNormalized applies to doc an update returned by normalizeUpdate.
+func applyNormalized(doc bson.D, update interface{}, arrayFilters []bson.D) (bson.D, error) {
+	if stages, ok := update.(bson.A); ok {
+		return applyPipeline(doc, stages)
+	}
+
+	return applyUpdate(doc, update.(bson.D), false, arrayFilters)
+}
+
+// applyPipeline applies the $set, $addFields and $unset stages of an update
+// pipeline to doc. Their expressions are evaluated against the document as
+// it was before the stage.
+func applyPipeline(doc bson.D, stages bson.A) (bson.D, error) {
+	for _, s := range stages {
+		stage, ok := s.(bson.D)
+
+		if !ok || len(stage) != 1 {
+			return nil, fmt.Errorf("a pipeline stage must be a document with a single field")
+		}
+
+		switch stage[0].Key {
+		case "$set", "$addFields":
+			fields, ok := stage[0].Value.(bson.D)
+
+			if !ok {
+				return nil, fmt.Errorf("%s expects a document", stage[0].Key)
+			}
+
+			before := doc
+
+			for _, field := range fields {
+				value, err := evaluate(before, field.Value)
+
+				if err != nil {
+					return nil, err
+				}
+
+				doc = setComputed(doc, strings.Split(field.Key, "."), value).(bson.D)
+			}
+		case "$unset":
+			fields, ok := stage[0].Value.(bson.A)
+
+			if name, isName := stage[0].Value.(string); isName {
+				fields, ok = bson.A{name}, true
+			}
+
+			if !ok {
+				return nil, fmt.Errorf("$unset expects a field name or an array of them")
+			}
+
+			for _, f := range fields {
+				name, isName := f.(string)
+
+				if !isName {
+					return nil, fmt.Errorf("$unset expects a field name or an array of them")
+				}
+
+				doc = unset(doc, name)
+			}
+		default:
+			return nil, fmt.Errorf("%w: update pipeline stage %s", ErrNotSupported, stage[0].Key)
+		}
+	}
+
+	return doc, nil
+}
+
+// evaluate returns the value of the aggregation expression expr against doc.
+// Only literal values, $literal and field paths are supported, missing fields
+// reading as null.
+func evaluate(doc bson.D, expr interface{}) (interface{}, error) {
+	switch e := expr.(type) {
+	case string:
+		if strings.HasPrefix(e, "$$") {
+			return nil, fmt.Errorf("%w: variable %s", ErrNotSupported, e)
+		}
+
+		if strings.HasPrefix(e, "$") {
+			value, _ := getPath(doc, e[1:])
+			return value, nil
+		}
+	case bson.D:
+		if len(e) > 0 && strings.HasPrefix(e[0].Key, "$") {
+			if len(e) == 1 && e[0].Key == "$literal" {
+				return e[0].Value, nil
+			}
+
+			return nil, fmt.Errorf("%w: expression %s", ErrNotSupported, e[0].Key)
+		}
+
+		res := make(bson.D, len(e))
+
+		for i, field := range e {
+			value, err := evaluate(doc, field.Value)
+
+			if err != nil {
+				return nil, err
+			}
+
+			res[i] = bson.E{Key: field.Key, Value: value}
+		}
+
+		return res, nil
+	case bson.A:
+		res := make(bson.A, len(e))
+
+		for i, item := range e {
+			value, err := evaluate(doc, item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			res[i] = value
+		}
+
+		return res, nil
+	}
+
+	return expr, nil
+}
+
+// setComputed returns a copy of v where the dotted path parts holds value, as
+// a $set stage does: values which are not documents are replaced by new
+// documents, and the path is set in every element of arrays.
+func setComputed(v interface{}, parts []string, value interface{}) interface{} {
+	if len(parts) == 0 {
+		return value
+	}
+
+	switch current := v.(type) {
+	case bson.D:
+		res := make(bson.D, 0, len(current)+1)
+		found := false
+
+		for _, e := range current {
+			if e.Key == parts[0] {
+				e = bson.E{Key: e.Key, Value: setComputed(e.Value, parts[1:], value)}
+				found = true
+			}
+
+			res = append(res, e)
+		}
+
+		if !found {
+			res = append(res, bson.E{Key: parts[0], Value: setComputed(nil, parts[1:], value)})
+		}
+
+		return res
+	case bson.A:
+		res := make(bson.A, len(current))
+
+		for i, item := range current {
+			res[i] = setComputed(item, parts, value)
+		}
+
+		return res
+	}
+
+	return setComputed(bson.D{}, parts, value)
+}
+
+// applyUpdate applies the update operators of update to doc. $setOnInsert is
+// only honored when inserted is set. arrayFilters select the elements
+// targeted by $[identifier] paths.
+func applyUpdate(doc bson.D, update bson.D, inserted bool, arrayFilters []bson.D) (bson.D, error) {
+	for _, op := range update {
+		fields, ok := op.Value.(bson.D)
+
+		if !ok {
+			return nil, fmt.Errorf("%s expects a document", op.Key)
+		}
+
+		for _, field := range fields {
+			paths, err := expandPath(doc, field.Key, arrayFilters)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, path := range paths {
+				doc, err = applyOperator(doc, op.Key, path, field.Value, inserted)
+
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,292 @@
+package mongo
+
+import (
+	"github.com/iancoleman/strcase"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// NamingStrategy decides the document key of struct fields whose bson tag
+// does not name them; tag names always win. It is used to encode and decode
+// documents, to flatten updates, and maps the sort, projection and update
+// paths onto the keys of the document they apply to.
+type NamingStrategy struct {
+	rename func(name string) string
+	names  sync.Map
+
+	once     sync.Once
+	registry *bsoncodec.Registry
+}
+
+var (
+	// BsonTagNaming keys untagged fields by their lower cased name, as the
+	// driver does, and keeps sort and projection paths as they are.
+	BsonTagNaming = &NamingStrategy{}
+	// CamelCaseNaming keys untagged fields in lowerCamelCase, e.g. userId.
+	CamelCaseNaming = NewNamingStrategy(strcase.ToLowerCamel)
+	// SnakeCaseNaming keys untagged fields in snake_case, e.g. user_id.
+	SnakeCaseNaming = NewNamingStrategy(strcase.ToSnake)
+)
+
+// NewNamingStrategy returns a strategy keying fields with rename. rename
+// receives Go field names as well as the segments of sort, projection and
+// update paths, and should return names already following its convention as
+// they are.
+func NewNamingStrategy(rename func(name string) string) *NamingStrategy {
+	return &NamingStrategy{rename: rename}
+}
+
+func namingOf(naming []*NamingStrategy) *NamingStrategy {
+	if len(naming) == 0 || naming[0] == nil {
+		return BsonTagNaming
+	}
+
+	return naming[0]
+}
+
+func (n *NamingStrategy) isDefault() bool {
+	return n == nil || n.rename == nil
+}
+
+// name returns the key of the Go field name s. Field names being a bounded
+// set, they are cached.
+func (n *NamingStrategy) name(s string) string {
+	if name, ok := n.names.Load(s); ok {
+		return name.(string)
+	}
+
+	name := n.rename(s)
+	n.names.Store(s, name)
+
+	return name
+}
+
+// Path maps a dotted path onto the keys stored for the documents of d. A
+// segment naming a struct field, by its key or by its Go name under the
+// strategy, becomes the key of the field, so tag names win. _id, operators,
+// array indexes, map keys and the segments below an interface or an unknown
+// field are kept as they are, as is every path with BsonTagNaming or a nil
+// d.
+func (n *NamingStrategy) Path(d interface{}, path string) string {
+	path, _ = n.pathOf(reflect.TypeOf(d), path)
+	return path
+}
+
+// pathOf is Path for the documents of type t, also returning the type found
+// at path, nil when unknown.
+func (n *NamingStrategy) pathOf(t reflect.Type, path string) (string, reflect.Type) {
+	if n.isDefault() || t == nil {
+		return path, nil
+	}
+
+	segments := strings.Split(path, ".")
+
+	for i, segment := range segments {
+		t = n.segmentType(t, segment)
+
+		if t == nil {
+			break
+		}
+
+		if key, ok := n.fieldKey(t, segment); ok {
+			segments[i] = key
+		}
+
+		t = n.child(t, segment)
+	}
+
+	return strings.Join(segments, "."), t
+}
+
+// segmentType returns the type a path segment is read from: t itself, or
+// the element type of arrays when the segment is not an index nor a
+// positional operator, MongoDB then reading the field in every element. nil
+// means the path cannot be followed.
+func (n *NamingStrategy) segmentType(t reflect.Type, segment string) reflect.Type {
+	for t != nil {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		switch {
+		case segment == "_id" || segment == "" || strings.HasPrefix(segment, "$") || isIndex(segment):
+			return t
+		case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+			t = t.Elem()
+		case cachedType(t, n).kind == flattenLeaf:
+			return nil
+		default:
+			return t
+		}
+	}
+
+	return nil
+}
+
+// child returns the type found under segment in t, nil when unknown.
+func (n *NamingStrategy) child(t reflect.Type, segment string) reflect.Type {
+	switch cachedType(t, n).kind {
+	case flattenStruct:
+		sf, ok := n.field(t, segment)
+
+		if !ok {
+			return nil
+		}
+
+		return sf.Type
+	case flattenMap:
+		return t.Elem()
+	}
+
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		return t.Elem()
+	}
+
+	return nil
+}
+
+func (n *NamingStrategy) fieldKey(t reflect.Type, segment string) (string, bool) {
+	if cachedType(t, n).kind != flattenStruct {
+		return "", false
+	}
+
+	sf, ok := n.field(t, segment)
+
+	if !ok {
+		return "", false
+	}
+
+	tags, _ := n.ParseStructTags(sf)
+
+	return tags.Name, true
+}
+
+// field finds the field of the struct t, or of its inline structs, stored
+// under segment, or else whose Go name gets the same key as segment.
+func (n *NamingStrategy) field(t reflect.Type, segment string) (reflect.StructField, bool) {
+	if sf, ok := n.lookup(t, func(key string, sf reflect.StructField) bool {
+		return key == segment
+	}); ok {
+		return sf, true
+	}
+
+	// Segments come from callers, e.g. ParseSort, so unlike field names
+	// they are renamed without being cached.
+	renamed := n.rename(segment)
+
+	return n.lookup(t, func(key string, sf reflect.StructField) bool {
+		return n.name(sf.Name) == renamed
+	})
+}
+
+func (n *NamingStrategy) lookup(t reflect.Type, match func(key string, sf reflect.StructField) bool) (reflect.StructField, bool) {
+	for _, field := range cachedType(t, n).fields {
+		sf := t.Field(field.index)
+
+		if !field.inline {
+			if match(field.name, sf) {
+				return sf, true
+			}
+
+			continue
+		}
+
+		inline := sf.Type
+
+		for inline.Kind() == reflect.Ptr {
+			inline = inline.Elem()
+		}
+
+		if cachedType(inline, n).kind != flattenStruct {
+			continue
+		}
+
+		if found, ok := n.lookup(inline, match); ok {
+			return found, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+func isIndex(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseStructTags implements bsoncodec.StructTagParser.
+func (n *NamingStrategy) ParseStructTags(sf reflect.StructField) (bsoncodec.StructTags, error) {
+	tags, err := bsoncodec.DefaultStructTagParser.ParseStructTags(sf)
+
+	if err != nil || tags.Skip || n.isDefault() || hasTagName(sf) {
+		return tags, err
+	}
+
+	tags.Name = n.name(sf.Name)
+
+	return tags, nil
+}
+
+// hasTagName reports whether the bson tag of sf names the field, reading
+// the tag as the driver does.
+func hasTagName(sf reflect.StructField) bool {
+	tag, ok := sf.Tag.Lookup("bson")
+
+	if !ok && !strings.Contains(string(sf.Tag), ":") && len(sf.Tag) > 0 {
+		tag = string(sf.Tag)
+	}
+
+	return strings.Split(tag, ",")[0] != ""
+}
+
+// Registry returns the registry encoding and decoding structs with the
+// strategy, or nil for BsonTagNaming which uses the driver default.
+func (n *NamingStrategy) Registry() *bsoncodec.Registry {
+	if n.isDefault() {
+		return nil
+	}
+
+	n.once.Do(func() {
+		// NewStructCodec only fails on a nil parser.
+		codec, _ := bsoncodec.NewStructCodec(n)
+
+		n.registry = bson.NewRegistryBuilder().
+			RegisterDefaultEncoder(reflect.Struct, codec).
+			RegisterDefaultDecoder(reflect.Struct, codec).
+			Build()
+	})
+
+	return n.registry
+}
+
+// Named returns a copy of o whose sort and projection fields are mapped
+// onto the keys of the documents of d, see NamingStrategy.Path.
+func (o *FindOptions) Named(naming *NamingStrategy, d interface{}) *FindOptions {
+	if o == nil || naming.isDefault() {
+		return o
+	}
+
+	named := *o
+	named.Sort = make([]SortOption, len(o.Sort))
+	named.Projection = make([]ProjectionOption, len(o.Projection))
+
+	for i, s := range o.Sort {
+		s.SortField = naming.Path(d, s.SortField)
+		named.Sort[i] = s
+	}
+
+	for i, p := range o.Projection {
+		p.Field = naming.Path(d, p.Field)
+		named.Projection[i] = p
+	}
+
+	return &named
+}
@@ -0,0 +1,173 @@
+package mongo
+
+import (
+	"fmt"
+	"github.com/iancoleman/strcase"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"testing"
+)
+
+type namedProfile struct {
+	BasicDocument `bson:",inline"`
+	UserID        string
+	DisplayName   string
+	Tagged        string `bson:"tag_name"`
+	Address       struct {
+		ZipCode string
+	}
+}
+
+func TestNamingStrategyFlatten(t *testing.T) {
+	profile := namedProfile{UserID: "u-1", DisplayName: "Jane", Tagged: "x"}
+	profile.Address.ZipCode = "69000"
+
+	tests := []struct {
+		naming   *NamingStrategy
+		expected map[string]interface{}
+	}{
+		{naming: nil, expected: map[string]interface{}{
+			"userid": "u-1", "displayname": "Jane", "tag_name": "x", "address.zipcode": "69000",
+		}},
+		{naming: CamelCaseNaming, expected: map[string]interface{}{
+			"userID": "u-1", "displayName": "Jane", "tag_name": "x", "address.zipCode": "69000",
+		}},
+		{naming: SnakeCaseNaming, expected: map[string]interface{}{
+			"user_id": "u-1", "display_name": "Jane", "tag_name": "x", "address.zip_code": "69000",
+		}},
+		{naming: NewNamingStrategy(strings.ToUpper), expected: map[string]interface{}{
+			"USERID": "u-1", "DISPLAYNAME": "Jane", "tag_name": "x", "ADDRESS.ZIPCODE": "69000",
+		}},
+	}
+
+	for _, test := range tests {
+		fields, err := Flatten(profile, test.naming)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, fields)
+	}
+
+	fields, err := Flatten(bson.M{"displayName": "Jane", "address.zipCode": "69000"}, SnakeCaseNaming)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"displayName": "Jane", "address.zipCode": "69000"}, fields)
+}
+
+type namedLine struct {
+	UnitPrice int
+	SKU       string `bson:"sku"`
+}
+
+type namedDetails struct {
+	DisplayName string
+	Tagged      string `bson:"tag_name"`
+	Address     struct {
+		ZipCode string
+	}
+}
+
+type namedOrder struct {
+	BasicDocument `bson:",inline"`
+	Details       namedDetails `bson:",inline"`
+	Lines         []namedLine
+	Labels        map[string]namedLine
+	Extra         interface{}
+}
+
+func (o namedOrder) DocumentName() string { return "orders" }
+
+func TestNamingStrategyPath(t *testing.T) {
+	order := &namedOrder{}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "createdAt", expected: "createdAt"},
+		{path: "created_at", expected: "createdAt"},
+		{path: "_id", expected: "_id"},
+		{path: "displayName", expected: "display_name"},
+		{path: "tagged", expected: "tag_name"},
+		{path: "tag_name", expected: "tag_name"},
+		{path: "address.zipCode", expected: "address.zip_code"},
+		{path: "lines.0.unitPrice", expected: "lines.0.unit_price"},
+		{path: "lines.$[line].SKU", expected: "lines.$[line].sku"},
+		{path: "lines.unitPrice", expected: "lines.unit_price"},
+		{path: "labels.someKey.unitPrice", expected: "labels.someKey.unit_price"},
+		{path: "extra.someKey", expected: "extra.someKey"},
+		{path: "unknownField.subField", expected: "unknownField.subField"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, SnakeCaseNaming.Path(order, test.path), test.path)
+	}
+
+	assert.Equal(t, "displayName", BsonTagNaming.Path(order, "displayName"))
+	assert.Equal(t, "displayName", SnakeCaseNaming.Path(nil, "displayName"))
+	assert.Equal(t, "lines.$[item].unitPrice", CamelCaseNaming.Path(order, "lines.$[item].unit_price"))
+}
+
+func TestNamingStrategyPathDoesNotCacheSegments(t *testing.T) {
+	naming := NewNamingStrategy(strcase.ToSnake)
+	naming.Path(&namedOrder{}, "unknown")
+
+	cached := func() int {
+		count := 0
+		naming.names.Range(func(_, _ interface{}) bool {
+			count++
+			return true
+		})
+
+		return count
+	}
+
+	before := cached()
+
+	for i := 0; i < 100; i++ {
+		naming.Path(&namedOrder{}, fmt.Sprintf("unknown%d.field%d", i, i))
+	}
+
+	assert.Equal(t, before, cached())
+}
+
+func TestFindOptionsNamed(t *testing.T) {
+	findOptions := &FindOptions{
+		Sort:       []SortOption{{SortField: "createdAt", Order: OrderDESC}},
+		Projection: []ProjectionOption{{Field: "displayName"}},
+	}
+
+	named := findOptions.Named(SnakeCaseNaming, &namedOrder{})
+
+	assert.Equal(t, bson.D{{Key: "createdAt", Value: OrderDESC}}, named.SortDocument())
+	assert.Equal(t, bson.D{{Key: "display_name", Value: 1}}, named.ProjectionDocument())
+	assert.Equal(t, "createdAt", findOptions.Sort[0].SortField)
+	assert.Same(t, findOptions, findOptions.Named(BsonTagNaming, &namedOrder{}))
+	assert.Nil(t, (*FindOptions)(nil).Named(SnakeCaseNaming, &namedOrder{}))
+}
+
+func TestUpdateDocumentMapsKeysOntoDocument(t *testing.T) {
+	update, err := UpdateDocument(bson.M{"displayName": "Jane", "createdAt": "x"}, UpdateConfig{
+		Naming:   SnakeCaseNaming,
+		Document: &namedOrder{},
+	})
+	assert.Nil(t, err)
+
+	set := update[0].Value.(map[string]interface{})
+	assert.Equal(t, "Jane", set["display_name"])
+	assert.Equal(t, "x", set["createdAt"])
+}
+
+func TestNamingStrategyRegistry(t *testing.T) {
+	assert.Nil(t, BsonTagNaming.Registry())
+
+	profile := namedProfile{UserID: "u-1", Tagged: "x"}
+
+	data, err := bson.MarshalWithRegistry(SnakeCaseNaming.Registry(), profile)
+	raw := bson.Raw(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "u-1", raw.Lookup("user_id").StringValue())
+	assert.Equal(t, "x", raw.Lookup("tag_name").StringValue())
+
+	var decoded namedProfile
+	assert.Nil(t, bson.UnmarshalWithRegistry(SnakeCaseNaming.Registry(), raw, &decoded))
+	assert.Equal(t, "u-1", decoded.UserID)
+}
@@ -0,0 +1,106 @@
+package mongo
+
+import (
+	"bytes"
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Optional is a field of a partial update which tells "not provided" apart
+// from null and from its zero value. Unset fields are left out of updates,
+// null ones are cleared according to the NullPolicy of the client and set
+// ones are updated even when they hold a zero value.
+//
+// Decoding JSON or BSON sets the fields present in the input, so a request
+// body can be decoded into a struct of Optional fields and passed to Update.
+type Optional[T any] struct {
+	value T
+	set   bool
+	null  bool
+}
+
+// NullPolicy decides how explicit nulls of update inputs are sent.
+type NullPolicy int
+
+const (
+	// NullSet sets the fields to null.
+	NullSet NullPolicy = iota
+	// NullUnset removes the fields from the document.
+	NullUnset
+)
+
+// optionalValue is implemented by every Optional.
+type optionalValue interface {
+	optional() (value interface{}, set, null bool)
+}
+
+func Set[T any](value T) Optional[T] {
+	return Optional[T]{value: value, set: true}
+}
+
+func Null[T any]() Optional[T] {
+	return Optional[T]{set: true, null: true}
+}
+
+func (o Optional[T]) optional() (interface{}, bool, bool) {
+	return o.value, o.set, o.null
+}
+
+// IsSet reports whether the field was provided, null included.
+func (o Optional[T]) IsSet() bool {
+	return o.set
+}
+
+func (o Optional[T]) IsNull() bool {
+	return o.null
+}
+
+// Get returns the value and whether it is set and not null.
+func (o Optional[T]) Get() (T, bool) {
+	return o.value, o.set && !o.null
+}
+
+// IsZero reports whether the field was not provided, so that omitempty
+// leaves it out.
+func (o Optional[T]) IsZero() bool {
+	return !o.set
+}
+
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.set || o.null {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(o.value)
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	*o = Optional[T]{set: true}
+
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		o.null = true
+		return nil
+	}
+
+	return json.Unmarshal(data, &o.value)
+}
+
+func (o Optional[T]) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if !o.set || o.null {
+		return bsontype.Null, nil, nil
+	}
+
+	return bson.MarshalValue(o.value)
+}
+
+func (o *Optional[T]) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	*o = Optional[T]{set: true}
+
+	if t == bsontype.Null || t == bsontype.Undefined {
+		o.null = true
+		return nil
+	}
+
+	return bson.RawValue{Type: t, Value: data}.Unmarshal(&o.value)
+}
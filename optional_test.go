@@ -0,0 +1,68 @@
+package mongo
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+type profilePatch struct {
+	Name  Optional[string] `json:"name" bson:"name"`
+	Age   Optional[int]    `json:"age" bson:"age"`
+	Email Optional[string] `json:"email" bson:"email,omitempty"`
+}
+
+func TestOptionalJSON(t *testing.T) {
+	var patch profilePatch
+
+	assert.Nil(t, json.Unmarshal([]byte(`{"age": 0, "email": null}`), &patch))
+
+	assert.False(t, patch.Name.IsSet())
+
+	age, ok := patch.Age.Get()
+	assert.True(t, ok)
+	assert.Equal(t, 0, age)
+
+	assert.True(t, patch.Email.IsSet())
+	assert.True(t, patch.Email.IsNull())
+
+	data, err := json.Marshal(profilePatch{Name: Set("Jane"), Email: Null[string]()})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"name": "Jane", "age": null, "email": null}`, string(data))
+}
+
+func TestOptionalBSON(t *testing.T) {
+	data, err := bson.Marshal(profilePatch{Name: Set("Jane"), Age: Null[int]()})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name": "Jane","age": null}`, bson.Raw(data).String())
+
+	var patch profilePatch
+	assert.Nil(t, bson.Unmarshal(data, &patch))
+	assert.Equal(t, profilePatch{Name: Set("Jane"), Age: Null[int]()}, patch)
+}
+
+func TestOptionalUpdateDocument(t *testing.T) {
+	patch := profilePatch{Age: Set(0), Email: Null[string]()}
+
+	fields, err := Flatten(patch)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"age": 0, "email": nil}, fields)
+
+	update, err := UpdateDocument(patch)
+	assert.Nil(t, err)
+	assert.Len(t, update, 1)
+	assert.Contains(t, update[0].Value, "email")
+
+	update, err = UpdateDocument(patch, UpdateConfig{Nulls: NullUnset})
+	assert.Nil(t, err)
+	assert.Len(t, update, 2)
+	assert.NotContains(t, update[0].Value, "email")
+	assert.Equal(t, bson.E{Key: "$unset", Value: bson.D{{Key: "email", Value: ""}}}, update[1])
+
+	update, err = UpdateDocument(bson.M{"name": Set("Jane"), "email": Null[string](), "age": Optional[int]{}}, UpdateConfig{Nulls: NullUnset})
+	assert.Nil(t, err)
+	assert.Equal(t, "Jane", update[0].Value.(map[string]interface{})["name"])
+	assert.NotContains(t, update[0].Value, "age")
+	assert.Equal(t, bson.D{{Key: "email", Value: ""}}, update[1].Value)
+}
@@ -0,0 +1,412 @@
+package mongo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+)
+
+// PageInfo describes how to reach the pages around the one just read.
+// Cursors are opaque and are passed back through PaginationOption.Cursor.
+// TotalCount and Page are only set when reading pages by offset.
+type PageInfo struct {
+	NextCursor string
+	PrevCursor string
+	HasMore    bool
+	TotalCount int64
+	Page       int64
+}
+
+// Page holds a typed page of results, as returned by Repository.Page.
+type Page[T any] struct {
+	Items []T
+	PageInfo
+}
+
+// pageCursor is the content of an opaque cursor: the sort key values of a
+// row, and whether the page to read comes before or after it.
+type pageCursor struct {
+	Fields   []string        `bson:"f"`
+	Values   []bson.RawValue `bson:"v"`
+	Backward bool            `bson:"b,omitempty"`
+}
+
+func encodeCursor(c pageCursor) (string, error) {
+	raw, err := bson.Marshal(c)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(s string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c pageCursor
+
+	if err := bson.Unmarshal(raw, &c); err != nil || len(c.Fields) != len(c.Values) {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// PageQuery is the query reading a page of results with keyset pagination.
+// Rows are ordered by the requested sort followed by _id, and a page starts
+// right after (or before) the sort key values stored in the cursor, so
+// pages stay stable while documents are inserted or deleted. Sort fields are
+// expected to hold non null values. Client implementations run Filter with
+// Options and pass the rows read to Page.
+//
+// When Skip or Page is set, the query reads pages by offset instead: Pipeline
+// is set and runs a $facet aggregation returning the items along with the
+// total count, whose single result is passed to FacetPage. Slice and
+// ElemMatch projections are not available in that mode.
+//
+// Registry decodes the rows handed to the decoder, the driver default when
+// nil.
+type PageQuery struct {
+	Filter   bson.M
+	Options  *FindOptions
+	Pipeline bson.A
+	Registry *bsoncodec.Registry
+
+	sort   []SortOption
+	limit  int
+	skip   int64
+	cursor *pageCursor
+}
+
+func NewPageQuery(filters bson.M, findOptions ...*FindOptions) (*PageQuery, error) {
+	var findOption FindOptions
+
+	if len(findOptions) > 0 && findOptions[0] != nil {
+		findOption = *findOptions[0]
+	}
+
+	if findOption.Pagination == nil || findOption.Pagination.Limit == nil || *findOption.Pagination.Limit <= 0 {
+		return nil, errors.New("pagination limit must be set")
+	}
+
+	q := &PageQuery{
+		Filter: filters,
+		limit:  int(*findOption.Pagination.Limit),
+	}
+
+	hasID := false
+
+	for _, s := range findOption.Sort {
+		if s.TextScore {
+			return nil, errors.New("text score sorts cannot be paginated with cursors")
+		}
+
+		hasID = hasID || s.SortField == "_id"
+		q.sort = append(q.sort, s)
+	}
+
+	if !hasID {
+		q.sort = append(q.sort, SortOption{SortField: "_id", Order: OrderASC})
+	}
+
+	pagination := findOption.Pagination
+
+	if pagination.Skip > 0 || pagination.Page > 0 {
+		err := q.offset(pagination, &findOption)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return q, nil
+	}
+
+	if pagination.Skip < 0 || pagination.Page < 0 {
+		return nil, errors.New("pagination skip and page cannot be negative")
+	}
+
+	if pagination.Cursor != "" {
+		c, err := decodeCursor(pagination.Cursor)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.Join(c.Fields, ",") != strings.Join(q.sortFields(), ",") {
+			return nil, fmt.Errorf("%w: cursor was created for another sort", ErrInvalidCursor)
+		}
+
+		q.cursor = c
+		q.Filter = q.keysetFilter(filters)
+	}
+
+	limit := int64(q.limit + 1)
+
+	findOption.Sort = q.querySort()
+	findOption.Pagination = &PaginationOption{Limit: &limit}
+
+	q.Options = &findOption
+
+	return q, nil
+}
+
+// offset prepares the $facet pipeline reading the page at the offset given
+// by pagination.
+func (q *PageQuery) offset(pagination *PaginationOption, findOption *FindOptions) error {
+	if pagination.Cursor != "" {
+		return errors.New("pagination cursor cannot be combined with skip or page")
+	}
+
+	skip, err := pagination.Offset()
+
+	if err != nil {
+		return err
+	}
+
+	q.skip = skip
+
+	for _, p := range findOption.Projection {
+		if p.Slice != nil || p.ElemMatch != nil {
+			return errors.New("slice and elemMatch projections are not supported with offset pagination")
+		}
+	}
+
+	limit := int64(q.limit)
+
+	findOption.Sort = q.sort
+	findOption.Pagination = &PaginationOption{Limit: &limit}
+
+	q.Options = findOption
+
+	items := bson.A{
+		bson.M{"$sort": findOption.SortDocument()},
+		bson.M{"$skip": q.skip},
+		bson.M{"$limit": limit},
+	}
+
+	if projection := findOption.ProjectionDocument(); projection != nil {
+		items = append(items, bson.M{"$project": projection})
+	}
+
+	match := q.Filter
+
+	if match == nil {
+		match = bson.M{}
+	}
+
+	q.Pipeline = bson.A{
+		bson.M{"$match": match},
+		bson.M{"$facet": bson.M{
+			"items": items,
+			"total": bson.A{bson.M{"$count": "count"}},
+		}},
+	}
+
+	return nil
+}
+
+func (q *PageQuery) sortFields() []string {
+	fields := make([]string, len(q.sort))
+
+	for i, s := range q.sort {
+		fields[i] = s.SortField
+	}
+
+	return fields
+}
+
+func (q *PageQuery) backward() bool {
+	return q.cursor != nil && q.cursor.Backward
+}
+
+// querySort returns the sort of the query, reversed when reading backward.
+func (q *PageQuery) querySort() []SortOption {
+	sort := make([]SortOption, len(q.sort))
+
+	for i, s := range q.sort {
+		if q.backward() {
+			s.Order = -s.Order
+		}
+
+		sort[i] = s
+	}
+
+	return sort
+}
+
+// keysetFilter restricts filters to the rows coming after the cursor in the
+// order of the query: (a > x) or (a = x and b > y) and so on.
+func (q *PageQuery) keysetFilter(filters bson.M) bson.M {
+	var or bson.A
+
+	for i, s := range q.querySort() {
+		clause := bson.M{}
+
+		for j := 0; j < i; j++ {
+			clause[q.sort[j].SortField] = q.cursor.Values[j]
+		}
+
+		op := "$gt"
+
+		if s.Order == OrderDESC {
+			op = "$lt"
+		}
+
+		clause[s.SortField] = bson.M{op: q.cursor.Values[i]}
+		or = append(or, clause)
+	}
+
+	keyset := bson.M{"$or": or}
+
+	if len(filters) == 0 {
+		return keyset
+	}
+
+	return bson.M{"$and": bson.A{filters, keyset}}
+}
+
+func (q *PageQuery) cursorAt(row bson.Raw, backward bool) (string, error) {
+	c := pageCursor{
+		Fields:   q.sortFields(),
+		Backward: backward,
+	}
+
+	for _, field := range c.Fields {
+		value, err := row.LookupErr(strings.Split(field, ".")...)
+
+		if err != nil {
+			value = bson.RawValue{Type: bsontype.Null}
+		}
+
+		c.Values = append(c.Values, value)
+	}
+
+	return encodeCursor(c)
+}
+
+// Page builds the PageInfo of the rows read by the query, and hands the rows
+// belonging to the page to decoder in the requested order.
+func (q *PageQuery) Page(rows []bson.Raw, decoder ResultDecoder) (*PageInfo, error) {
+	more := len(rows) > q.limit
+
+	if more {
+		rows = rows[:q.limit]
+	}
+
+	if q.backward() {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	info := &PageInfo{}
+
+	if len(rows) > 0 {
+		hasNext, hasPrev := more, q.cursor != nil
+
+		if q.backward() {
+			hasNext, hasPrev = true, more
+		}
+
+		var err error
+
+		if hasNext {
+			info.HasMore = true
+			info.NextCursor, err = q.cursorAt(rows[len(rows)-1], false)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if hasPrev {
+			info.PrevCursor, err = q.cursorAt(rows[0], true)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err := decodeRows(rows, decoder, q.Registry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// FacetPage builds the PageInfo of the document returned by Pipeline, and
+// hands the items of the page to decoder.
+func (q *PageQuery) FacetPage(facet bson.Raw, decoder ResultDecoder) (*PageInfo, error) {
+	var res struct {
+		Items []bson.Raw `bson:"items"`
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+	}
+
+	if facet != nil {
+		err := bson.Unmarshal(facet, &res)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	info := &PageInfo{
+		Page: q.skip/int64(q.limit) + 1,
+	}
+
+	if len(res.Total) > 0 {
+		info.TotalCount = res.Total[0].Count
+	}
+
+	info.HasMore = q.skip+int64(len(res.Items)) < info.TotalCount
+
+	err := decodeRows(res.Items, decoder, q.Registry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func decodeRows(rows []bson.Raw, decoder ResultDecoder, registry *bsoncodec.Registry) error {
+	if decoder == nil || len(rows) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(rows))
+
+	for i, row := range rows {
+		docs[i] = row
+	}
+
+	cur, err := mongo.NewCursorFromDocuments(docs, nil, registry)
+
+	if err != nil {
+		return err
+	}
+
+	for cur.Next(context.Background()) {
+		if err := decoder(ResultCursor{Cursor: cur}); err != nil {
+			return err
+		}
+	}
+
+	return cur.Err()
+}
@@ -0,0 +1,198 @@
+package mongo
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func pageRows(t *testing.T, ids ...string) []bson.Raw {
+	var rows []bson.Raw
+
+	for i, id := range ids {
+		row, err := bson.Marshal(bson.D{{Key: "_id", Value: id}, {Key: "rank", Value: i}})
+		assert.Nil(t, err)
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+func TestNewPageQueryValidation(t *testing.T) {
+	limit := int64(2)
+
+	_, err := NewPageQuery(nil)
+	assert.NotNil(t, err)
+
+	_, err = NewPageQuery(nil, &FindOptions{Pagination: &PaginationOption{Limit: &limit, Cursor: "not a cursor"}})
+	assert.True(t, errors.Is(err, ErrInvalidCursor))
+
+	_, err = NewPageQuery(nil, &FindOptions{
+		Sort:       []SortOption{{SortField: "score", TextScore: true}},
+		Pagination: &PaginationOption{Limit: &limit},
+	})
+	assert.NotNil(t, err)
+
+	cursor, err := encodeCursor(pageCursor{Fields: []string{"_id"}, Values: []bson.RawValue{{}}})
+	assert.Nil(t, err)
+
+	_, err = NewPageQuery(nil, &FindOptions{
+		Sort:       []SortOption{{SortField: "rank", Order: OrderASC}},
+		Pagination: &PaginationOption{Limit: &limit, Cursor: cursor},
+	})
+	assert.True(t, errors.Is(err, ErrInvalidCursor))
+}
+
+func TestPageQueryForwardAndBackward(t *testing.T) {
+	limit := int64(2)
+
+	findOptions := &FindOptions{
+		Sort:       []SortOption{{SortField: "rank", Order: OrderDESC}},
+		Pagination: &PaginationOption{Limit: &limit},
+	}
+
+	query, err := NewPageQuery(bson.M{"active": true}, findOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"active": true}, query.Filter)
+	assert.Equal(t, bson.D{{Key: "rank", Value: OrderDESC}, {Key: "_id", Value: OrderASC}}, query.Options.SortDocument())
+	assert.Equal(t, int64(3), *query.Options.Pagination.Limit)
+
+	var ids []string
+
+	decoder := func(cursor ResultCursor) error {
+		ids = append(ids, cursor.Current.Lookup("_id").StringValue())
+		return nil
+	}
+
+	info, err := query.Page(pageRows(t, "a", "b", "c"), decoder)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+	assert.True(t, info.HasMore)
+	assert.Empty(t, info.PrevCursor)
+
+	findOptions.Pagination.Cursor = info.NextCursor
+
+	query, err = NewPageQuery(bson.M{"active": true}, findOptions)
+	assert.Nil(t, err)
+
+	rank := query.Filter["$and"].(bson.A)[1].(bson.M)["$or"].(bson.A)[0].(bson.M)["rank"].(bson.M)
+
+	assert.Contains(t, rank, "$lt")
+	assert.Equal(t, int32(1), rank["$lt"].(bson.RawValue).Int32())
+
+	ids = nil
+
+	info, err = query.Page(pageRows(t, "c"), decoder)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c"}, ids)
+	assert.False(t, info.HasMore)
+	assert.Empty(t, info.NextCursor)
+	assert.NotEmpty(t, info.PrevCursor)
+
+	findOptions.Pagination.Cursor = info.PrevCursor
+
+	query, err = NewPageQuery(nil, findOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{{Key: "rank", Value: OrderASC}, {Key: "_id", Value: OrderDESC}}, query.Options.SortDocument())
+
+	ids = nil
+
+	info, err = query.Page(pageRows(t, "b", "a"), decoder)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+	assert.True(t, info.HasMore)
+	assert.NotEmpty(t, info.NextCursor)
+	assert.Empty(t, info.PrevCursor)
+}
+
+func TestPaginationOffset(t *testing.T) {
+	limit := int64(10)
+
+	skip, err := (*PaginationOption)(nil).Offset()
+	assert.Nil(t, err)
+	assert.Zero(t, skip)
+
+	skip, err = (&PaginationOption{Skip: 15}).Offset()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15), skip)
+
+	skip, err = (&PaginationOption{Limit: &limit, Page: 3}).Offset()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), skip)
+
+	for _, pagination := range []*PaginationOption{
+		{Page: 2},
+		{Skip: -1},
+		{Limit: &limit, Page: 2, Skip: 5},
+		{Skip: 500, MaxSkip: 100},
+	} {
+		_, err := pagination.Offset()
+		assert.NotNil(t, err, pagination)
+	}
+
+	_, err = (&PaginationOption{Limit: &limit, Cursor: "cursor"}).Offset()
+	assert.True(t, errors.Is(err, ErrInvalidCursor))
+}
+
+func TestPageQueryOffset(t *testing.T) {
+	limit := int64(10)
+
+	for _, pagination := range []*PaginationOption{
+		{Limit: &limit, Page: 1, Cursor: "cursor"},
+		{Limit: &limit, Page: 2, Skip: 5},
+		{Limit: &limit, Skip: -1},
+		{Limit: &limit, Page: 1002},
+		{Limit: &limit, Skip: 500, MaxSkip: 100},
+	} {
+		_, err := NewPageQuery(nil, &FindOptions{Pagination: pagination})
+		assert.NotNil(t, err, pagination)
+	}
+
+	_, err := NewPageQuery(nil, &FindOptions{Pagination: &PaginationOption{Limit: &limit, Skip: 20000}})
+	assert.True(t, errors.Is(err, ErrSkipTooLarge))
+
+	_, err = NewPageQuery(nil, &FindOptions{
+		Pagination: &PaginationOption{Limit: &limit, Page: 1},
+		Projection: []ProjectionOption{{Field: "tags", Slice: &SliceOption{Limit: 1}}},
+	})
+	assert.NotNil(t, err)
+
+	query, err := NewPageQuery(bson.M{"active": true}, &FindOptions{
+		Sort:       []SortOption{{SortField: "rank", Order: OrderDESC}},
+		Pagination: &PaginationOption{Limit: &limit, Page: 3},
+		Projection: []ProjectionOption{{Field: "rank"}},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, bson.A{
+		bson.M{"$match": bson.M{"active": true}},
+		bson.M{"$facet": bson.M{
+			"items": bson.A{
+				bson.M{"$sort": bson.D{{Key: "rank", Value: OrderDESC}, {Key: "_id", Value: OrderASC}}},
+				bson.M{"$skip": int64(20)},
+				bson.M{"$limit": int64(10)},
+				bson.M{"$project": bson.D{{Key: "rank", Value: 1}}},
+			},
+			"total": bson.A{bson.M{"$count": "count"}},
+		}},
+	}, query.Pipeline)
+
+	facet, err := bson.Marshal(bson.M{
+		"items": pageRows(t, "u", "v"),
+		"total": bson.A{bson.M{"count": int32(22)}},
+	})
+	assert.Nil(t, err)
+
+	var ids []string
+
+	info, err := query.FacetPage(facet, func(cursor ResultCursor) error {
+		ids = append(ids, cursor.Current.Lookup("_id").StringValue())
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"u", "v"}, ids)
+	assert.Equal(t, &PageInfo{TotalCount: 22, Page: 3}, info)
+}
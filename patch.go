@@ -0,0 +1,634 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatchOperation is an operation of a JSON Patch document, see RFC 6902.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ParseJSONPatch decodes a JSON Patch document.
+func ParseJSONPatch(data []byte) ([]PatchOperation, error) {
+	var ops []PatchOperation
+
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	return ops, nil
+}
+
+// Patch is a merge patch or a JSON Patch translated into updates of a
+// document. Operations touching a field already changed by a previous one,
+// and removals of array elements, need another update, so such patches are
+// applied in a transaction.
+type Patch struct {
+	op      string
+	stages  []*patchStage
+	removed string
+}
+
+// patchStage is one update of a patch. filter holds the conditions the
+// document must match beforehand: the values of test operations and the
+// existence of the fields replaced, removed or moved. pipeline is set when
+// the update writes into subdocuments which may be null.
+type patchStage struct {
+	filter   bson.M
+	update   *UpdateBuilder
+	pipeline bool
+}
+
+var (
+	tD         = reflect.TypeOf(bson.D{})
+	tInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// patcher translates patches against the struct type of a document, whose
+// fields are looked up by their JSON names and written under their document
+// keys.
+type patcher struct {
+	t      reflect.Type
+	naming *NamingStrategy
+	patch  *Patch
+}
+
+func newPatcher(op string, d Document, naming []*NamingStrategy) *patcher {
+	return &patcher{
+		t:      derefType(reflect.TypeOf(d)),
+		naming: namingOf(naming),
+		patch:  &Patch{op: op, stages: []*patchStage{newPatchStage()}},
+	}
+}
+
+func newPatchStage() *patchStage {
+	return &patchStage{filter: bson.M{}, update: NewUpdate()}
+}
+
+// NewMergePatch translates a JSON merge patch, see RFC 7396, against the
+// fields of d: null members unset their field, objects are merged into
+// subdocuments, which are created when missing or null, and any other value
+// is set as a whole, arrays included.
+func NewMergePatch(d Document, patch []byte, naming ...*NamingStrategy) (*Patch, error) {
+	var members map[string]json.RawMessage
+
+	if err := json.Unmarshal(patch, &members); err != nil || members == nil {
+		return nil, fmt.Errorf("%w: a merge patch must be a JSON object", ErrInvalidPatch)
+	}
+
+	p := newPatcher("ApplyMergePatch", d, naming)
+
+	if err := p.merge("", "", p.t, members); err != nil {
+		return nil, err
+	}
+
+	return p.patch, nil
+}
+
+func (p *patcher) merge(pointer, prefix string, t reflect.Type, members map[string]json.RawMessage) error {
+	keys := make([]string, 0, len(members))
+
+	for k := range members {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	update := p.patch.stages[0].update
+
+	for _, key := range keys {
+		raw := members[key]
+		memberPointer := pointer + "/" + key
+
+		name, ft, _, err := p.step(memberPointer, t, key, prefix == "", true)
+
+		if err != nil {
+			return err
+		}
+
+		path := joinPath(prefix, name)
+
+		switch {
+		case isJSONNull(raw):
+			update.Unset(path)
+		case bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) && documentType(ft, p.naming):
+			var sub map[string]json.RawMessage
+
+			if err = json.Unmarshal(raw, &sub); err != nil {
+				return fmt.Errorf("%w: %s: %s", ErrInvalidPatch, memberPointer, err)
+			}
+
+			if nullable(ft) {
+				p.patch.stages[0].pipeline = true
+			}
+
+			if err = p.merge(memberPointer, path, ft, sub); err != nil {
+				return err
+			}
+		default:
+			value, err := decodePatchValue(memberPointer, ft, raw)
+
+			if err != nil {
+				return err
+			}
+
+			update.Set(path, value)
+		}
+	}
+
+	return nil
+}
+
+// NewJSONPatch translates the operations of a JSON Patch against the fields
+// of d. add and replace set fields, or push array elements, remove unsets
+// them, move renames them and test values are matched by the update filter,
+// as well as the existence of the fields replaced, removed or moved. copy is
+// not supported, and move does not apply to array elements.
+func NewJSONPatch(d Document, ops []PatchOperation, naming ...*NamingStrategy) (*Patch, error) {
+	p := newPatcher("ApplyJSONPatch", d, naming)
+
+	for i, op := range ops {
+		if err := p.operation(op); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return p.patch, nil
+}
+
+// patchTarget is the field a JSON pointer refers to. array is the path of
+// the array holding it when the pointer ends with an array index or "-".
+type patchTarget struct {
+	path    string
+	t       reflect.Type
+	array   string
+	last    string
+	indexed bool
+}
+
+func (p *patcher) operation(op PatchOperation) error {
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return fmt.Errorf("%w: %s %s requires a value", ErrInvalidPatch, op.Op, op.Path)
+		}
+	case "copy":
+		return fmt.Errorf("%w: copy is not supported", ErrInvalidPatch)
+	case "remove", "move":
+	default:
+		return fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+	}
+
+	target, err := p.resolve(op.Path)
+
+	if err != nil {
+		return err
+	}
+
+	if target.last == "-" && op.Op != "add" {
+		return fmt.Errorf("%w: %s cannot target %s", ErrInvalidPatch, op.Op, op.Path)
+	}
+
+	var value interface{}
+
+	if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+		value, err = decodePatchValue(op.Path, target.t, op.Value)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		if target.array == "" {
+			p.stageFor(target.path).update.Set(target.path, value)
+			return nil
+		}
+
+		if target.last == "-" {
+			p.stageFor(target.array).update.Push(target.array, value)
+			return nil
+		}
+
+		position, _ := strconv.Atoi(target.last)
+		stage := p.stageFor(target.array)
+
+		// The index may be the length of the array at most, so the element
+		// before it must exist.
+		if position > 0 {
+			previous := joinPath(target.array, strconv.Itoa(position-1))
+			stage = p.stageFor(target.array, previous)
+			stage.filter[previous] = bson.M{"$exists": true}
+		}
+
+		stage.update.PushEach(target.array, []interface{}{value}, PushModifiers{Position: &position})
+	case "replace":
+		stage := p.stageFor(target.path)
+		stage.filter[target.path] = bson.M{"$exists": true}
+		stage.update.Set(target.path, value)
+	case "test":
+		p.stageFor(target.path).filter[target.path] = value
+	case "remove":
+		stage := p.stageFor(target.path)
+		stage.filter[target.path] = bson.M{"$exists": true}
+
+		if target.array == "" {
+			stage.update.Unset(target.path)
+			return nil
+		}
+
+		// There is no operator removing an element by index: it is replaced
+		// by a marker first, which is then pulled.
+		stage.update.Set(target.path, p.removed())
+		p.next().update.Pull(target.array, p.removed())
+	case "move":
+		return p.move(op, target)
+	}
+
+	return nil
+}
+
+func (p *patcher) move(op PatchOperation, target patchTarget) error {
+	from, err := p.resolve(op.From)
+
+	if err != nil {
+		return err
+	}
+
+	if from.path == target.path {
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(target.path, from.path+"."):
+		return fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPatch, op.From)
+	case from.indexed || target.indexed:
+		return fmt.Errorf("%w: move does not apply to array elements", ErrInvalidPatch)
+	case derefType(from.t) != derefType(target.t):
+		return fmt.Errorf("%w: cannot move a %s to %s", ErrInvalidPatch, from.t, op.Path)
+	}
+
+	stage := p.stageFor(from.path, target.path)
+	stage.filter[from.path] = bson.M{"$exists": true}
+	stage.update.Rename(from.path, target.path)
+
+	return nil
+}
+
+// stageFor returns the stage to add an operation on paths to, starting a new
+// one when the current stage already updates or filters them.
+func (p *patcher) stageFor(paths ...string) *patchStage {
+	stage := p.patch.stages[len(p.patch.stages)-1]
+
+	for _, path := range paths {
+		if _, filtered := stage.filter[path]; filtered || touches(stage.update.update, path) {
+			return p.next()
+		}
+	}
+
+	return stage
+}
+
+// input returns the update of the stage. Updates writing into subdocuments
+// which may be null are sent as a pipeline: unlike the $set operator, which
+// fails on a null parent, a $set stage replaces the parents which are not
+// documents by new ones, as RFC 7396 replaces targets which are not objects
+// by the merged object.
+func (s *patchStage) input() interface{} {
+	if !s.pipeline {
+		return s.update
+	}
+
+	var pipeline UpdatePipeline
+
+	for _, op := range s.update.update {
+		fields := op.Value.(bson.D)
+
+		switch op.Key {
+		case "$set":
+			set := make(bson.D, len(fields))
+
+			for i, field := range fields {
+				set[i] = bson.E{Key: field.Key, Value: bson.D{{Key: "$literal", Value: field.Value}}}
+			}
+
+			pipeline = append(pipeline, bson.D{{Key: "$set", Value: set}})
+		case "$unset":
+			unset := make(bson.A, len(fields))
+
+			for i, field := range fields {
+				unset[i] = field.Key
+			}
+
+			pipeline = append(pipeline, bson.D{{Key: "$unset", Value: unset}})
+		}
+	}
+
+	return pipeline
+}
+
+func (p *patcher) next() *patchStage {
+	stage := newPatchStage()
+	p.patch.stages = append(p.patch.stages, stage)
+
+	return stage
+}
+
+// removed returns the marker of the array elements to remove.
+func (p *patcher) removed() string {
+	if p.patch.removed == "" {
+		p.patch.removed = "patch-removed-" + uuid.NewString()
+	}
+
+	return p.patch.removed
+}
+
+// resolve returns the field pointer refers to, validating every segment
+// against the document type.
+func (p *patcher) resolve(pointer string) (patchTarget, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return patchTarget{}, fmt.Errorf("%w: %q does not point to a field", ErrInvalidPatch, pointer)
+	}
+
+	segments := strings.Split(pointer[1:], "/")
+	target := patchTarget{t: p.t}
+
+	for i, segment := range segments {
+		segment = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+
+		name, t, element, err := p.step(pointer, target.t, segment, i == 0, i == len(segments)-1)
+
+		if err != nil {
+			return patchTarget{}, err
+		}
+
+		target.array = ""
+
+		if element {
+			target.array = target.path
+			target.indexed = true
+		}
+
+		target.path = joinPath(target.path, name)
+		target.t = t
+		target.last = segment
+	}
+
+	return target, nil
+}
+
+// step resolves segment within a value of type t, returning its document key,
+// its type and whether it is an array element.
+func (p *patcher) step(pointer string, t reflect.Type, segment string, top, last bool) (string, reflect.Type, bool, error) {
+	t = derefType(t)
+
+	var name string
+	var next reflect.Type
+	var element bool
+
+	switch {
+	case t == tD || t.Kind() == reflect.Interface:
+		name, next = segment, tInterface
+	case arrayType(t):
+		if !(segment == "-" && last) && (segment == "" || !isIndex(segment)) {
+			return "", nil, false, fmt.Errorf("%w: %s: %q is not an array index", ErrInvalidPatch, pointer, segment)
+		}
+
+		name, next, element = segment, t.Elem(), true
+	case cachedType(t, p.naming).kind == flattenStruct:
+		field, ok := p.field(t, segment)
+
+		if !ok {
+			return "", nil, false, fmt.Errorf("%w: %s: unknown field %q", ErrInvalidPatch, pointer, segment)
+		}
+
+		name, next = field.name, field.Type
+	case cachedType(t, p.naming).kind == flattenMap:
+		name, next = segment, t.Elem()
+	default:
+		return "", nil, false, fmt.Errorf("%w: %s: a %s has no field %q", ErrInvalidPatch, pointer, t, segment)
+	}
+
+	if !element && (name == "" || strings.Contains(name, ".") || strings.HasPrefix(name, "$")) {
+		return "", nil, false, fmt.Errorf("%w: %s: invalid field name %q", ErrInvalidPatch, pointer, segment)
+	}
+
+	if top && name == "_id" {
+		return "", nil, false, fmt.Errorf("%w: %s: the document id cannot be patched", ErrInvalidPatch, pointer)
+	}
+
+	return name, next, element, nil
+}
+
+// patchField is a struct field along with its document key.
+type patchField struct {
+	reflect.StructField
+	name string
+}
+
+// field looks up the field of the struct t named by its JSON name, as
+// encoding/json does: exact matches win over case insensitive ones. The
+// fields of inline structs are looked up as well.
+func (p *patcher) field(t reflect.Type, name string) (patchField, bool) {
+	var folded *patchField
+
+	for _, info := range cachedType(t, p.naming).fields {
+		sf := t.Field(info.index)
+
+		if info.inline {
+			inline := derefType(sf.Type)
+
+			if cachedType(inline, p.naming).kind != flattenStruct {
+				continue
+			}
+
+			if field, ok := p.field(inline, name); ok {
+				return field, true
+			}
+
+			continue
+		}
+
+		jsonName, ok := jsonFieldName(sf)
+
+		switch {
+		case !ok:
+		case jsonName == name:
+			return patchField{StructField: sf, name: info.name}, true
+		case folded == nil && strings.EqualFold(jsonName, name):
+			folded = &patchField{StructField: sf, name: info.name}
+		}
+	}
+
+	if folded != nil {
+		return *folded, true
+	}
+
+	return patchField{}, false
+}
+
+// jsonFieldName returns the JSON name of sf, or false when encoding/json
+// skips it.
+func jsonFieldName(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("json")
+
+	if tag == "-" {
+		return "", false
+	}
+
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+
+	return sf.Name, true
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr && !marshals(t) {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// arrayType reports whether values of t are BSON arrays.
+func arrayType(t reflect.Type) bool {
+	if wholeType(t) || t == tD {
+		return false
+	}
+
+	return t.Kind() == reflect.Array || t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8
+}
+
+// documentType reports whether values of t are BSON documents, which merge
+// patches are merged into.
+func documentType(t reflect.Type, naming *NamingStrategy) bool {
+	t = derefType(t)
+
+	return t == tD || t.Kind() == reflect.Interface || cachedType(t, naming).kind != flattenLeaf
+}
+
+// nullable reports whether fields of type t may be stored as null: unlike
+// structs, nil pointers, maps, slices and interfaces are.
+func nullable(t reflect.Type) bool {
+	return t.Kind() != reflect.Struct
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// decodePatchValue decodes raw into a value of type t, so that it is stored
+// with the type of the field it is written to.
+func decodePatchValue(pointer string, t reflect.Type, raw json.RawMessage) (interface{}, error) {
+	if isJSONNull(raw) {
+		return nil, nil
+	}
+
+	v := reflect.New(t)
+
+	if err := json.Unmarshal(raw, v.Interface()); err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalidPatch, pointer, err)
+	}
+
+	return v.Elem().Interface(), nil
+}
+
+// Apply applies the patch to the document of d whose _id is id through c,
+// in a transaction started with ctx when it needs several updates.
+// ErrNotFound is returned when the document does not exist and
+// ErrPatchFailed when it does not match the tests or the fields of the
+// patch.
+func (p *Patch) Apply(ctx context.Context, c Client, d Document, id string) (*UpdateResult, error) {
+	if len(p.stages) == 1 {
+		return p.apply(c, d, id)
+	}
+
+	var result *UpdateResult
+
+	err := c.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = p.apply(c.WithContext(ctx), d, id)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *Patch) apply(c Client, d Document, id string) (*UpdateResult, error) {
+	result := &UpdateResult{MatchedCount: 1}
+
+	for i, stage := range p.stages {
+		filter := bson.M{"_id": id}
+
+		for k, v := range stage.filter {
+			filter[k] = v
+		}
+
+		var matched bool
+		var err error
+
+		if len(stage.update.update) == 0 {
+			matched, err = c.Exists(d, filter)
+		} else {
+			var res *UpdateResult
+			res, err = c.UpdateWhere(d, filter, stage.input())
+
+			if res != nil {
+				matched = res.MatchedCount > 0
+				result.ModifiedCount += res.ModifiedCount
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if matched {
+			continue
+		}
+
+		cause := ErrPatchFailed
+
+		if i == 0 {
+			found := false
+
+			if len(stage.filter) > 0 {
+				if found, err = c.Exists(d, bson.M{"_id": id}); err != nil {
+					return nil, err
+				}
+			}
+
+			if !found {
+				cause = ErrNotFound
+			}
+		}
+
+		return nil, newOperationError(p.op, d, filter, cause)
+	}
+
+	if result.ModifiedCount > 1 {
+		result.ModifiedCount = 1
+	}
+
+	return result, nil
+}
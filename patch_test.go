@@ -0,0 +1,200 @@
+package mongo
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+)
+
+type patchAddress struct {
+	City string `json:"city" bson:"city"`
+	Zip  string `json:"zip" bson:"zip"`
+}
+
+type patchLine struct {
+	Sku string `json:"sku" bson:"sku"`
+	Qty int    `json:"qty" bson:"qty"`
+}
+
+type patchCustomer struct {
+	BasicDocument `bson:",inline"`
+	Name          string            `json:"name" bson:"name"`
+	Address       *patchAddress     `json:"address" bson:"address"`
+	Lines         []patchLine       `json:"lines" bson:"lines"`
+	Labels        map[string]string `json:"labels" bson:"labels"`
+	SignedUp      time.Time         `json:"signedUp" bson:"signed_up"`
+	Secret        string            `json:"-" bson:"secret"`
+}
+
+func (c patchCustomer) DocumentName() string { return "customers" }
+
+func TestMergePatch(t *testing.T) {
+	patch, err := NewMergePatch(&patchCustomer{}, []byte(`{
+		"name": "Ada",
+		"address": {"city": "Paris", "zip": null},
+		"labels": {"tier": "gold"},
+		"lines": [{"sku": "A1", "qty": 2}],
+		"signedUp": "2023-05-01T00:00:00Z",
+		"updatedAt": null
+	}`))
+	assert.Nil(t, err)
+	assert.Len(t, patch.stages, 1)
+
+	assert.Equal(t, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "address.city", Value: "Paris"},
+			{Key: "labels.tier", Value: "gold"},
+			{Key: "lines", Value: []patchLine{{Sku: "A1", Qty: 2}}},
+			{Key: "name", Value: "Ada"},
+			{Key: "signed_up", Value: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)},
+		}},
+		{Key: "$unset", Value: bson.D{{Key: "address.zip", Value: ""}, {Key: "updatedAt", Value: ""}}},
+	}, patch.stages[0].update.Document())
+
+	literal := func(v interface{}) bson.D { return bson.D{{Key: "$literal", Value: v}} }
+
+	assert.Equal(t, UpdatePipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "address.city", Value: literal("Paris")},
+			{Key: "labels.tier", Value: literal("gold")},
+			{Key: "lines", Value: literal([]patchLine{{Sku: "A1", Qty: 2}})},
+			{Key: "name", Value: literal("Ada")},
+			{Key: "signed_up", Value: literal(time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC))},
+		}}},
+		{{Key: "$unset", Value: bson.A{"address.zip", "updatedAt"}}},
+	}, patch.stages[0].input())
+
+	patch, err = NewMergePatch(&patchCustomer{}, []byte(`{"name": "Ada"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, patch.stages[0].update, patch.stages[0].input())
+}
+
+func TestPipelineUpdate(t *testing.T) {
+	_, ok := PipelineUpdate(NewUpdate())
+	assert.False(t, ok)
+
+	pipeline, ok := PipelineUpdate(UpdatePipeline{{{Key: "$set", Value: bson.D{{Key: "name", Value: "Ada"}}}}})
+	assert.True(t, ok)
+	assert.Len(t, pipeline, 2)
+	assert.Equal(t, "updatedAt", pipeline[1][0].Value.(bson.D)[0].Key)
+
+	pipeline, ok = PipelineUpdate(UpdatePipeline{{{Key: "$unset", Value: bson.A{"updatedAt"}}}})
+	assert.True(t, ok)
+	assert.Len(t, pipeline, 1)
+
+	_, err := UpdateDocument(UpdatePipeline{})
+	assert.NotNil(t, err)
+}
+
+func TestMergePatchValidation(t *testing.T) {
+	for _, patch := range []string{
+		`[]`,
+		`{"unknown": 1}`,
+		`{"secret": "x"}`,
+		`{"id": "other"}`,
+		`{"name": 1}`,
+		`{"address": {"country": "FR"}}`,
+		`{"labels": {"a.b": "c"}}`,
+	} {
+		_, err := NewMergePatch(&patchCustomer{}, []byte(patch))
+		assert.True(t, errors.Is(err, ErrInvalidPatch), patch)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	ops, err := ParseJSONPatch([]byte(`[
+		{"op": "test", "path": "/name", "value": "Ada"},
+		{"op": "replace", "path": "/name", "value": "Grace"},
+		{"op": "add", "path": "/lines/-", "value": {"sku": "B2", "qty": 1}},
+		{"op": "add", "path": "/labels/tier", "value": "gold"},
+		{"op": "move", "path": "/labels/level", "from": "/labels/tier"},
+		{"op": "remove", "path": "/lines/0"},
+		{"op": "add", "path": "/lines/0", "value": {"sku": "C3", "qty": 4}},
+		{"op": "replace", "path": "/lines/1/qty", "value": 3}
+	]`))
+	assert.Nil(t, err)
+
+	patch, err := NewJSONPatch(&patchCustomer{}, ops)
+	assert.Nil(t, err)
+
+	exists := bson.M{"$exists": true}
+	position := 0
+
+	assert.Equal(t, []*patchStage{
+		{filter: bson.M{"name": "Ada"}, update: NewUpdate()},
+		{
+			filter: bson.M{"name": exists},
+			update: NewUpdate().
+				Set("name", "Grace").
+				Push("lines", patchLine{Sku: "B2", Qty: 1}).
+				Set("labels.tier", "gold"),
+		},
+		{
+			filter: bson.M{"labels.tier": exists, "lines.0": exists},
+			update: NewUpdate().Rename("labels.tier", "labels.level").Set("lines.0", patch.removed),
+		},
+		{filter: bson.M{}, update: NewUpdate().Pull("lines", patch.removed)},
+		{
+			filter: bson.M{},
+			update: NewUpdate().PushEach("lines", []interface{}{patchLine{Sku: "C3", Qty: 4}}, PushModifiers{Position: &position}),
+		},
+		{filter: bson.M{"lines.1.qty": exists}, update: NewUpdate().Set("lines.1.qty", 3)},
+	}, patch.stages)
+}
+
+func TestJSONPatchAddIndex(t *testing.T) {
+	patch, err := NewJSONPatch(&patchCustomer{}, []PatchOperation{
+		{Op: "add", Path: "/lines/2", Value: json.RawMessage(`{"sku": "C3"}`)},
+	})
+	assert.Nil(t, err)
+
+	position := 2
+
+	assert.Equal(t, []*patchStage{{
+		filter: bson.M{"lines.1": bson.M{"$exists": true}},
+		update: NewUpdate().PushEach("lines", []interface{}{patchLine{Sku: "C3"}}, PushModifiers{Position: &position}),
+	}}, patch.stages)
+}
+
+func TestJSONPatchValidation(t *testing.T) {
+	for _, op := range []PatchOperation{
+		{Op: "add", Path: "/name"},
+		{Op: "add", Path: "name", Value: json.RawMessage(`"x"`)},
+		{Op: "add", Path: "", Value: json.RawMessage(`{}`)},
+		{Op: "replace", Path: "/id", Value: json.RawMessage(`"x"`)},
+		{Op: "replace", Path: "/lines/x", Value: json.RawMessage(`{}`)},
+		{Op: "replace", Path: "/lines/-", Value: json.RawMessage(`{}`)},
+		{Op: "replace", Path: "/name/first", Value: json.RawMessage(`"x"`)},
+		{Op: "remove", Path: "/unknown"},
+		{Op: "move", Path: "/lines/0/sku", From: "/name"},
+		{Op: "move", Path: "/address/city", From: "/address"},
+		{Op: "move", Path: "/name", From: "/signedUp"},
+		{Op: "copy", Path: "/name", From: "/address/city"},
+		{Op: "merge", Path: "/name"},
+	} {
+		_, err := NewJSONPatch(&patchCustomer{}, []PatchOperation{op})
+		assert.True(t, errors.Is(err, ErrInvalidPatch), op)
+	}
+}
+
+type patchAccount struct {
+	BasicDocument `bson:",inline"`
+	DisplayName   string `json:"displayName"`
+}
+
+func (a patchAccount) DocumentName() string { return "accounts" }
+
+func TestPatchNamingStrategy(t *testing.T) {
+	ops := []PatchOperation{{Op: "replace", Path: "/displayName", Value: json.RawMessage(`"Ada"`)}}
+
+	patch, err := NewJSONPatch(&patchAccount{}, ops, SnakeCaseNaming)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"display_name": bson.M{"$exists": true}}, patch.stages[0].filter)
+
+	patch, err = NewJSONPatch(&patchAccount{}, ops)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"displayname": bson.M{"$exists": true}}, patch.stages[0].filter)
+}
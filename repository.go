@@ -0,0 +1,137 @@
+package mongo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Repository gives typed access to the collection of a single Document type.
+// T is expected to be a pointer to a struct, e.g. Repository[*User].
+type Repository[T Document] struct {
+	client Client
+}
+
+func NewRepository[T Document](client Client) *Repository[T] {
+	return &Repository[T]{
+		client: client,
+	}
+}
+
+func (r *Repository[T]) Client() Client {
+	return r.client
+}
+
+func (r *Repository[T]) WithContext(ctx context.Context) *Repository[T] {
+	return &Repository[T]{
+		client: r.client.WithContext(ctx),
+	}
+}
+
+func (r *Repository[T]) newDocument() T {
+	return newValue[T]()
+}
+
+func (r *Repository[T]) Get(id string) (T, error) {
+	d := r.newDocument()
+
+	err := r.client.FindOneById(d, id)
+
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return d, nil
+}
+
+func (r *Repository[T]) First(filter bson.M, findOptions ...*FindOptions) (T, error) {
+	d := r.newDocument()
+
+	err := r.client.FindOne(d, filter, findOptions...)
+
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return d, nil
+}
+
+func (r *Repository[T]) List(filter bson.M, findOptions ...*FindOptions) ([]T, error) {
+	var items []T
+
+	err := r.client.FindAll(r.newDocument(), filter, func(cursor ResultCursor) error {
+		d := r.newDocument()
+
+		err := cursor.Decode(d)
+
+		if err != nil {
+			return err
+		}
+
+		items = append(items, d)
+
+		return nil
+	}, findOptions...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Page reads a page of the documents matching filter, see PageQuery.
+func (r *Repository[T]) Page(filter bson.M, findOptions ...*FindOptions) (*Page[T], error) {
+	page := &Page[T]{}
+
+	info, err := r.client.FindPage(r.newDocument(), filter, func(cursor ResultCursor) error {
+		d := r.newDocument()
+
+		err := cursor.Decode(d)
+
+		if err != nil {
+			return err
+		}
+
+		page.Items = append(page.Items, d)
+
+		return nil
+	}, findOptions...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	page.PageInfo = *info
+
+	return page, nil
+}
+
+// Stream returns an iterator over the documents matching filter. It must be
+// closed unless it is drained.
+func (r *Repository[T]) Stream(filter bson.M, findOptions ...*FindOptions) (*Iterator[T], error) {
+	stream, err := r.client.FindStream(r.newDocument(), filter, findOptions...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewIterator[T](stream), nil
+}
+
+func (r *Repository[T]) Create(d T) error {
+	return r.client.Persist(d)
+}
+
+func (r *Repository[T]) Replace(d T) error {
+	return r.client.Replace(d)
+}
+
+func (r *Repository[T]) Patch(id string, input interface{}) (*UpdateResult, error) {
+	return r.client.Update(r.newDocument(), id, input)
+}
+
+func (r *Repository[T]) Delete(id string) error {
+	return r.client.DeleteWhere(r.newDocument(), "_id", id)
+}
@@ -0,0 +1,122 @@
+package mongo_test
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	mongo "github.com/luxation/go-mongo/v2"
+	mocks "github.com/luxation/go-mongo/v2/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	driver "go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+type Bar struct {
+	mongo.BasicDocument `bson:",inline"`
+	Name                string
+}
+
+func (b Bar) DocumentName() string { return "bar" }
+
+func TestRepositoryGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mocks.NewMockClient(ctrl)
+
+	client.EXPECT().FindOneById(gomock.AssignableToTypeOf(&Bar{}), "bar-1").DoAndReturn(func(d mongo.Document, id string) error {
+		bar := d.(*Bar)
+		bar.ID = id
+		bar.Name = "Bar"
+		return nil
+	})
+
+	repository := mongo.NewRepository[*Bar](client)
+
+	bar, err := repository.Get("bar-1")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "bar-1", bar.GetID())
+	assert.Equal(t, "Bar", bar.Name)
+}
+
+func TestRepositoryGetError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mocks.NewMockClient(ctrl)
+
+	client.EXPECT().FindOneById(gomock.Any(), "bar-1").Return(errors.New("not found"))
+
+	repository := mongo.NewRepository[*Bar](client)
+
+	bar, err := repository.Get("bar-1")
+
+	assert.NotNil(t, err)
+	assert.Nil(t, bar)
+}
+
+func TestRepositoryFirst(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mocks.NewMockClient(ctrl)
+
+	filter := bson.M{"name": "Bar"}
+
+	client.EXPECT().FindOne(gomock.AssignableToTypeOf(&Bar{}), filter).DoAndReturn(func(d mongo.Document, filters bson.M, findOptions ...*mongo.FindOptions) error {
+		d.(*Bar).Name = "Bar"
+		return nil
+	})
+
+	repository := mongo.NewRepository[*Bar](client)
+
+	bar, err := repository.First(filter)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Bar", bar.Name)
+}
+
+func TestRepositoryWrites(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mocks.NewMockClient(ctrl)
+
+	bar := &Bar{Name: "Bar"}
+	input := map[string]interface{}{"name": "Patched"}
+
+	client.EXPECT().Persist(bar).Return(nil)
+	client.EXPECT().Replace(bar).Return(nil)
+	client.EXPECT().Update(gomock.AssignableToTypeOf(&Bar{}), "bar-1", input).Return(&mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil)
+	client.EXPECT().DeleteWhere(gomock.AssignableToTypeOf(&Bar{}), "_id", "bar-1").Return(nil)
+
+	repository := mongo.NewRepository[*Bar](client)
+
+	assert.Nil(t, repository.Create(bar))
+	assert.Nil(t, repository.Replace(bar))
+
+	result, err := repository.Patch("bar-1", input)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+
+	assert.Nil(t, repository.Delete("bar-1"))
+}
+
+func TestRepositoryStream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	client := mocks.NewMockClient(ctrl)
+
+	filter := bson.M{"name": bson.M{"$exists": true}}
+
+	cursor, err := driver.NewCursorFromDocuments([]interface{}{
+		bson.M{"_id": "bar-1", "name": "First"},
+		bson.M{"_id": "bar-2", "name": "Second"},
+	}, nil, nil)
+	assert.Nil(t, err)
+
+	client.EXPECT().FindStream(gomock.AssignableToTypeOf(&Bar{}), filter).Return(cursor, nil)
+
+	it, err := mongo.NewRepository[*Bar](client).Stream(filter)
+	assert.Nil(t, err)
+
+	bars, err := it.All(context.Background())
+
+	assert.Nil(t, err)
+	assert.Len(t, bars, 2)
+	assert.Equal(t, "bar-2", bars[1].GetID())
+	assert.Equal(t, "Second", bars[1].Name)
+}
@@ -0,0 +1,201 @@
+package mongo
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"time"
+)
+
+// finalizeTimeout bounds the close of the stream of an Iterator released by
+// the garbage collector, whose finalizers run one at a time.
+const finalizeTimeout = 10 * time.Second
+
+// Stream is a forward-only view over the results of a query. *mongo.Cursor
+// satisfies it.
+type Stream interface {
+	Next(ctx context.Context) bool
+	Decode(v interface{}) error
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// Iterator decodes the results of a Stream into values of type T. The stream
+// is closed as soon as it is exhausted, fails, the context given to Next is
+// done or Close is called. Iterators dropped without being closed release
+// their stream when garbage collected.
+type Iterator[T any] struct {
+	stream Stream
+	err    error
+	closed bool
+}
+
+func NewIterator[T any](stream Stream) *Iterator[T] {
+	it := &Iterator[T]{
+		stream: stream,
+	}
+
+	runtime.SetFinalizer(it, func(it *Iterator[T]) {
+		ctx, cancel := context.WithTimeout(context.Background(), finalizeTimeout)
+		defer cancel()
+
+		_ = it.close(ctx)
+	})
+
+	return it
+}
+
+// Next returns the next value and true, or the zero value and false once the
+// stream is over. Err tells whether it ended because of an error.
+func (it *Iterator[T]) Next(ctx context.Context) (T, bool) {
+	var zero T
+
+	if it.closed {
+		return zero, false
+	}
+
+	if err := ctx.Err(); err != nil {
+		it.fail(err)
+		return zero, false
+	}
+
+	if !it.stream.Next(ctx) {
+		it.fail(it.stream.Err())
+		return zero, false
+	}
+
+	v, err := decodeValue[T](it.stream)
+
+	if err != nil {
+		it.fail(err)
+		return zero, false
+	}
+
+	return v, true
+}
+
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+func (it *Iterator[T]) Close() error {
+	return it.close(context.Background())
+}
+
+func (it *Iterator[T]) close(ctx context.Context) error {
+	if it.closed {
+		return nil
+	}
+
+	it.closed = true
+	runtime.SetFinalizer(it, nil)
+
+	return it.stream.Close(ctx)
+}
+
+func (it *Iterator[T]) fail(err error) {
+	if it.err == nil {
+		it.err = err
+	}
+
+	closeErr := it.Close()
+
+	if it.err == nil {
+		it.err = closeErr
+	}
+}
+
+// All drains the iterator into a slice and closes it.
+func (it *Iterator[T]) All(ctx context.Context) ([]T, error) {
+	var items []T
+
+	for {
+		v, ok := it.Next(ctx)
+
+		if !ok {
+			break
+		}
+
+		items = append(items, v)
+	}
+
+	return items, it.Err()
+}
+
+// NewChannel decodes the results of stream into values of type T sent on the
+// returned channel, which holds up to buffer values. The error channel
+// receives at most one error and is closed once the stream is released, so
+// callers range over the values then read the error channel.
+//
+// Unlike an Iterator, the channel cannot be released by the garbage
+// collector as the producer blocks until its value is received. stop ends
+// the producer and returns once the stream is closed; callers defer it so
+// that the stream is released when they stop receiving early. Cancelling
+// ctx stops the producer as well.
+func NewChannel[T any](ctx context.Context, stream Stream, buffer int) (<-chan T, <-chan error, func()) {
+	items := make(chan T, buffer)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		it := NewIterator[T](stream)
+
+		defer cancel()
+		defer close(done)
+		defer close(errs)
+		defer close(items)
+		defer it.Close()
+
+		for {
+			v, ok := it.Next(ctx)
+
+			if !ok {
+				break
+			}
+
+			select {
+			case items <- v:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+
+		if err := it.Err(); err != nil {
+			errs <- err
+		}
+	}()
+
+	stop := func() {
+		cancel()
+		<-done
+	}
+
+	return items, errs, stop
+}
+
+// newValue returns a value of type T ready to be decoded into, allocating
+// the pointed struct when T is a pointer type.
+func newValue[T any]() T {
+	var v T
+
+	t := reflect.TypeOf(v)
+
+	if t != nil && t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()).Interface().(T)
+	}
+
+	return v
+}
+
+func decodeValue[T any](stream Stream) (T, error) {
+	v := newValue[T]()
+
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Ptr {
+		return v, stream.Decode(v)
+	}
+
+	return v, stream.Decode(&v)
+}
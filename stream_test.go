@@ -0,0 +1,148 @@
+package mongo
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+type closeTracker struct {
+	*mongo.Cursor
+	closed int
+}
+
+func (c *closeTracker) Close(ctx context.Context) error {
+	c.closed++
+	return c.Cursor.Close(ctx)
+}
+
+func newTestStream(t *testing.T, actions ...string) *closeTracker {
+	docs := make([]interface{}, len(actions))
+
+	for i, action := range actions {
+		docs[i] = bson.M{"_id": action, "action": action}
+	}
+
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+	assert.Nil(t, err)
+
+	return &closeTracker{Cursor: cursor}
+}
+
+func TestIteratorDecodesAndCloses(t *testing.T) {
+	stream := newTestStream(t, "a", "b")
+
+	it := NewIterator[*Foo](stream)
+
+	foo, ok := it.Next(context.Background())
+	assert.True(t, ok)
+	assert.Equal(t, "a", foo.GetID())
+	assert.Equal(t, "a", foo.Action)
+
+	foo, ok = it.Next(context.Background())
+	assert.True(t, ok)
+	assert.Equal(t, "b", foo.Action)
+
+	foo, ok = it.Next(context.Background())
+	assert.False(t, ok)
+	assert.Nil(t, foo)
+	assert.Nil(t, it.Err())
+	assert.Equal(t, 1, stream.closed)
+
+	assert.Nil(t, it.Close())
+	assert.Equal(t, 1, stream.closed)
+}
+
+func TestIteratorNonPointerValues(t *testing.T) {
+	items, err := NewIterator[bson.M](newTestStream(t, "a", "b")).All(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []bson.M{{"_id": "a", "action": "a"}, {"_id": "b", "action": "b"}}, items)
+}
+
+func TestIteratorStopsOnCancel(t *testing.T) {
+	stream := newTestStream(t, "a", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	it := NewIterator[*Foo](stream)
+
+	_, ok := it.Next(ctx)
+	assert.True(t, ok)
+
+	cancel()
+
+	_, ok = it.Next(ctx)
+	assert.False(t, ok)
+	assert.ErrorIs(t, it.Err(), context.Canceled)
+	assert.Equal(t, 1, stream.closed)
+}
+
+func TestChannel(t *testing.T) {
+	stream := newTestStream(t, "a", "b", "c")
+
+	items, errs, stop := NewChannel[*Foo](context.Background(), stream, 1)
+	defer stop()
+
+	var actions []string
+
+	for foo := range items {
+		actions = append(actions, foo.Action)
+	}
+
+	assert.Nil(t, <-errs)
+	assert.Equal(t, []string{"a", "b", "c"}, actions)
+	assert.Equal(t, 1, stream.closed)
+}
+
+func TestChannelStopsOnCancel(t *testing.T) {
+	stream := newTestStream(t, "a", "b", "c")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	items, errs, stop := NewChannel[*Foo](ctx, stream, 0)
+	defer stop()
+
+	foo := <-items
+	assert.Equal(t, "a", foo.Action)
+
+	cancel()
+
+	for range items {
+	}
+
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	assert.Equal(t, 1, stream.closed)
+}
+
+func TestChannelAbandonedThenCancelled(t *testing.T) {
+	stream := newTestStream(t, "a", "b", "c")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	_, errs, stop := NewChannel[*Foo](ctx, stream, 0)
+	defer stop()
+
+	cancel()
+
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	assert.Equal(t, 1, stream.closed)
+}
+
+func TestChannelAbandonedThenStopped(t *testing.T) {
+	stream := newTestStream(t, "a", "b", "c")
+
+	items, errs, stop := NewChannel[*Foo](context.Background(), stream, 0)
+
+	foo := <-items
+	assert.Equal(t, "a", foo.Action)
+
+	stop()
+
+	assert.Equal(t, 1, stream.closed)
+	assert.ErrorIs(t, <-errs, context.Canceled)
+
+	stop()
+}
@@ -0,0 +1,649 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UpdateResult reports the outcome of an update. UpsertedID is only set
+// when an upsert inserted a new document.
+type UpdateResult struct {
+	MatchedCount  int64
+	ModifiedCount int64
+	UpsertedCount int64
+	UpsertedID    interface{}
+}
+
+func newUpdateResult(res *mongo.UpdateResult) *UpdateResult {
+	if res == nil {
+		return &UpdateResult{}
+	}
+
+	return &UpdateResult{
+		MatchedCount:  res.MatchedCount,
+		ModifiedCount: res.ModifiedCount,
+		UpsertedCount: res.UpsertedCount,
+		UpsertedID:    res.UpsertedID,
+	}
+}
+
+// UpdateBuilder composes an update from MongoDB update operators. It is
+// accepted as input by every update method in place of a struct or a map.
+// Field paths may use the positional operators $, $[] and $[identifier],
+// the latter being matched by the filters given to ArrayFilter.
+type UpdateBuilder struct {
+	update       bson.D
+	arrayFilters []interface{}
+}
+
+// pendingFields holds the input of SetFields or SetElements under $set,
+// flattened with the settings of the client once the update is sent.
+// identifier names the array filter matching the elements to update.
+type pendingFields struct {
+	input      interface{}
+	field      string
+	position   string
+	identifier string
+}
+
+// pendingFilter is the array filter of a SetElements call, whose keys are
+// mapped onto the elements once the update is sent.
+type pendingFilter struct {
+	identifier string
+	match      bson.M
+}
+
+// PushModifiers shape the array after a $push: Position sets where the
+// values are inserted, Sort orders the array, either 1/-1 or a document
+// sorting embedded documents, and Slice keeps its first elements, or its
+// last ones when negative.
+type PushModifiers struct {
+	Position *int
+	Sort     interface{}
+	Slice    *int
+}
+
+func NewUpdate() *UpdateBuilder {
+	return &UpdateBuilder{}
+}
+
+func (u *UpdateBuilder) add(op, field string, value interface{}) *UpdateBuilder {
+	for i, e := range u.update {
+		if e.Key == op {
+			u.update[i].Value = append(e.Value.(bson.D), bson.E{Key: field, Value: value})
+			return u
+		}
+	}
+
+	u.update = append(u.update, bson.E{Key: op, Value: bson.D{{Key: field, Value: value}}})
+
+	return u
+}
+
+func (u *UpdateBuilder) Set(field string, value interface{}) *UpdateBuilder {
+	return u.add("$set", field, value)
+}
+
+// SetFields sets the flattened fields of input, as Update does, with the
+// naming strategy and the null policy of the client. Flatten errors are
+// returned when the update is sent, and by Err.
+func (u *UpdateBuilder) SetFields(input interface{}) *UpdateBuilder {
+	return u.add("$set", "", pendingFields{input: input})
+}
+
+// SetElements sets the flattened fields of input in the elements of the
+// array field matching match, through an array filter, or in every element
+// when match is empty. For instance, to update the line of an order whose
+// sku is "A1":
+//
+//	NewUpdate().SetElements("lines", bson.M{"sku": "A1"}, LinePatch{Qty: Set(2)})
+//
+// The elements are matched on the server so concurrent changes to the other
+// elements are kept. Flatten errors are returned when the update is sent,
+// and by Err.
+func (u *UpdateBuilder) SetElements(field string, match bson.M, input interface{}) *UpdateBuilder {
+	pending := pendingFields{input: input, field: field, position: "$[]"}
+
+	if len(match) > 0 {
+		pending.identifier = fmt.Sprintf("elem%d", len(u.arrayFilters))
+		pending.position = "$[" + pending.identifier + "]"
+		u.arrayFilters = append(u.arrayFilters, pendingFilter{identifier: pending.identifier, match: match})
+	}
+
+	return u.add("$set", "", pending)
+}
+
+func (u *UpdateBuilder) SetOnInsert(field string, value interface{}) *UpdateBuilder {
+	return u.add("$setOnInsert", field, value)
+}
+
+func (u *UpdateBuilder) Unset(fields ...string) *UpdateBuilder {
+	for _, field := range fields {
+		u.add("$unset", field, "")
+	}
+
+	return u
+}
+
+func (u *UpdateBuilder) Inc(field string, value interface{}) *UpdateBuilder {
+	return u.add("$inc", field, value)
+}
+
+func (u *UpdateBuilder) Mul(field string, value interface{}) *UpdateBuilder {
+	return u.add("$mul", field, value)
+}
+
+func (u *UpdateBuilder) Min(field string, value interface{}) *UpdateBuilder {
+	return u.add("$min", field, value)
+}
+
+func (u *UpdateBuilder) Max(field string, value interface{}) *UpdateBuilder {
+	return u.add("$max", field, value)
+}
+
+// Push appends values to the array field.
+func (u *UpdateBuilder) Push(field string, values ...interface{}) *UpdateBuilder {
+	if len(values) == 1 {
+		return u.add("$push", field, values[0])
+	}
+
+	return u.add("$push", field, bson.D{{Key: "$each", Value: bson.A(values)}})
+}
+
+// PushEach appends values to the array field, then applies modifiers.
+func (u *UpdateBuilder) PushEach(field string, values []interface{}, modifiers PushModifiers) *UpdateBuilder {
+	push := bson.D{{Key: "$each", Value: bson.A(values)}}
+
+	if modifiers.Position != nil {
+		push = append(push, bson.E{Key: "$position", Value: *modifiers.Position})
+	}
+
+	if modifiers.Sort != nil {
+		push = append(push, bson.E{Key: "$sort", Value: modifiers.Sort})
+	}
+
+	if modifiers.Slice != nil {
+		push = append(push, bson.E{Key: "$slice", Value: *modifiers.Slice})
+	}
+
+	return u.add("$push", field, push)
+}
+
+// AddToSet appends the values missing from the array field.
+func (u *UpdateBuilder) AddToSet(field string, values ...interface{}) *UpdateBuilder {
+	if len(values) == 1 {
+		return u.add("$addToSet", field, values[0])
+	}
+
+	return u.add("$addToSet", field, bson.D{{Key: "$each", Value: bson.A(values)}})
+}
+
+// Pull removes the elements of the array field equal to condition, or
+// matching it when condition is a query document.
+func (u *UpdateBuilder) Pull(field string, condition interface{}) *UpdateBuilder {
+	return u.add("$pull", field, condition)
+}
+
+func (u *UpdateBuilder) Rename(field, newName string) *UpdateBuilder {
+	return u.add("$rename", field, newName)
+}
+
+// CurrentDate sets fields to the current date on the server.
+func (u *UpdateBuilder) CurrentDate(fields ...string) *UpdateBuilder {
+	for _, field := range fields {
+		u.add("$currentDate", field, true)
+	}
+
+	return u
+}
+
+// ArrayFilter adds a filter selecting the array elements updated through a
+// $[identifier] path, e.g. bson.M{"item.qty": bson.M{"$lte": 0}} for
+// "items.$[item].status".
+func (u *UpdateBuilder) ArrayFilter(filter bson.M) *UpdateBuilder {
+	u.arrayFilters = append(u.arrayFilters, filter)
+	return u
+}
+
+// ArrayFilters returns the array filters of the update, those of
+// SetElements being built with BsonTagNaming.
+func (u *UpdateBuilder) ArrayFilters() []interface{} {
+	_, arrayFilters, _ := u.build(UpdateConfig{})
+	return arrayFilters
+}
+
+// Err returns the first error met flattening the inputs of SetFields and
+// SetElements.
+func (u *UpdateBuilder) Err() error {
+	_, _, err := u.build(UpdateConfig{})
+	return err
+}
+
+// Document returns the update document built so far, the inputs of
+// SetFields and SetElements being flattened with BsonTagNaming. Inputs which
+// fail to flatten are left out, see Err.
+func (u *UpdateBuilder) Document() bson.D {
+	update, _, _ := u.build(UpdateConfig{})
+	return update
+}
+
+// build returns a copy of the update document and the array filters of u,
+// mapping the operator paths onto the fields of the updated document and
+// flattening the inputs of SetFields and SetElements with config.
+func (u *UpdateBuilder) build(config UpdateConfig) (bson.D, []interface{}, error) {
+	naming := namingOf([]*NamingStrategy{config.Naming})
+	document := reflect.TypeOf(config.Document)
+	update := make(bson.D, 0, len(u.update))
+	unused := make(map[string]bool)
+	elements := make(map[string]reflect.Type)
+
+	var firstErr error
+	var unset []string
+
+	for _, e := range u.update {
+		var fields bson.D
+
+		for _, field := range e.Value.(bson.D) {
+			pending, ok := field.Value.(pendingFields)
+
+			if !ok {
+				field.Key, _ = naming.pathOf(document, field.Key)
+
+				if name, isName := field.Value.(string); isName && e.Key == "$rename" {
+					field.Value, _ = naming.pathOf(document, name)
+				}
+
+				fields = append(fields, field)
+				continue
+			}
+
+			set, elem, err := pending.fields(naming, document)
+
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+
+				continue
+			}
+
+			if pending.identifier != "" {
+				unused[pending.identifier] = len(set) == 0
+				elements[pending.identifier] = elem
+			}
+
+			for _, entry := range set {
+				if entry.Value == nil && config.Nulls == NullUnset {
+					unset = append(unset, entry.Key)
+				} else {
+					fields = append(fields, entry)
+				}
+			}
+		}
+
+		if len(fields) > 0 {
+			update = append(update, bson.E{Key: e.Key, Value: fields})
+		}
+	}
+
+	built := &UpdateBuilder{update: update}
+	built.Unset(unset...)
+	update = built.update
+
+	var arrayFilters []interface{}
+
+	for _, filter := range u.arrayFilters {
+		pending, ok := filter.(pendingFilter)
+
+		if !ok {
+			arrayFilters = append(arrayFilters, filter)
+			continue
+		}
+
+		if unused[pending.identifier] {
+			continue
+		}
+
+		resolved := bson.M{}
+
+		for k, v := range pending.match {
+			key, _ := naming.pathOf(elements[pending.identifier], k)
+			resolved[pending.identifier+"."+key] = v
+		}
+
+		arrayFilters = append(arrayFilters, resolved)
+	}
+
+	return update, arrayFilters, firstErr
+}
+
+// fields flattens the input of p into the fields to set, sorted by path. The
+// keys of bson inputs are mapped onto the fields of document, or of the
+// elements of the array field for SetElements, whose type is returned.
+func (p pendingFields) fields(naming *NamingStrategy, document reflect.Type) (bson.D, reflect.Type, error) {
+	f := newFlattener(naming)
+	prefix := ""
+
+	if p.field != "" {
+		prefix, f.target = naming.pathOf(document, p.field+"."+p.position)
+		prefix += "."
+	} else {
+		f.target = document
+	}
+
+	flattened, err := f.flatten(p.input)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]string, 0, len(flattened))
+
+	for k := range flattened {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	fields := make(bson.D, len(keys))
+
+	for i, k := range keys {
+		fields[i] = bson.E{Key: prefix + k, Value: flattened[k]}
+	}
+
+	return fields, f.target, nil
+}
+
+// touches reports whether an operator of update targets field, one of its
+// parents or one of its children.
+func touches(update bson.D, field string) bool {
+	for _, op := range update {
+		var fields bson.D
+
+		switch value := op.Value.(type) {
+		case bson.D:
+			fields = value
+		case map[string]interface{}:
+			for k, v := range value {
+				fields = append(fields, bson.E{Key: k, Value: v})
+			}
+		case bson.M:
+			for k, v := range value {
+				fields = append(fields, bson.E{Key: k, Value: v})
+			}
+		}
+
+		for _, f := range fields {
+			if f.Key == field || strings.HasPrefix(f.Key, field+".") || strings.HasPrefix(field, f.Key+".") {
+				return true
+			}
+
+			if name, ok := f.Value.(string); ok && op.Key == "$rename" && name == field {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// elementPaths is an update input flattened with FlattenElements.
+type elementPaths struct {
+	input interface{}
+}
+
+// ElementPaths makes Update write the fields of the subdocuments held in the
+// arrays of input one by one, see FlattenElements, instead of replacing the
+// arrays.
+func ElementPaths(input interface{}) interface{} {
+	return elementPaths{input: input}
+}
+
+// UpdatePipeline is an update made of aggregation stages, such as $set and
+// $unset, whose expressions may read the fields of the updated document. It
+// is accepted by the update methods in place of an UpdateBuilder, needs
+// MongoDB 4.2 and cannot be upserted. Its paths are sent as they are.
+type UpdatePipeline []bson.D
+
+var (
+	errPipelineDocument = errors.New("an UpdatePipeline has no update document, see PipelineUpdate")
+	errPipelineUpsert   = errors.New("an UpdatePipeline cannot be upserted")
+)
+
+// UpdateConfig holds the client settings shaping the update documents.
+// Document is the document updated, onto whose fields the keys of bson.M and
+// bson.D inputs are mapped, see NamingStrategy.Path.
+type UpdateConfig struct {
+	Naming   *NamingStrategy
+	Nulls    NullPolicy
+	Document Document
+}
+
+// UpdateDocument returns the update sent by Update, UpdateWhere and UpdateMany
+// for input: the document of an UpdateBuilder, or the flattened fields of
+// input under $set, along with a fresh updatedAt. Explicit nulls are set or
+// unset as the optional config requires.
+func UpdateDocument(input interface{}, config ...UpdateConfig) (bson.D, error) {
+	update, _, err := updateDocument(input, config...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	document, ok := update.(bson.D)
+
+	if !ok {
+		return nil, errPipelineDocument
+	}
+
+	return document, nil
+}
+
+// PipelineUpdate returns the pipeline sent by the update methods when input
+// is an UpdatePipeline: its stages followed by a $set of a fresh updatedAt,
+// unless they already write it.
+func PipelineUpdate(input interface{}) (UpdatePipeline, bool) {
+	pipeline, ok := input.(UpdatePipeline)
+
+	if !ok {
+		return nil, false
+	}
+
+	for _, stage := range pipeline {
+		if stageTouches(stage, "updatedAt") {
+			return pipeline, true
+		}
+	}
+
+	return append(pipeline[:len(pipeline):len(pipeline)], bson.D{{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}}}), true
+}
+
+// stageTouches reports whether the $set, $addFields or $unset stage writes
+// field, one of its parents or one of its children.
+func stageTouches(stage bson.D, field string) bool {
+	for _, e := range stage {
+		switch e.Key {
+		case "$set", "$addFields":
+			if touches(bson.D{e}, field) {
+				return true
+			}
+		case "$unset":
+			var fields []string
+
+			switch value := e.Value.(type) {
+			case string:
+				fields = []string{value}
+			case []string:
+				fields = value
+			case bson.A:
+				for _, v := range value {
+					if name, isName := v.(string); isName {
+						fields = append(fields, name)
+					}
+				}
+			}
+
+			for _, f := range fields {
+				if f == field || strings.HasPrefix(f, field+".") || strings.HasPrefix(field, f+".") {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// UpdateArrayFilters returns the array filters of input when it is an
+// UpdateBuilder, built with the optional config as UpdateDocument does.
+func UpdateArrayFilters(input interface{}, config ...UpdateConfig) ([]interface{}, error) {
+	_, arrayFilters, err := updateDocument(input, config...)
+	return arrayFilters, err
+}
+
+func updateDocument(input interface{}, config ...UpdateConfig) (interface{}, []interface{}, error) {
+	if pipeline, ok := PipelineUpdate(input); ok {
+		return pipeline, nil, nil
+	}
+
+	var cfg UpdateConfig
+
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	builder, ok := input.(*UpdateBuilder)
+
+	if !ok {
+		f := newFlattener(namingOf([]*NamingStrategy{cfg.Naming}))
+		f.target = reflect.TypeOf(cfg.Document)
+
+		if elements, isElements := input.(elementPaths); isElements {
+			input, f.elements = elements.input, true
+		}
+
+		updates, err := f.flatten(input)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var unset bson.D
+
+		if cfg.Nulls == NullUnset {
+			for field, value := range updates {
+				if value == nil {
+					unset = append(unset, bson.E{Key: field, Value: ""})
+					delete(updates, field)
+				}
+			}
+		}
+
+		updates["updatedAt"] = time.Now()
+
+		update := bson.D{
+			{Key: "$set", Value: updates},
+		}
+
+		if len(unset) > 0 {
+			sort.Slice(unset, func(i, j int) bool { return unset[i].Key < unset[j].Key })
+			update = append(update, bson.E{Key: "$unset", Value: unset})
+		}
+
+		return update, nil, nil
+	}
+
+	update, arrayFilters, err := builder.build(cfg)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if touches(update, "updatedAt") {
+		return update, arrayFilters, nil
+	}
+
+	for i, e := range update {
+		if e.Key == "$set" {
+			update[i].Value = append(e.Value.(bson.D), bson.E{Key: "updatedAt", Value: time.Now()})
+			return update, arrayFilters, nil
+		}
+	}
+
+	return append(update, bson.E{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: time.Now()}}}), arrayFilters, nil
+}
+
+// UpsertDocument adds to update the fields Persist sets on new documents, so
+// that a document inserted by an upsert gets a UUID _id and a createdAt. The
+// _id is left to the server when filter matches it by equality, since the
+// inserted document then takes it from filter.
+func UpsertDocument(update bson.D, filter bson.M) bson.D {
+	onInsert := bson.M{}
+
+	for key, value := range map[string]interface{}{"_id": uuid.New().String(), "createdAt": time.Now()} {
+		if touches(update, key) || key == "_id" && equality(filter["_id"]) {
+			continue
+		}
+
+		onInsert[key] = value
+	}
+
+	return append(update[:len(update):len(update)], bson.E{Key: "$setOnInsert", Value: onInsert})
+}
+
+// equality reports whether the filter value of a field matches a single
+// value: a plain value or an $eq condition.
+func equality(condition interface{}) bool {
+	var keys []string
+
+	switch c := condition.(type) {
+	case nil:
+		return false
+	case bson.M:
+		for k := range c {
+			keys = append(keys, k)
+		}
+	case bson.D:
+		for _, e := range c {
+			keys = append(keys, e.Key)
+		}
+	default:
+		return true
+	}
+
+	for _, k := range keys {
+		if k == "$eq" {
+			return true
+		}
+
+		if strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// arrayFiltersOption returns the driver option holding arrayFilters, nil
+// when there are none.
+func arrayFiltersOption(arrayFilters []interface{}) *options.ArrayFilters {
+	if len(arrayFilters) == 0 {
+		return nil
+	}
+
+	return &options.ArrayFilters{Filters: arrayFilters}
+}
+
+func updateOptions(arrayFilters []interface{}) *options.UpdateOptions {
+	return &options.UpdateOptions{
+		ArrayFilters: arrayFiltersOption(arrayFilters),
+	}
+}
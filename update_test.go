@@ -0,0 +1,220 @@
+package mongo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+	"time"
+)
+
+func TestUpdateBuilderDocument(t *testing.T) {
+	slice := -5
+
+	update := NewUpdate().
+		Set("status", "open").
+		Inc("views", 1).
+		Inc("likes", 2).
+		Unset("draft", "preview").
+		Push("tags", "new").
+		PushEach("scores", []interface{}{7, 3}, PushModifiers{Sort: -1, Slice: &slice}).
+		AddToSet("labels", "a", "b").
+		Pull("comments", bson.M{"spam": true}).
+		Rename("title", "name").
+		Min("low", 1).
+		Max("high", 9).
+		Mul("price", 1.1).
+		CurrentDate("checkedAt")
+
+	assert.Equal(t, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "status", Value: "open"}}},
+		{Key: "$inc", Value: bson.D{{Key: "views", Value: 1}, {Key: "likes", Value: 2}}},
+		{Key: "$unset", Value: bson.D{{Key: "draft", Value: ""}, {Key: "preview", Value: ""}}},
+		{Key: "$push", Value: bson.D{
+			{Key: "tags", Value: "new"},
+			{Key: "scores", Value: bson.D{
+				{Key: "$each", Value: bson.A{7, 3}},
+				{Key: "$sort", Value: -1},
+				{Key: "$slice", Value: -5},
+			}},
+		}},
+		{Key: "$addToSet", Value: bson.D{{Key: "labels", Value: bson.D{{Key: "$each", Value: bson.A{"a", "b"}}}}}},
+		{Key: "$pull", Value: bson.D{{Key: "comments", Value: bson.M{"spam": true}}}},
+		{Key: "$rename", Value: bson.D{{Key: "title", Value: "name"}}},
+		{Key: "$min", Value: bson.D{{Key: "low", Value: 1}}},
+		{Key: "$max", Value: bson.D{{Key: "high", Value: 9}}},
+		{Key: "$mul", Value: bson.D{{Key: "price", Value: 1.1}}},
+		{Key: "$currentDate", Value: bson.D{{Key: "checkedAt", Value: true}}},
+	}, update.Document())
+}
+
+func TestUpdateDocumentStampsUpdatedAt(t *testing.T) {
+	builder := NewUpdate().Inc("views", 1)
+
+	update, err := UpdateDocument(builder)
+	assert.Nil(t, err)
+	assert.Len(t, update, 2)
+	assert.Equal(t, "$set", update[1].Key)
+	assert.Equal(t, "updatedAt", update[1].Value.(bson.D)[0].Key)
+	assert.IsType(t, time.Time{}, update[1].Value.(bson.D)[0].Value)
+
+	assert.Len(t, builder.Document(), 1)
+
+	update, err = UpdateDocument(NewUpdate().Set("status", "open"))
+	assert.Nil(t, err)
+	assert.Len(t, update, 1)
+	assert.Len(t, update[0].Value.(bson.D), 2)
+
+	update, err = UpdateDocument(NewUpdate().CurrentDate("updatedAt"))
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{{Key: "$currentDate", Value: bson.D{{Key: "updatedAt", Value: true}}}}, update)
+
+	update, err = UpdateDocument(bson.M{"status": "open"})
+	assert.Nil(t, err)
+	assert.Contains(t, update[0].Value, "updatedAt")
+}
+
+func TestUpdateDocumentFlattenErrors(t *testing.T) {
+	_, err := UpdateDocument(bson.M{"callback": func() {}})
+
+	var flattenErr *FlattenError
+	assert.ErrorAs(t, err, &flattenErr)
+	assert.Equal(t, "callback", flattenErr.Path)
+
+	builder := NewUpdate().SetFields(bson.M{"callback": func() {}}).Set("status", "open")
+	assert.ErrorAs(t, builder.Err(), &flattenErr)
+
+	_, err = UpdateDocument(builder)
+	assert.ErrorAs(t, err, &flattenErr)
+
+	bulk := NewBulkWrite(&Foo{}).UpdateMany(bson.M{}, bson.M{"callback": func() {}})
+	assert.Nil(t, bulk.Err())
+
+	_, err = bulk.Models()
+	assert.ErrorAs(t, err, &flattenErr)
+}
+
+func TestUpdateArrayFilters(t *testing.T) {
+	filters, err := UpdateArrayFilters(bson.M{"status": "open"})
+	assert.Nil(t, err)
+	assert.Nil(t, filters)
+
+	filters, err = UpdateArrayFilters(NewUpdate().Set("status", "open"))
+	assert.Nil(t, err)
+	assert.Nil(t, filters)
+	assert.Nil(t, updateOptions(filters).ArrayFilters)
+
+	builder := NewUpdate().
+		Set("items.$[item].status", "sold out").
+		ArrayFilter(bson.M{"item.qty": bson.M{"$lte": 0}})
+
+	filters, err = UpdateArrayFilters(builder)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{bson.M{"item.qty": bson.M{"$lte": 0}}}, updateOptions(filters).ArrayFilters.Filters)
+
+	models, err := NewBulkWrite(&Foo{}).UpdateMany(bson.M{}, builder).Models()
+	assert.Nil(t, err)
+	assert.Equal(t, builder.ArrayFilters(), models[0].(*mongo.UpdateManyModel).ArrayFilters.Filters)
+}
+
+type orderLine struct {
+	Sku string        `bson:"sku"`
+	Qty Optional[int] `bson:"qty"`
+}
+
+type orderPatch struct {
+	Status string       `bson:"status"`
+	Lines  []*orderLine `bson:"lines"`
+	Tags   []string     `bson:"tags"`
+}
+
+func TestUpdateBuilderSetElements(t *testing.T) {
+	update := NewUpdate().
+		SetElements("lines", bson.M{"sku": "A1"}, bson.M{"qty": Set(2)}).
+		SetElements("lines", nil, bson.M{"checked": true})
+
+	assert.Nil(t, update.Err())
+	assert.Equal(t, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "lines.$[elem0].qty", Value: 2},
+			{Key: "lines.$[].checked", Value: true},
+		}},
+	}, update.Document())
+	assert.Equal(t, []interface{}{bson.M{"elem0.sku": "A1"}}, update.ArrayFilters())
+
+	empty := NewUpdate().SetElements("lines", bson.M{"sku": "A1"}, bson.M{"qty": Optional[int]{}})
+	assert.Empty(t, empty.Document())
+	assert.Empty(t, empty.ArrayFilters())
+}
+
+func TestUpdateBuilderUsesClientConfig(t *testing.T) {
+	update := NewUpdate().
+		Unset("extra").
+		SetFields(bson.M{"displayName": "Jane", "tagged": nil}).
+		SetElements("lines", bson.M{"SKU": "A1"}, bson.M{"unitPrice": 2})
+
+	config := UpdateConfig{Naming: SnakeCaseNaming, Nulls: NullUnset, Document: &namedOrder{}}
+
+	document, err := UpdateDocument(update, config)
+	assert.Nil(t, err)
+	assert.Equal(t, bson.E{Key: "$unset", Value: bson.D{{Key: "extra", Value: ""}, {Key: "tag_name", Value: ""}}}, document[0])
+	assert.Equal(t, bson.D{
+		{Key: "display_name", Value: "Jane"},
+		{Key: "lines.$[elem0].unit_price", Value: 2},
+	}, document[1].Value.(bson.D)[:2])
+
+	filters, err := UpdateArrayFilters(update, config)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{bson.M{"elem0.sku": "A1"}}, filters)
+
+	assert.Equal(t, bson.D{{Key: "$unset", Value: bson.D{{Key: "extra", Value: ""}}}, {Key: "$set", Value: bson.D{
+		{Key: "displayName", Value: "Jane"},
+		{Key: "tagged", Value: nil},
+		{Key: "lines.$[elem0].unitPrice", Value: 2},
+	}}}, update.Document())
+}
+
+func TestUpdateBuilderNamesOperatorPaths(t *testing.T) {
+	update := NewUpdate().
+		Set("displayName", "Jane").
+		Inc("lines.$[].unitPrice", 1).
+		Rename("tagged", "address.zipCode").
+		CurrentDate("updatedAt")
+
+	document, err := UpdateDocument(update, UpdateConfig{Naming: SnakeCaseNaming, Document: &namedOrder{}})
+	assert.Nil(t, err)
+	assert.Equal(t, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "display_name", Value: "Jane"}}},
+		{Key: "$inc", Value: bson.D{{Key: "lines.$[].unit_price", Value: 1}}},
+		{Key: "$rename", Value: bson.D{{Key: "tag_name", Value: "address.zip_code"}}},
+		{Key: "$currentDate", Value: bson.D{{Key: "updatedAt", Value: true}}},
+	}, document)
+
+	assert.Equal(t, bson.D{{Key: "displayName", Value: "Jane"}}, update.Document()[0].Value)
+}
+
+func TestFlattenElements(t *testing.T) {
+	patch := orderPatch{
+		Status: "paid",
+		Lines:  []*orderLine{{Sku: "A1", Qty: Set(1)}, {Sku: "B2"}},
+		Tags:   []string{"gift"},
+	}
+
+	fields, err := FlattenElements(patch)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"status":      "paid",
+		"lines.0.sku": "A1",
+		"lines.0.qty": 1,
+		"lines.1.sku": "B2",
+		"tags":        []string{"gift"},
+	}, fields)
+
+	fields, err = Flatten(patch)
+	assert.Nil(t, err)
+	assert.Equal(t, patch.Lines, fields["lines"])
+
+	update, err := UpdateDocument(ElementPaths(patch))
+	assert.Nil(t, err)
+	assert.Contains(t, update[0].Value, "lines.1.sku")
+}
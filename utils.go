@@ -1,95 +1,123 @@
 package mongo
 
 import (
-	"encoding/json"
-	"github.com/iancoleman/strcase"
-	"go.mongodb.org/mongo-driver/bson"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"strings"
+	"reflect"
 )
 
-func FlattenedMapFromInterface(from interface{}) map[string]interface{} {
-	jsonFields := make(map[string]interface{})
-	switch from.(type) {
-	case primitive.M, primitive.D, primitive.E, primitive.A, primitive.Regex:
-		marshaled, err := json.Marshal(from)
-		if err != nil {
-			panic(err)
-		}
-
-		err = json.Unmarshal(marshaled, &jsonFields)
-		if err != nil {
-			panic(err)
-		}
+// FlattenedMapFromInterface is Flatten panicking on error, kept for
+// compatibility.
+func FlattenedMapFromInterface(from interface{}, naming ...*NamingStrategy) map[string]interface{} {
+	fields, err := Flatten(from, naming...)
+	if err != nil {
+		panic(err)
+	}
 
-		return jsonFields
-	default:
-		resultFields := make(map[string]interface{})
+	return fields
+}
 
-		keys := make(map[string]interface{})
+// Flatten returns the fields of from keyed by their dotted path, as set by
+// Update. Structs are walked the way the driver encodes them: keys come from
+// the bson tags, inline and omitempty are honored and types with their own
+// marshaler are kept whole. Nil fields and unset Optional fields are left
+// out, as well as the top level _id, while null Optional fields are kept as
+// nil. The keys of bson.M and bson.D inputs are paths kept as they are, the
+// naming strategy, which defaults to BsonTagNaming, only keying struct
+// fields. Values which cannot be marshalled, such as channels, functions or
+// cycles, return a *FlattenError naming the offending field.
+func Flatten(from interface{}, naming ...*NamingStrategy) (map[string]interface{}, error) {
+	return newFlattener(namingOf(naming)).flatten(from)
+}
 
-		jsonMarshaled, err := json.Marshal(from)
-		if err != nil {
-			panic(err)
-		}
+// FlattenElements is Flatten walking into the arrays of subdocuments, so
+// that their fields get element level paths such as items.0.qty and an
+// update only writes the fields it sets. Stored arrays holding more elements
+// keep the extra ones.
+func FlattenElements(from interface{}, naming ...*NamingStrategy) (map[string]interface{}, error) {
+	f := newFlattener(namingOf(naming))
+	f.elements = true
 
-		err = json.Unmarshal(jsonMarshaled, &keys)
-		if err != nil {
-			panic(err)
-		}
+	return f.flatten(from)
+}
 
-		kk := make(map[string]string)
+func (f *flattener) flatten(from interface{}) (map[string]interface{}, error) {
 
-		fillCamelCaseFields(keys, kk)
+	switch value := from.(type) {
+	case primitive.M:
+		for k, v := range value {
+			if err := f.raw(k, v); err != nil {
+				return nil, err
+			}
+		}
 
-		marshaled, err := bson.Marshal(from)
-		if err != nil {
-			panic(err)
+		return f.fields, nil
+	case primitive.D:
+		for _, e := range value {
+			if err := f.raw(e.Key, e.Value); err != nil {
+				return nil, err
+			}
 		}
 
-		err = bson.Unmarshal(marshaled, &jsonFields)
-		if err != nil {
-			panic(err)
+		return f.fields, nil
+	case primitive.E:
+		if err := f.raw(value.Key, value.Value); err != nil {
+			return nil, err
 		}
 
-		flattenNestMap("", jsonFields, resultFields, kk)
+		return f.fields, nil
+	}
+
+	v, entered, err := f.enter("", reflect.ValueOf(from))
+	defer f.leave(entered)
 
-		return resultFields
+	if err != nil {
+		return nil, err
 	}
-}
 
-func fillCamelCaseFields(keys map[string]interface{}, kk map[string]string) {
-	for k, v := range keys {
-		switch child := v.(type) {
-		case map[string]interface{}:
-			kk[strings.ToLower(k)] = strcase.ToLowerCamel(k)
-			fillCamelCaseFields(child, kk)
+	if v.IsValid() {
+		switch cachedType(v.Type(), f.naming).kind {
+		case flattenStruct:
+			err = f.document("", v, true)
+		case flattenMap:
+			err = f.entries("", v, true)
 		default:
-			kk[strings.ToLower(k)] = strcase.ToLowerCamel(k)
+			err = &FlattenError{Err: fmt.Errorf("cannot flatten a %s", v.Type())}
 		}
+	} else {
+		err = &FlattenError{Err: fmt.Errorf("cannot flatten nil")}
 	}
-}
 
-func flattenNestMap(prefix string, src map[string]interface{}, dest map[string]interface{}, keys map[string]string) {
-	if len(prefix) > 0 {
-		prefix += "."
+	if err != nil {
+		return nil, err
 	}
-	for k, v := range src {
-		if k == "id" || k == "_id" {
-			continue
-		}
 
-		if _, found := keys[strings.ToLower(k)]; !found {
-			continue
+	return f.fields, nil
+}
+
+// raw sets value at the path key without walking it, nil included.
+func (f *flattener) raw(key string, value interface{}) error {
+	key, _ = f.naming.pathOf(f.target, key)
+
+	if opt, ok := value.(optionalValue); ok {
+		v, set, null := opt.optional()
+
+		if !set {
+			return nil
 		}
 
-		switch child := v.(type) {
-		case map[string]interface{}:
-			flattenNestMap(prefix+keys[strings.ToLower(k)], child, dest, keys)
-		case nil:
-			break
-		default:
-			dest[prefix+keys[strings.ToLower(k)]] = v
+		value = v
+
+		if null {
+			value = nil
 		}
 	}
+
+	if err := f.check(key, reflect.ValueOf(value)); err != nil {
+		return err
+	}
+
+	f.fields[key] = value
+
+	return nil
 }
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -46,7 +49,7 @@ func TestFlattenedMapFromInterface(t *testing.T) {
 			},
 			expectedRes: map[string]interface{}{
 				"bar.action": "dumb",
-				"bars":       []interface{}{"tata", "toto"},
+				"bars":       []string{"tata", "toto"},
 			},
 		},
 		{
@@ -60,7 +63,7 @@ func TestFlattenedMapFromInterface(t *testing.T) {
 			expectedRes: map[string]interface{}{
 				"name":       "dummy",
 				"bar.action": "dumb",
-				"bars":       []interface{}{"tata", "toto"},
+				"bars":       []string{"tata", "toto"},
 			},
 		},
 	}
@@ -70,6 +73,168 @@ func TestFlattenedMapFromInterface(t *testing.T) {
 	}
 }
 
+type money struct {
+	cents int64
+}
+
+func (m money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(fmt.Sprintf("%d.%02d", m.cents/100, m.cents%100))
+}
+
+func TestFlattenFollowsBsonTags(t *testing.T) {
+	type address struct {
+		City    string `bson:"city"`
+		ZipCode string `bson:"zip,omitempty"`
+	}
+	type audit struct {
+		Author string `bson:"author"`
+	}
+	type order struct {
+		BasicDocument `bson:",inline"`
+		audit         `bson:",inline"`
+		Audit         audit             `bson:",inline"`
+		Reference     string            `json:"ref" bson:"reference"`
+		Total         money             `bson:"total"`
+		Shipping      *address          `bson:"shipping"`
+		Billing       *address          `bson:"billing"`
+		Quantity      int64             `bson:"qty,minsize"`
+		Notes         string            `bson:"notes,omitempty"`
+		Labels        map[string]string `bson:"labels"`
+		Extra         bson.M            `bson:",inline"`
+		Internal      string            `bson:"-"`
+		Placed        time.Time         `bson:"placed"`
+	}
+
+	placed := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	fields, err := Flatten(&order{
+		BasicDocument: BasicDocument{ID: "order-1"},
+		Audit:         audit{Author: "jane"},
+		Reference:     "A-1",
+		Total:         money{cents: 1250},
+		Shipping:      &address{City: "Lyon"},
+		Quantity:      3,
+		Labels:        map[string]string{"gift": "yes"},
+		Extra:         bson.M{"channel": "web"},
+		Internal:      "secret",
+		Placed:        placed,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"author":        "jane",
+		"reference":     "A-1",
+		"total":         money{cents: 1250},
+		"shipping.city": "Lyon",
+		"qty":           int32(3),
+		"labels.gift":   "yes",
+		"channel":       "web",
+		"placed":        placed,
+	}, fields)
+}
+
+func TestFlattenReportsFieldPath(t *testing.T) {
+	type node struct {
+		Name string `json:"name"`
+		Next *node  `json:"next"`
+	}
+	type inner struct {
+		Events chan string
+	}
+	type outer struct {
+		Title string        `json:"title"`
+		Inner *inner        `json:"inner"`
+		Items []interface{} `json:"items"`
+	}
+
+	cyclic := &node{Name: "a"}
+	cyclic.Next = &node{Name: "b", Next: cyclic}
+
+	tests := []struct {
+		input interface{}
+		path  string
+	}{
+		{input: outer{Inner: &inner{Events: make(chan string)}}, path: "inner.events"},
+		{input: outer{Items: []interface{}{"a", &inner{}}}, path: "items.1.events"},
+		{input: bson.M{"meta": bson.M{"callback": func() {}}}, path: "meta.callback"},
+		{input: cyclic, path: "next.next"},
+	}
+
+	for _, test := range tests {
+		fields, err := Flatten(test.input)
+		assert.Nil(t, fields)
+
+		var flattenErr *FlattenError
+		if assert.ErrorAs(t, err, &flattenErr) {
+			assert.Equal(t, test.path, flattenErr.Path)
+			assert.Contains(t, err.Error(), test.path)
+		}
+	}
+
+	assert.Panics(t, func() {
+		FlattenedMapFromInterface(outer{Inner: &inner{}})
+	})
+}
+
+func TestFlattenConcurrently(t *testing.T) {
+	type tree struct {
+		Name     string  `bson:"name"`
+		Children []*tree `bson:"children"`
+	}
+	type leaf struct {
+		Tags  []string          `bson:"tags"`
+		Attrs map[string]string `bson:"attrs"`
+	}
+	type root struct {
+		Tree  tree   `bson:"tree"`
+		Leafs []leaf `bson:"leafs"`
+	}
+
+	input := root{
+		Tree:  tree{Name: "a", Children: []*tree{{Name: "b"}}},
+		Leafs: []leaf{{Tags: []string{"x"}, Attrs: map[string]string{"k": "v"}}},
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			fields, err := Flatten(input)
+			assert.Nil(t, err)
+			assert.Equal(t, "a", fields["tree.name"])
+			assert.Equal(t, []leaf{{Tags: []string{"x"}, Attrs: map[string]string{"k": "v"}}}, fields["leafs"])
+		}()
+	}
+
+	wg.Wait()
+
+	assert.False(t, cachedType(reflect.TypeOf(tree{}), BsonTagNaming).safe)
+	assert.True(t, cachedType(reflect.TypeOf(leaf{}), BsonTagNaming).safe)
+}
+
+func BenchmarkFlatten(b *testing.B) {
+	input := User{
+		FirstName: "Ada",
+		LastName:  "Lovelace",
+		Email:     "ada@example.com",
+		Info:      UserInfo{Title: "Countess"},
+	}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_, err := Flatten(input)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestFlattenedMapFromBson(t *testing.T) {
 	obj := bson.M{"test": "foo", "test2": nil}
 